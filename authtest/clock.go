@@ -0,0 +1,43 @@
+package authtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// FakeClock is a core.Clock whose time only changes when told to
+type FakeClock struct {
+	mutex sync.RWMutex
+	now   time.Time
+}
+
+// NewFakeClock creates a clock frozen at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the clock's current time
+func (c *FakeClock) Now() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.now
+}
+
+// Set moves the clock to now
+func (c *FakeClock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d and returns the new time
+func (c *FakeClock) Advance(d time.Duration) time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+var _ core.Clock = (*FakeClock)(nil)
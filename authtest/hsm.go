@@ -0,0 +1,118 @@
+// Package authtest provides in-process fakes for testing code built on jwk-auth.
+package authtest
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// ErrUnknownKeyHandle is returned for handles the fake HSM does not hold
+var ErrUnknownKeyHandle = errors.New("authtest: unknown key handle")
+
+// FakeHSM is an in-memory core.RemoteSignerClient. Keys are generated inside
+// the fake and only their public halves and signatures are ever returned.
+type FakeHSM struct {
+	mutex     sync.Mutex
+	keys      map[string]crypto.Signer
+	signCount map[string]int
+	signErr   error
+}
+
+// NewFakeHSM creates an empty fake HSM
+func NewFakeHSM() *FakeHSM {
+	return &FakeHSM{
+		keys:      make(map[string]crypto.Signer),
+		signCount: make(map[string]int),
+	}
+}
+
+// GenerateKey creates a key under keyHandle suitable for algorithm
+func (h *FakeHSM) GenerateKey(keyHandle string, algorithm jwa.SignatureAlgorithm) error {
+	var privateKey crypto.Signer
+	var err error
+	switch algorithm {
+	case jwa.ES256():
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwa.ES384():
+		privateKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case jwa.ES512():
+		privateKey, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case jwa.RS256(), jwa.RS384(), jwa.RS512(), jwa.PS256(), jwa.PS384(), jwa.PS512():
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return fmt.Errorf("authtest: unsupported algorithm %s", algorithm)
+	}
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.keys[keyHandle] = privateKey
+	return nil
+}
+
+// PublicKey returns the public half of the key under keyHandle
+func (h *FakeHSM) PublicKey(ctx context.Context, keyHandle string) (crypto.PublicKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	privateKey, exists := h.keys[keyHandle]
+	if !exists {
+		return nil, ErrUnknownKeyHandle
+	}
+	return privateKey.Public(), nil
+}
+
+// Sign signs digest with the key under keyHandle
+func (h *FakeHSM) Sign(ctx context.Context, keyHandle string, algorithm jwa.SignatureAlgorithm, digest []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	h.mutex.Lock()
+	privateKey, exists := h.keys[keyHandle]
+	signErr := h.signErr
+	if exists && signErr == nil {
+		h.signCount[keyHandle]++
+	}
+	h.mutex.Unlock()
+
+	if signErr != nil {
+		return nil, signErr
+	}
+	if !exists {
+		return nil, ErrUnknownKeyHandle
+	}
+	return privateKey.Sign(rand.Reader, digest, core.SignerOptsFor(algorithm))
+}
+
+// SetSignError makes every subsequent Sign call fail with err; nil restores signing
+func (h *FakeHSM) SetSignError(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.signErr = err
+}
+
+// SignCount returns how many signatures were produced with keyHandle
+func (h *FakeHSM) SignCount(keyHandle string) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.signCount[keyHandle]
+}
+
+var _ core.RemoteSignerClient = (*FakeHSM)(nil)
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+	"slices"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+)
+
+// DefaultAllowedAlgorithms lists the signing algorithms accepted by default
+var DefaultAllowedAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// lookupSignatureAlgorithm resolves an asymmetric signature algorithm by name
+func lookupSignatureAlgorithm(name string) (jwa.SignatureAlgorithm, error) {
+	alg, ok := jwa.LookupSignatureAlgorithm(name)
+	if !ok || alg.IsSymmetric() || alg == jwa.NoSignature() {
+		return jwa.EmptySignatureAlgorithm(), fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, name)
+	}
+	return alg, nil
+}
+
+// CheckVerificationAlgorithm resolves the algorithm named in a token header.
+// It must be an asymmetric algorithm on the allowed list and equal to keyAlg,
+// the algorithm bound to the verification key.
+func CheckVerificationAlgorithm(name string, allowed []string, keyAlg jwa.SignatureAlgorithm) (jwa.SignatureAlgorithm, error) {
+	alg, err := lookupSignatureAlgorithm(name)
+	if err != nil {
+		return jwa.EmptySignatureAlgorithm(), err
+	}
+	if !slices.Contains(allowed, alg.String()) {
+		return jwa.EmptySignatureAlgorithm(), fmt.Errorf("%w: algorithm %s is not allowed", ErrUnsupportedAlgorithm, alg)
+	}
+	if alg != keyAlg {
+		return jwa.EmptySignatureAlgorithm(), fmt.Errorf("%w: token uses %s, key is bound to %s", ErrAlgorithmMismatch, alg, keyAlg)
+	}
+	return alg, nil
+}
+
+// curveFor returns the elliptic curve required by an ECDSA algorithm
+func curveFor(alg jwa.SignatureAlgorithm) (elliptic.Curve, bool) {
+	switch alg {
+	case jwa.ES256():
+		return elliptic.P256(), true
+	case jwa.ES384():
+		return elliptic.P384(), true
+	case jwa.ES512():
+		return elliptic.P521(), true
+	}
+	return nil, false
+}
+
+// isRSAAlgorithm reports whether alg is an RSA signature algorithm
+func isRSAAlgorithm(alg jwa.SignatureAlgorithm) bool {
+	switch alg {
+	case jwa.RS256(), jwa.RS384(), jwa.RS512(), jwa.PS256(), jwa.PS384(), jwa.PS512():
+		return true
+	}
+	return false
+}
+
+// defaultAlgorithmFor infers the signature algorithm for a public key
+func defaultAlgorithmFor(publicKey crypto.PublicKey) (jwa.SignatureAlgorithm, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwa.RS256(), nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwa.ES256(), nil
+		case elliptic.P384():
+			return jwa.ES384(), nil
+		case elliptic.P521():
+			return jwa.ES512(), nil
+		}
+	case ed25519.PublicKey:
+		return jwa.EdDSA(), nil
+	}
+	return jwa.EmptySignatureAlgorithm(), fmt.Errorf("%w: %T", ErrUnsupportedKeyType, publicKey)
+}
+
+// checkKeyAlgorithm verifies that publicKey can be used with alg
+func checkKeyAlgorithm(alg jwa.SignatureAlgorithm, publicKey crypto.PublicKey) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if isRSAAlgorithm(alg) {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if curve, ok := curveFor(alg); ok && curve == key.Curve {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if alg == jwa.EdDSA() {
+			return nil
+		}
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedKeyType, publicKey)
+	}
+	return fmt.Errorf("%w: %s cannot be used with %T", ErrAlgorithmMismatch, alg, publicKey)
+}
+
+// keySizeOf returns the key size in bits
+func keySizeOf(publicKey crypto.PublicKey) int {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
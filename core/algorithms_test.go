@@ -0,0 +1,33 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+)
+
+func TestCheckVerificationAlgorithm(t *testing.T) {
+	allowed := []string{"ES256", "RS256"}
+	tests := []struct {
+		name    string
+		alg     string
+		keyAlg  jwa.SignatureAlgorithm
+		wantErr error
+	}{
+		{"allowed and matching", "ES256", jwa.ES256(), nil},
+		{"none", "none", jwa.ES256(), ErrUnsupportedAlgorithm},
+		{"symmetric", "HS256", jwa.ES256(), ErrUnsupportedAlgorithm},
+		{"unknown", "XX999", jwa.ES256(), ErrUnsupportedAlgorithm},
+		{"not allowed", "EdDSA", jwa.EdDSA(), ErrUnsupportedAlgorithm},
+		{"different from key", "RS256", jwa.ES256(), ErrAlgorithmMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alg, err := CheckVerificationAlgorithm(tt.alg, allowed, tt.keyAlg)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && alg != tt.keyAlg) {
+				t.Errorf("CheckVerificationAlgorithm(%s) = %s, %v, want error %v", tt.alg, alg, err, tt.wantErr)
+			}
+		})
+	}
+}
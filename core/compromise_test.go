@@ -0,0 +1,121 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMarkKeyCompromisedCutoffBoundary(t *testing.T) {
+	clock := newTestClock()
+	clock.Advance(300 * time.Millisecond)
+	manager := newTestManager(t, clock)
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+
+	cutoff := clock.Now()
+	metadata, err := manager.MarkKeyCompromised("alice", "leaked", cutoff)
+	if err != nil {
+		t.Fatalf("MarkKeyCompromised: %v", err)
+	}
+	if metadata.State != KeyStateCompromised || !metadata.CompromisedAt.Equal(cutoff) || metadata.CompromiseReason != "leaked" {
+		t.Errorf("metadata = %+v, want compromised at %s for leaked", metadata, cutoff)
+	}
+	keyID := metadata.KeyID
+
+	// Until the key is replaced every token is rejected
+	if err := manager.CheckKeyCompromise(keyID, cutoff.Add(time.Hour)); !errors.Is(err, ErrKeyCompromised) {
+		t.Errorf("before rotation: CheckKeyCompromise error = %v, want ErrKeyCompromised", err)
+	}
+	if _, err := manager.GetSigner("alice"); !errors.Is(err, ErrKeyCompromised) {
+		t.Errorf("GetSigner error = %v, want ErrKeyCompromised", err)
+	}
+
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+
+	// iat has second precision, so the cut-off's second is the first accepted one
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		wantErr  bool
+	}{
+		{"second before cut-off", cutoff.Truncate(time.Second).Add(-time.Second), true},
+		{"no iat", time.Time{}, true},
+		{"cut-off second", cutoff.Truncate(time.Second), false},
+		{"after cut-off", cutoff.Add(time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := manager.CheckKeyCompromise(keyID, tt.issuedAt)
+			if tt.wantErr != errors.Is(err, ErrKeyCompromised) {
+				t.Errorf("CheckKeyCompromise(%s) error = %v, want rejected %t", tt.issuedAt, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMarkKeyCompromisedRejectsFutureCutoff(t *testing.T) {
+	clock := newTestClock()
+	manager := newTestManager(t, clock)
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+
+	if _, err := manager.MarkKeyCompromised("alice", "leaked", clock.Now().Add(time.Second)); !errors.Is(err, ErrCompromiseInFuture) {
+		t.Fatalf("MarkKeyCompromised error = %v, want ErrCompromiseInFuture", err)
+	}
+	if _, err := manager.GetSigner("alice"); err != nil {
+		t.Errorf("key was changed by a rejected compromise: %v", err)
+	}
+}
+
+func TestMarkKeyCompromisedDefaultsToNow(t *testing.T) {
+	clock := newTestClock()
+	manager := newTestManager(t, clock)
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+
+	metadata, err := manager.MarkKeyCompromised("alice", "leaked", time.Time{})
+	if err != nil {
+		t.Fatalf("MarkKeyCompromised: %v", err)
+	}
+	if !metadata.CompromisedAt.Equal(clock.Now()) {
+		t.Errorf("CompromisedAt = %s, want %s", metadata.CompromisedAt, clock.Now())
+	}
+}
+
+func TestCompromiseSurvivesStorage(t *testing.T) {
+	clock := newTestClock()
+	manager := newTestManager(t, clock)
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+	metadata, err := manager.MarkKeyCompromised("alice", "leaked", time.Time{})
+	if err != nil {
+		t.Fatalf("MarkKeyCompromised: %v", err)
+	}
+
+	stored, err := manager.GetJwkSetForStorage()
+	if err != nil {
+		t.Fatalf("GetJwkSetForStorage: %v", err)
+	}
+	restored := newTestManager(t, clock)
+	if err := restored.GetJwkSetFromStorage(string(stored)); err != nil {
+		t.Fatalf("GetJwkSetFromStorage: %v", err)
+	}
+
+	if err := restored.CheckKeyCompromise(metadata.KeyID, clock.Now()); !errors.Is(err, ErrKeyCompromised) {
+		t.Errorf("CheckKeyCompromise error = %v, want ErrKeyCompromised", err)
+	}
+	got, err := restored.GetKeyMetadata("alice")
+	if err != nil {
+		t.Fatalf("GetKeyMetadata: %v", err)
+	}
+	if got.State != KeyStateCompromised {
+		t.Errorf("restored state = %s, want %s", got.State, KeyStateCompromised)
+	}
+}
@@ -2,6 +2,9 @@ package core
 
 import "time"
 
+// DefaultMaxTokenLength is the longest token accepted for verification by default
+const DefaultMaxTokenLength = 8 * 1024
+
 type Config struct {
 	TokenExpiry        time.Duration
 	RefreshTokenExpiry time.Duration
@@ -10,6 +13,47 @@ type Config struct {
 	MaxCacheSize       int
 	CleanupInterval    time.Duration
 	EnableMetrics      bool
+	// Pre-generated key pool watermarks; a high watermark of 0 disables the pool
+	KeyPoolLowWatermark  int
+	KeyPoolHighWatermark int
+	// Key policy applied to generated and imported keys
+	AllowedAlgorithms []string
+	MinRSAKeySize     int
+	// Clock is the source of time for token timestamps, expiry checks,
+	// key metadata and cleanup
+	Clock Clock
+	// Tokens longer than this are rejected before parsing
+	MaxTokenLength int
+	// How long an authorization code can be exchanged for tokens
+	AuthorizationCodeTTL time.Duration
+	// Issuer identifies this server in ID tokens and OpenID Connect discovery
+	Issuer string
+}
+
+// Now returns the current time according to the configured clock
+func (c *Config) Now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+// TokenLengthLimit returns MaxTokenLength, or DefaultMaxTokenLength when it
+// is not set, as in a Config built without NewConfigBuilder
+func (c *Config) TokenLengthLimit() int {
+	if c.MaxTokenLength <= 0 {
+		return DefaultMaxTokenLength
+	}
+	return c.MaxTokenLength
+}
+
+// SignatureAlgorithms returns AllowedAlgorithms, or DefaultAllowedAlgorithms
+// when it is empty
+func (c *Config) SignatureAlgorithms() []string {
+	if len(c.AllowedAlgorithms) == 0 {
+		return DefaultAllowedAlgorithms
+	}
+	return c.AllowedAlgorithms
 }
 
 // ConfigBuilder provides a fluent interface for building Config
@@ -21,13 +65,18 @@ type ConfigBuilder struct {
 func NewConfigBuilder() *ConfigBuilder {
 	return &ConfigBuilder{
 		config: &Config{
-			TokenExpiry:        24 * time.Hour,
-			RefreshTokenExpiry: 7 * 24 * time.Hour,
-			KeySize:            2048,
-			Algorithm:          "RS256",
-			MaxCacheSize:       100,
-			CleanupInterval:    time.Hour,
-			EnableMetrics:      false,
+			TokenExpiry:          24 * time.Hour,
+			RefreshTokenExpiry:   7 * 24 * time.Hour,
+			KeySize:              2048,
+			Algorithm:            "RS256",
+			MaxCacheSize:         100,
+			CleanupInterval:      time.Hour,
+			EnableMetrics:        false,
+			AllowedAlgorithms:    append([]string(nil), DefaultAllowedAlgorithms...),
+			MinRSAKeySize:        2048,
+			Clock:                SystemClock(),
+			MaxTokenLength:       DefaultMaxTokenLength,
+			AuthorizationCodeTTL: time.Minute,
 		},
 	}
 }
@@ -63,6 +112,46 @@ func (cb *ConfigBuilder) WithCacheSettings(maxSize int, cleanupInterval time.Dur
 	return cb
 }
 
+// WithKeyPool configures the pre-generated key pool watermarks
+func (cb *ConfigBuilder) WithKeyPool(lowWatermark, highWatermark int) *ConfigBuilder {
+	cb.config.KeyPoolLowWatermark = lowWatermark
+	cb.config.KeyPoolHighWatermark = highWatermark
+	return cb
+}
+
+// WithKeyPolicy sets the minimum RSA key size and the allowed signing algorithms
+func (cb *ConfigBuilder) WithKeyPolicy(minRSAKeySize int, allowedAlgorithms ...string) *ConfigBuilder {
+	cb.config.MinRSAKeySize = minRSAKeySize
+	if len(allowedAlgorithms) > 0 {
+		cb.config.AllowedAlgorithms = allowedAlgorithms
+	}
+	return cb
+}
+
+// WithClock sets the clock used for all time-dependent behaviour
+func (cb *ConfigBuilder) WithClock(clock Clock) *ConfigBuilder {
+	cb.config.Clock = clock
+	return cb
+}
+
+// WithMaxTokenLength sets the longest token accepted for verification
+func (cb *ConfigBuilder) WithMaxTokenLength(length int) *ConfigBuilder {
+	cb.config.MaxTokenLength = length
+	return cb
+}
+
+// WithAuthorizationCodeTTL sets how long authorization codes stay valid
+func (cb *ConfigBuilder) WithAuthorizationCodeTTL(ttl time.Duration) *ConfigBuilder {
+	cb.config.AuthorizationCodeTTL = ttl
+	return cb
+}
+
+// WithIssuer sets the issuer identifier, an https URL with no query or fragment
+func (cb *ConfigBuilder) WithIssuer(issuer string) *ConfigBuilder {
+	cb.config.Issuer = issuer
+	return cb
+}
+
 // WithMetrics enables or disables metrics collection
 func (cb *ConfigBuilder) WithMetrics(enabled bool) *ConfigBuilder {
 	cb.config.EnableMetrics = enabled
@@ -81,6 +170,30 @@ func (cb *ConfigBuilder) Build() *Config {
 	if cb.config.KeySize < 2048 {
 		cb.config.KeySize = 2048
 	}
+	if cb.config.MinRSAKeySize < 2048 {
+		cb.config.MinRSAKeySize = 2048
+	}
+	if cb.config.KeySize < cb.config.MinRSAKeySize {
+		cb.config.KeySize = cb.config.MinRSAKeySize
+	}
+	if len(cb.config.AllowedAlgorithms) == 0 {
+		cb.config.AllowedAlgorithms = append([]string(nil), DefaultAllowedAlgorithms...)
+	}
+	if cb.config.Clock == nil {
+		cb.config.Clock = SystemClock()
+	}
+	if cb.config.MaxTokenLength <= 0 {
+		cb.config.MaxTokenLength = DefaultMaxTokenLength
+	}
+	if cb.config.AuthorizationCodeTTL <= 0 {
+		cb.config.AuthorizationCodeTTL = time.Minute
+	}
+	if cb.config.KeyPoolLowWatermark < 0 {
+		cb.config.KeyPoolLowWatermark = 0
+	}
+	if cb.config.KeyPoolHighWatermark < cb.config.KeyPoolLowWatermark {
+		cb.config.KeyPoolHighWatermark = cb.config.KeyPoolLowWatermark
+	}
 
 	return cb.config
 }
@@ -97,6 +210,7 @@ func ProductionConfig() *Config {
 		WithRefreshTokenExpiry(30*24*time.Hour).
 		WithKeySize(4096).
 		WithCacheSettings(1000, 30*time.Minute).
+		WithKeyPool(4, 16).
 		WithMetrics(true).
 		Build()
 }
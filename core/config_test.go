@@ -0,0 +1,24 @@
+package core
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConfigVerificationDefaults(t *testing.T) {
+	var config Config
+	if got := config.TokenLengthLimit(); got != DefaultMaxTokenLength {
+		t.Errorf("TokenLengthLimit() = %d, want %d", got, DefaultMaxTokenLength)
+	}
+	if got := config.SignatureAlgorithms(); !slices.Equal(got, DefaultAllowedAlgorithms) {
+		t.Errorf("SignatureAlgorithms() = %v, want %v", got, DefaultAllowedAlgorithms)
+	}
+
+	config = Config{MaxTokenLength: 512, AllowedAlgorithms: []string{"EdDSA"}}
+	if got := config.TokenLengthLimit(); got != 512 {
+		t.Errorf("TokenLengthLimit() = %d, want 512", got)
+	}
+	if got := config.SignatureAlgorithms(); !slices.Equal(got, []string{"EdDSA"}) {
+		t.Errorf("SignatureAlgorithms() = %v, want [EdDSA]", got)
+	}
+}
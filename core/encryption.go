@@ -0,0 +1,424 @@
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// DefaultJWKSRefreshInterval is how long a fetched remote JWKS is used before
+// it is fetched again
+const DefaultJWKSRefreshInterval = time.Hour
+
+// maxJWKSSize limits the size of a fetched JWKS document
+const maxJWKSSize = 1 << 20
+
+// EncryptionKey is a public key tokens are encrypted to
+type EncryptionKey struct {
+	KeyID     string
+	Algorithm jwa.KeyEncryptionAlgorithm
+	PublicKey crypto.PublicKey
+}
+
+// EncryptionKeySource supplies the recipient key for encrypted tokens
+type EncryptionKeySource interface {
+	// EncryptionKey returns the key new tokens are encrypted to, or
+	// ErrEncryptionKeyMissing if there is none
+	EncryptionKey(ctx context.Context) (*EncryptionKey, error)
+}
+
+// DecryptionKeySource resolves the private keys of encrypted tokens
+type DecryptionKeySource interface {
+	// DecryptionKey returns the private key with keyID and the algorithm it
+	// is used with, or ErrKeyNotFound
+	DecryptionKey(ctx context.Context, keyID string) (crypto.PrivateKey, jwa.KeyEncryptionAlgorithm, error)
+}
+
+// lookupEncryptionAlgorithm resolves a supported key management algorithm:
+// RSA-OAEP-256 or ECDH-ES
+func lookupEncryptionAlgorithm(name string) (jwa.KeyEncryptionAlgorithm, error) {
+	alg, ok := jwa.LookupKeyEncryptionAlgorithm(name)
+	if !ok || (alg != jwa.RSA_OAEP_256() && alg != jwa.ECDH_ES()) {
+		return jwa.EmptyKeyEncryptionAlgorithm(), fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, name)
+	}
+	return alg, nil
+}
+
+// defaultEncryptionAlgorithmFor returns the key management algorithm for a key type
+func defaultEncryptionAlgorithmFor(publicKey crypto.PublicKey) (jwa.KeyEncryptionAlgorithm, error) {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwa.RSA_OAEP_256(), nil
+	case *ecdsa.PublicKey:
+		return jwa.ECDH_ES(), nil
+	}
+	return jwa.EmptyKeyEncryptionAlgorithm(), fmt.Errorf("%w: %T", ErrUnsupportedKeyType, publicKey)
+}
+
+// checkEncryptionKey verifies that publicKey can be used with alg under the
+// config's key policy
+func (c *Config) checkEncryptionKey(alg jwa.KeyEncryptionAlgorithm, publicKey crypto.PublicKey) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if alg != jwa.RSA_OAEP_256() {
+			break
+		}
+		if key.N.BitLen() < c.MinRSAKeySize {
+			return fmt.Errorf("%w: RSA key of %d bits is below the minimum of %d", ErrKeyPolicyViolation, key.N.BitLen(), c.MinRSAKeySize)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg == jwa.ECDH_ES() {
+			return nil
+		}
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedKeyType, publicKey)
+	}
+	return fmt.Errorf("%w: %s cannot be used with %T", ErrAlgorithmMismatch, alg, publicKey)
+}
+
+// EncryptionKeyring manages the key pairs tokens are encrypted to. The
+// newest key encrypts new tokens; older keys keep decrypting tokens issued
+// before a rotation until they are removed.
+type EncryptionKeyring interface {
+	EncryptionKeySource
+	DecryptionKeySource
+	// Rotate generates a key pair for alg and makes it the current key
+	Rotate(ctx context.Context, alg jwa.KeyEncryptionAlgorithm) (string, error)
+	// ImportKey adds a private JWK, for example one shared by several
+	// instances, and makes it the current key
+	ImportKey(ctx context.Context, jwkJSON []byte) (string, error)
+	// RemoveKey stops decrypting tokens encrypted to keyID
+	RemoveKey(ctx context.Context, keyID string) error
+	// PublicJwkSet serializes the public keys as a JWKS document for publishing
+	PublicJwkSet(ctx context.Context) ([]byte, error)
+}
+
+// encryptionKeyEntry is a key pair held by an encryptionKeyring
+type encryptionKeyEntry struct {
+	privateKey crypto.Signer
+	algorithm  jwa.KeyEncryptionAlgorithm
+}
+
+type encryptionKeyring struct {
+	config  *Config
+	mutex   sync.RWMutex
+	keys    map[string]*encryptionKeyEntry
+	current string
+}
+
+// NewEncryptionKeyring creates an empty keyring; call Rotate or ImportKey
+// before encrypting tokens
+func NewEncryptionKeyring(config *Config) EncryptionKeyring {
+	return &encryptionKeyring{
+		config: config,
+		keys:   make(map[string]*encryptionKeyEntry),
+	}
+}
+
+func (k *encryptionKeyring) Rotate(ctx context.Context, alg jwa.KeyEncryptionAlgorithm) (string, error) {
+	if _, err := lookupEncryptionAlgorithm(alg.String()); err != nil {
+		return "", NewAuthError("RotateEncryptionKey", err)
+	}
+
+	var privateKey crypto.Signer
+	var err error
+	if alg == jwa.RSA_OAEP_256() {
+		privateKey, err = rsa.GenerateKey(rand.Reader, max(k.config.KeySize, k.config.MinRSAKeySize))
+	} else {
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return "", NewAuthError("RotateEncryptionKey", fmt.Errorf("failed to generate encryption key: %w", err))
+	}
+	if err := ctx.Err(); err != nil {
+		return "", NewAuthError("RotateEncryptionKey", err)
+	}
+
+	keyID, err := k.add("", privateKey, alg)
+	if err != nil {
+		return "", NewAuthError("RotateEncryptionKey", err)
+	}
+	return keyID, nil
+}
+
+func (k *encryptionKeyring) ImportKey(ctx context.Context, jwkJSON []byte) (string, error) {
+	key, err := jwk.ParseKey(jwkJSON)
+	if err != nil {
+		return "", NewAuthError("ImportEncryptionKey", fmt.Errorf("%w: %v", ErrInvalidKeyData, err))
+	}
+	if private, err := jwk.IsPrivateKey(key); err != nil || !private {
+		return "", NewAuthError("ImportEncryptionKey", fmt.Errorf("%w: encryption key must be a private key", ErrInvalidKeyData))
+	}
+
+	var raw any
+	if err := jwk.Export(key, &raw); err != nil {
+		return "", NewAuthError("ImportEncryptionKey", fmt.Errorf("%w: %v", ErrInvalidKeyData, err))
+	}
+	privateKey, ok := raw.(crypto.Signer)
+	if !ok {
+		return "", NewAuthError("ImportEncryptionKey", fmt.Errorf("%w: %T", ErrUnsupportedKeyType, raw))
+	}
+
+	var alg jwa.KeyEncryptionAlgorithm
+	if keyAlg, ok := key.Algorithm(); ok {
+		alg, err = lookupEncryptionAlgorithm(keyAlg.String())
+	} else {
+		alg, err = defaultEncryptionAlgorithmFor(privateKey.Public())
+	}
+	if err != nil {
+		return "", NewAuthError("ImportEncryptionKey", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", NewAuthError("ImportEncryptionKey", err)
+	}
+
+	keyID, _ := key.KeyID()
+	keyID, err = k.add(keyID, privateKey, alg)
+	if err != nil {
+		return "", NewAuthError("ImportEncryptionKey", err)
+	}
+	return keyID, nil
+}
+
+// add stores a key pair as the current key. Keys without an ID are named
+// by their RFC 7638 thumbprint.
+func (k *encryptionKeyring) add(keyID string, privateKey crypto.Signer, alg jwa.KeyEncryptionAlgorithm) (string, error) {
+	if err := k.config.checkEncryptionKey(alg, privateKey.Public()); err != nil {
+		return "", err
+	}
+	if keyID == "" {
+		publicKey, err := jwk.Import(privateKey.Public())
+		if err != nil {
+			return "", fmt.Errorf("failed to import public key: %w", err)
+		}
+		thumbprint, err := publicKey.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return "", fmt.Errorf("failed to compute key thumbprint: %w", err)
+		}
+		keyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.keys[keyID] = &encryptionKeyEntry{privateKey: privateKey, algorithm: alg}
+	k.current = keyID
+	return keyID, nil
+}
+
+func (k *encryptionKeyring) RemoveKey(ctx context.Context, keyID string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, exists := k.keys[keyID]; !exists {
+		return NewAuthError("RemoveEncryptionKey", fmt.Errorf("%w: %s", ErrKeyNotFound, keyID))
+	}
+	delete(k.keys, keyID)
+	if k.current == keyID {
+		k.current = ""
+	}
+	return nil
+}
+
+func (k *encryptionKeyring) EncryptionKey(ctx context.Context) (*EncryptionKey, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	entry, exists := k.keys[k.current]
+	if !exists {
+		return nil, ErrEncryptionKeyMissing
+	}
+	return &EncryptionKey{KeyID: k.current, Algorithm: entry.algorithm, PublicKey: entry.privateKey.Public()}, nil
+}
+
+func (k *encryptionKeyring) DecryptionKey(ctx context.Context, keyID string) (crypto.PrivateKey, jwa.KeyEncryptionAlgorithm, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	entry, exists := k.keys[keyID]
+	if !exists {
+		return nil, jwa.EmptyKeyEncryptionAlgorithm(), fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	return entry.privateKey, entry.algorithm, nil
+}
+
+func (k *encryptionKeyring) PublicJwkSet(ctx context.Context) ([]byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	keyIDs := make([]string, 0, len(k.keys))
+	for keyID := range k.keys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+
+	set := jwk.NewSet()
+	for _, keyID := range keyIDs {
+		entry := k.keys[keyID]
+		key, err := jwk.Import(entry.privateKey.Public())
+		if err != nil {
+			return nil, NewAuthError("PublicJwkSet", fmt.Errorf("failed to import public key %s: %w", keyID, err))
+		}
+		for name, value := range map[string]any{
+			jwk.KeyIDKey:     keyID,
+			jwk.AlgorithmKey: entry.algorithm,
+			jwk.KeyUsageKey:  jwk.ForEncryption,
+		} {
+			if err := key.Set(name, value); err != nil {
+				return nil, NewAuthError("PublicJwkSet", fmt.Errorf("failed to set %s on key %s: %w", name, keyID, err))
+			}
+		}
+		if err := set.AddKey(key); err != nil {
+			return nil, NewAuthError("PublicJwkSet", fmt.Errorf("failed to add key to set: %w", err))
+		}
+	}
+
+	publicJSON, err := json.Marshal(set)
+	if err != nil {
+		return nil, NewAuthError("PublicJwkSet", err)
+	}
+	return publicJSON, nil
+}
+
+// remoteEncryptionKeys encrypts to a key published by another party
+type remoteEncryptionKeys struct {
+	config   *Config
+	url      string
+	client   *http.Client
+	refresh  time.Duration
+	mutex    sync.Mutex
+	key      *EncryptionKey
+	cachedAt time.Time
+}
+
+// RemoteKeyOption configures a remote encryption key source
+type RemoteKeyOption func(*remoteEncryptionKeys)
+
+// WithJWKSHTTPClient sets the client used to fetch the JWKS
+func WithJWKSHTTPClient(client *http.Client) RemoteKeyOption {
+	return func(r *remoteEncryptionKeys) {
+		r.client = client
+	}
+}
+
+// WithJWKSRefreshInterval sets how long a fetched JWKS is used before it is fetched again
+func WithJWKSRefreshInterval(refresh time.Duration) RemoteKeyOption {
+	return func(r *remoteEncryptionKeys) {
+		r.refresh = refresh
+	}
+}
+
+// NewRemoteEncryptionKeys creates an EncryptionKeySource that encrypts to
+// the first encryption key of the JWKS at jwksURL, typically published by
+// the resource server that decrypts the tokens. If a refresh fails, the
+// previously fetched key is used until a fetch succeeds.
+func NewRemoteEncryptionKeys(config *Config, jwksURL string, opts ...RemoteKeyOption) EncryptionKeySource {
+	r := &remoteEncryptionKeys{
+		config:  config,
+		url:     jwksURL,
+		client:  http.DefaultClient,
+		refresh: DefaultJWKSRefreshInterval,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *remoteEncryptionKeys) EncryptionKey(ctx context.Context) (*EncryptionKey, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.config.Now()
+	if r.key != nil && now.Sub(r.cachedAt) < r.refresh {
+		return r.key, nil
+	}
+
+	key, err := r.fetch(ctx)
+	if err != nil {
+		if r.key != nil {
+			return r.key, nil
+		}
+		return nil, err
+	}
+	r.key, r.cachedAt = key, now
+	return key, nil
+}
+
+// fetch downloads the JWKS and selects the first usable encryption key
+func (r *remoteEncryptionKeys) fetch(ctx context.Context) (*EncryptionKey, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	response, err := r.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS from %s: %w", r.url, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS from %s: status %d", r.url, response.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxJWKSSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS from %s: %w", r.url, err)
+	}
+
+	set, err := jwk.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeyData, err)
+	}
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Key(i)
+		if key == nil {
+			continue
+		}
+		if use, ok := key.KeyUsage(); ok && use != string(jwk.ForEncryption) {
+			continue
+		}
+		if encryptionKey, err := r.encryptionKeyOf(key); err == nil {
+			return encryptionKey, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: JWKS at %s has no usable encryption key", ErrEncryptionKeyMissing, r.url)
+}
+
+// encryptionKeyOf converts a published JWK, checking it against the key policy
+func (r *remoteEncryptionKeys) encryptionKeyOf(key jwk.Key) (*EncryptionKey, error) {
+	publicJWK, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		return nil, err
+	}
+	var publicKey any
+	if err := jwk.Export(publicJWK, &publicKey); err != nil {
+		return nil, err
+	}
+
+	var alg jwa.KeyEncryptionAlgorithm
+	if keyAlg, ok := key.Algorithm(); ok {
+		alg, err = lookupEncryptionAlgorithm(keyAlg.String())
+	} else {
+		alg, err = defaultEncryptionAlgorithmFor(publicKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.config.checkEncryptionKey(alg, publicKey); err != nil {
+		return nil, err
+	}
+
+	keyID, _ := key.KeyID()
+	return &EncryptionKey{KeyID: keyID, Algorithm: alg, PublicKey: publicKey}, nil
+}
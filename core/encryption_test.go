@@ -0,0 +1,199 @@
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+func TestEncryptionKeyringRotation(t *testing.T) {
+	ctx := context.Background()
+	keyring := NewEncryptionKeyring(testConfig(newTestClock()))
+	if _, err := keyring.EncryptionKey(ctx); !errors.Is(err, ErrEncryptionKeyMissing) {
+		t.Fatalf("EncryptionKey on an empty keyring error = %v, want ErrEncryptionKeyMissing", err)
+	}
+
+	first, err := keyring.Rotate(ctx, jwa.ECDH_ES())
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	second, err := keyring.Rotate(ctx, jwa.ECDH_ES())
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	current, err := keyring.EncryptionKey(ctx)
+	if err != nil {
+		t.Fatalf("EncryptionKey: %v", err)
+	}
+	if current.KeyID != second || current.Algorithm != jwa.ECDH_ES() {
+		t.Errorf("current key = %s with %s, want %s with ECDH-ES", current.KeyID, current.Algorithm, second)
+	}
+
+	// The previous key still decrypts until it is removed
+	if _, alg, err := keyring.DecryptionKey(ctx, first); err != nil || alg != jwa.ECDH_ES() {
+		t.Errorf("DecryptionKey(previous) = %s, %v", alg, err)
+	}
+	if err := keyring.RemoveKey(ctx, first); err != nil {
+		t.Fatalf("RemoveKey: %v", err)
+	}
+	if _, _, err := keyring.DecryptionKey(ctx, first); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("DecryptionKey(removed) error = %v, want ErrKeyNotFound", err)
+	}
+	if err := keyring.RemoveKey(ctx, first); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("RemoveKey(removed) error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestEncryptionKeyringRejectsSigningAlgorithm(t *testing.T) {
+	keyring := NewEncryptionKeyring(testConfig(newTestClock()))
+	if _, err := keyring.Rotate(context.Background(), jwa.A128KW()); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("Rotate(A128KW) error = %v, want ErrUnsupportedAlgorithm", err)
+	}
+}
+
+func TestEncryptionKeyringImportKey(t *testing.T) {
+	ctx := context.Background()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	key, err := jwk.Import(privateKey)
+	if err != nil {
+		t.Fatalf("jwk.Import: %v", err)
+	}
+	if err := key.Set(jwk.KeyIDKey, "shared"); err != nil {
+		t.Fatalf("set kid: %v", err)
+	}
+	privateJSON, err := json.Marshal(key)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	keyring := NewEncryptionKeyring(testConfig(newTestClock()))
+	keyID, err := keyring.ImportKey(ctx, privateJSON)
+	if err != nil || keyID != "shared" {
+		t.Fatalf("ImportKey = %q, %v, want shared", keyID, err)
+	}
+
+	// Public keys alone cannot decrypt
+	publicKey, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		t.Fatalf("PublicKeyOf: %v", err)
+	}
+	publicJSON, err := json.Marshal(publicKey)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := keyring.ImportKey(ctx, publicJSON); !errors.Is(err, ErrInvalidKeyData) {
+		t.Errorf("ImportKey(public) error = %v, want ErrInvalidKeyData", err)
+	}
+}
+
+func TestEncryptionKeyringPublicJwkSet(t *testing.T) {
+	ctx := context.Background()
+	keyring := NewEncryptionKeyring(testConfig(newTestClock()))
+	keyID, err := keyring.Rotate(ctx, jwa.ECDH_ES())
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	published, err := keyring.PublicJwkSet(ctx)
+	if err != nil {
+		t.Fatalf("PublicJwkSet: %v", err)
+	}
+	set, err := jwk.Parse(published)
+	if err != nil {
+		t.Fatalf("jwk.Parse: %v", err)
+	}
+	key, found := set.LookupKeyID(keyID)
+	if !found || set.Len() != 1 {
+		t.Fatalf("published set has %d keys, want only %s", set.Len(), keyID)
+	}
+	if private, _ := jwk.IsPrivateKey(key); private {
+		t.Error("published set contains a private key")
+	}
+	if use, _ := key.KeyUsage(); use != string(jwk.ForEncryption) {
+		t.Errorf("published key use = %q, want enc", use)
+	}
+}
+
+// serveJWKS serves the public set of keyring, counting the requests
+func serveJWKS(t *testing.T, keyring EncryptionKeyring, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		published, err := keyring.PublicJwkSet(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(published)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRemoteEncryptionKeysCacheAndFallback(t *testing.T) {
+	ctx := context.Background()
+	clock := newTestClock()
+	config := testConfig(clock)
+	keyring := NewEncryptionKeyring(config)
+	keyID, err := keyring.Rotate(ctx, jwa.ECDH_ES())
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	var requests atomic.Int32
+	server := serveJWKS(t, keyring, &requests)
+
+	remote := NewRemoteEncryptionKeys(config, server.URL, WithJWKSHTTPClient(server.Client()), WithJWKSRefreshInterval(time.Minute))
+	for range 3 {
+		key, err := remote.EncryptionKey(ctx)
+		if err != nil {
+			t.Fatalf("EncryptionKey: %v", err)
+		}
+		if key.KeyID != keyID || key.Algorithm != jwa.ECDH_ES() {
+			t.Errorf("remote key = %s with %s, want %s with ECDH-ES", key.KeyID, key.Algorithm, keyID)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times within the refresh interval, want 1", got)
+	}
+
+	// After the interval the set is fetched again; if that fails the
+	// cached key is kept
+	server.Close()
+	clock.Advance(2 * time.Minute)
+	key, err := remote.EncryptionKey(ctx)
+	if err != nil || key.KeyID != keyID {
+		t.Errorf("EncryptionKey with the JWKS unreachable = %+v, %v, want the cached key", key, err)
+	}
+}
+
+func TestRemoteEncryptionKeysSkipSigningKeys(t *testing.T) {
+	signing := newTestManager(t, newTestClock())
+	if err := signing.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		published, _ := signing.GetPublicJwkSet()
+		_, _ = w.Write(published)
+	}))
+	defer server.Close()
+
+	remote := NewRemoteEncryptionKeys(testConfig(newTestClock()), server.URL, WithJWKSHTTPClient(server.Client()))
+	if _, err := remote.EncryptionKey(context.Background()); !errors.Is(err, ErrEncryptionKeyMissing) {
+		t.Errorf("EncryptionKey from a signing JWKS error = %v, want ErrEncryptionKeyMissing", err)
+	}
+}
@@ -15,6 +15,58 @@ var (
 	ErrInvalidTokenFormat   = errors.New("invalid token format")
 	ErrMissingKidClaim      = errors.New("token missing required 'kid' claim")
 	ErrInvalidKidClaim      = errors.New("'kid' claim must be a non-empty string")
+	ErrInvalidStorageFormat = errors.New("invalid JWK set storage format")
+	ErrUnsupportedStorage   = errors.New("unsupported JWK set storage version")
+	ErrUnsupportedKeyType   = errors.New("unsupported key type")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrAlgorithmMismatch    = errors.New("key does not match signing algorithm")
+	ErrKeyPolicyViolation   = errors.New("key violates key policy")
+	ErrInvalidKeyData       = errors.New("invalid key data")
+	ErrExternalSigner       = errors.New("key is held by an external signer")
+	ErrKeyCompromised       = errors.New("signing key has been marked compromised")
+	ErrCompromiseInFuture   = errors.New("compromise cut-off is in the future")
+	ErrKeySetNotStored      = errors.New("no JWK set has been stored")
+	ErrTokenRevoked         = errors.New("token has been revoked")
+	ErrInvalidSignature     = errors.New("token signature is invalid")
+	ErrTokenNotYetValid     = errors.New("token is not valid yet")
+	ErrTokenTooLarge        = errors.New("token exceeds maximum length")
+	ErrTokenNotFound        = errors.New("token not found")
+	ErrTokenNotOwned        = errors.New("token was not issued to this client")
+	ErrClientNotFound       = errors.New("client not found")
+	ErrCodeNotFound         = errors.New("authorization code not found")
+	ErrInvalidClaim         = errors.New("token claim is invalid")
+	ErrAudienceNotAllowed   = errors.New("audience is not allowed")
+	ErrScopeNotAllowed      = errors.New("requested scope is not allowed")
+	ErrInvalidDPoPProof     = errors.New("DPoP proof is invalid")
+	ErrDPoPProofReplayed    = errors.New("DPoP proof has already been used")
+	ErrTokenBindingMismatch = errors.New("token is bound to a different key")
+	ErrEncryptionKeyMissing = errors.New("no encryption key available")
+	ErrDecryptionFailed     = errors.New("token could not be decrypted")
+	ErrPermissionDenied     = errors.New("permission denied")
+	ErrInvalidRolePolicy    = errors.New("invalid role policy")
+)
+
+// ValidationCode is a machine-readable reason for a token validation failure
+type ValidationCode string
+
+const (
+	ValidationCodeMalformed           ValidationCode = "malformed_token"
+	ValidationCodeTokenTooLarge       ValidationCode = "token_too_large"
+	ValidationCodeMissingKid          ValidationCode = "missing_kid"
+	ValidationCodeInvalidKid          ValidationCode = "invalid_kid"
+	ValidationCodeUnknownKey          ValidationCode = "unknown_key"
+	ValidationCodeKeyCompromised      ValidationCode = "key_compromised"
+	ValidationCodeAlgorithm           ValidationCode = "disallowed_algorithm"
+	ValidationCodeInvalidSignature    ValidationCode = "invalid_signature"
+	ValidationCodeExpired             ValidationCode = "token_expired"
+	ValidationCodeNotYetValid         ValidationCode = "token_not_yet_valid"
+	ValidationCodeInvalidClaim        ValidationCode = "invalid_claim"
+	ValidationCodeWrongPurpose        ValidationCode = "wrong_purpose"
+	ValidationCodeRevoked             ValidationCode = "token_revoked"
+	ValidationCodeUnknownToken        ValidationCode = "unknown_token"
+	ValidationCodeInvalidDPoPProof    ValidationCode = "invalid_dpop_proof"
+	ValidationCodeCertificateMismatch ValidationCode = "certificate_mismatch"
+	ValidationCodeDecryptionFailed    ValidationCode = "decryption_failed"
 )
 
 // AuthError wraps errors with additional context
@@ -35,3 +87,32 @@ func (e *AuthError) Unwrap() error {
 func NewAuthError(op string, err error) *AuthError {
 	return &AuthError{Op: op, Err: err}
 }
+
+// ValidationError describes why a token was rejected. Err wraps one of the
+// sentinel errors above, so errors.Is keeps working alongside errors.As.
+type ValidationError struct {
+	Code  ValidationCode // machine-readable reason
+	Claim string         // claim that failed validation, if any
+	KeyID string         // kid of the token, if known
+	Err   error          // underlying error
+}
+
+func (e *ValidationError) Error() string {
+	msg := "token validation failed: " + string(e.Code)
+	if e.Claim != "" {
+		msg += " (claim " + e.Claim + ")"
+	}
+	if e.KeyID != "" {
+		msg += " (kid " + e.KeyID + ")"
+	}
+	return fmt.Sprintf("%s: %v", msg, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// NewValidationError creates a new ValidationError
+func NewValidationError(code ValidationCode, claim string, keyID string, err error) *ValidationError {
+	return &ValidationError{Code: code, Claim: claim, KeyID: keyID, Err: err}
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidationErrorWrapsSentinel(t *testing.T) {
+	err := error(NewAuthError("ValidateToken", NewValidationError(ValidationCodeExpired, "exp", "key-alice", ErrTokenExpired)))
+
+	if !errors.Is(err, ErrTokenExpired) {
+		t.Error("errors.Is does not reach the sentinel")
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatal("errors.As does not find the ValidationError")
+	}
+	if validationErr.Code != ValidationCodeExpired || validationErr.Claim != "exp" || validationErr.KeyID != "key-alice" {
+		t.Errorf("ValidationError = %+v, want code, claim and kid preserved", validationErr)
+	}
+
+	want := "auth: ValidateToken: token validation failed: token_expired (claim exp) (kid key-alice): token has expired"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestValidationErrorMessageOmitsEmptyFields(t *testing.T) {
+	err := NewValidationError(ValidationCodeMalformed, "", "", ErrInvalidTokenFormat)
+	want := "token validation failed: malformed_token: invalid token format"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -1,27 +1,68 @@
 package core
 
 import (
-	"crypto/rand"
+	"context"
+	"crypto"
 	"crypto/rsa"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/lestrrat-go/jwx/v3/jwk"
 )
 
 type JwkManager interface {
 	InitializeJwkSet(keyPrefix string) error
 	AddOrReplaceKeyToSet(keyPrefix string) error
+	// EnsureKey adds a key for keyPrefix only when it has none
+	EnsureKey(keyPrefix string) error
 	GetPrivateKeyWithId(keyPrefix string) (*rsa.PrivateKey, string, error)
 	GetJwkSetForStorage() ([]byte, error)
 	GetJwkSetFromStorage(jwkSetJSON string) error
 	GetPublicKeyBy(keyId string) (*rsa.PublicKey, error)
+	// Public verification keys as a JWKS document
+	GetPublicJwkSet() ([]byte, error)
 	// New methods for better performance and management
 	GetKeyCount() int
 	CleanupExpiredKeys() error
 	GetKeyMetadata(keyPrefix string) (*KeyMetadata, error)
+	// Algorithm-aware key access
+	GetSigningKey(keyPrefix string) (crypto.Signer, string, jwa.SignatureAlgorithm, error)
+	GetVerificationKey(keyId string) (crypto.PublicKey, jwa.SignatureAlgorithm, error)
+	// Single key import and export
+	ImportSigningKey(keyPrefix string, data []byte, format KeyFormat, algorithm string) error
+	ExportSigningKey(keyPrefix string, format KeyFormat) ([]byte, error)
+	// Signer access, including keys held outside the process
+	GetSigner(keyPrefix string) (Signer, error)
+	RegisterSigner(keyPrefix string, signer Signer) error
+	// Key compromise handling
+	MarkKeyCompromised(keyPrefix string, reason string, at time.Time) (*KeyMetadata, error)
+	CheckKeyCompromise(keyId string, issuedAt time.Time) error
+
+	// Context-aware variants; the methods above call these with context.Background()
+	InitializeJwkSetContext(ctx context.Context, keyPrefix string) error
+	AddOrReplaceKeyToSetContext(ctx context.Context, keyPrefix string) error
+	EnsureKeyContext(ctx context.Context, keyPrefix string) error
+	GetPrivateKeyWithIdContext(ctx context.Context, keyPrefix string) (*rsa.PrivateKey, string, error)
+	GetJwkSetForStorageContext(ctx context.Context) ([]byte, error)
+	GetJwkSetFromStorageContext(ctx context.Context, jwkSetJSON string) error
+	GetPublicKeyByContext(ctx context.Context, keyId string) (*rsa.PublicKey, error)
+	GetPublicJwkSetContext(ctx context.Context) ([]byte, error)
+	GetKeyCountContext(ctx context.Context) int
+	CleanupExpiredKeysContext(ctx context.Context) error
+	GetKeyMetadataContext(ctx context.Context, keyPrefix string) (*KeyMetadata, error)
+	GetSigningKeyContext(ctx context.Context, keyPrefix string) (crypto.Signer, string, jwa.SignatureAlgorithm, error)
+	GetVerificationKeyContext(ctx context.Context, keyId string) (crypto.PublicKey, jwa.SignatureAlgorithm, error)
+	ImportSigningKeyContext(ctx context.Context, keyPrefix string, data []byte, format KeyFormat, algorithm string) error
+	ExportSigningKeyContext(ctx context.Context, keyPrefix string, format KeyFormat) ([]byte, error)
+	GetSignerContext(ctx context.Context, keyPrefix string) (Signer, error)
+	RegisterSignerContext(ctx context.Context, keyPrefix string, signer Signer) error
+	MarkKeyCompromisedContext(ctx context.Context, keyPrefix string, reason string, at time.Time) (*KeyMetadata, error)
+	CheckKeyCompromiseContext(ctx context.Context, keyId string, issuedAt time.Time) error
 }
 
 type KeyMetadata struct {
@@ -29,258 +70,705 @@ type KeyMetadata struct {
 	CreatedAt time.Time `json:"created_at"`
 	Algorithm string    `json:"algorithm"`
 	KeySize   int       `json:"key_size"`
+	State     string    `json:"state"`
+	Owner     string    `json:"owner"`
+	External  bool      `json:"external,omitempty"`
+	// Set when the key has been marked compromised
+	CompromisedAt    *time.Time `json:"compromised_at,omitempty"`
+	CompromiseReason string     `json:"compromise_reason,omitempty"`
 }
 
 type jwkManager struct {
-	jwkSet    jwk.Set
-	mutex     sync.RWMutex
+	// mutex serializes writers; readers load the published snapshot lock-free
+	mutex     sync.Mutex
+	snapshot  atomic.Pointer[keySetSnapshot]
 	validator *Validator
 	config    *Config
-	// Cache for frequently accessed keys
-	keyCache map[string]*cachedKey
-	// Metadata for key management
-	keyMetadata map[string]*KeyMetadata
+	keySource KeySource
 }
 
-type cachedKey struct {
-	privateKey *rsa.PrivateKey
-	publicKey  *rsa.PublicKey
-	keyID      string
-	lastUsed   time.Time
+// JwkManagerOption configures optional JwkManager dependencies
+type JwkManagerOption func(*jwkManager)
+
+// WithKeySource sets where rotated keys come from, such as a KeyPool
+func WithKeySource(source KeySource) JwkManagerOption {
+	return func(j *jwkManager) {
+		j.keySource = source
+	}
 }
 
-func NewJwkManager(config *Config) JwkManager {
-	return &jwkManager{
-		validator:   NewValidator(),
-		config:      config,
-		keyCache:    make(map[string]*cachedKey),
-		keyMetadata: make(map[string]*KeyMetadata),
+func NewJwkManager(config *Config, opts ...JwkManagerOption) JwkManager {
+	j := &jwkManager{
+		validator: NewValidator(),
+		config:    config,
+		keySource: generatingKeySource{},
 	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
 }
 
 func (j *jwkManager) InitializeJwkSet(keyPrefix string) error {
+	return j.InitializeJwkSetContext(context.Background(), keyPrefix)
+}
+
+func (j *jwkManager) InitializeJwkSetContext(ctx context.Context, keyPrefix string) error {
 	if err := j.validator.ValidateKeyPrefix(keyPrefix); err != nil {
 		return NewAuthError("InitializeJwkSet", err)
 	}
 
+	prepared, err := j.generateKey(ctx, keyPrefix)
+	if err != nil {
+		return NewAuthError("InitializeJwkSet", err)
+	}
+
+	// Generation may have outlived the caller
+	if err := ctx.Err(); err != nil {
+		return NewAuthError("InitializeJwkSet", err)
+	}
+
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
 
-	// Generate a new key set with a single key
-	set := jwk.NewSet()
+	// Start a new key set with a single key
+	next := newKeySetSnapshot()
+	next.putKey(keyPrefix, prepared, j.config.Now())
+	if err := j.publishLocked(next); err != nil {
+		return NewAuthError("InitializeJwkSet", err)
+	}
+	return nil
+}
 
-	privateKey, err := rsa.GenerateKey(rand.Reader, j.config.KeySize)
-	if err != nil {
-		return NewAuthError("InitializeJwkSet", fmt.Errorf("failed to generate private key: %w", err))
+func (j *jwkManager) AddOrReplaceKeyToSet(keyPrefix string) error {
+	return j.AddOrReplaceKeyToSetContext(context.Background(), keyPrefix)
+}
+
+func (j *jwkManager) AddOrReplaceKeyToSetContext(ctx context.Context, keyPrefix string) error {
+	if err := j.validator.ValidateKeyPrefix(keyPrefix); err != nil {
+		return NewAuthError("AddOrReplaceKeyToSet", err)
 	}
 
-	key, err := jwk.Import(privateKey)
+	// Keys held by external signers are rotated in their keystore
+	if j.isExternal(j.snapshot.Load(), keyPrefix) {
+		return NewAuthError("AddOrReplaceKeyToSet", ErrExternalSigner)
+	}
+
+	// Key generation happens before taking the writer lock
+	prepared, err := j.generateKey(ctx, keyPrefix)
 	if err != nil {
-		return NewAuthError("InitializeJwkSet", fmt.Errorf("failed to import RSA key into JWK: %w", err))
+		return NewAuthError("AddOrReplaceKeyToSet", err)
 	}
 
-	keyID := fmt.Sprintf("key-%s", keyPrefix)
-	if err := key.Set(jwk.KeyIDKey, keyID); err != nil {
-		return NewAuthError("InitializeJwkSet", fmt.Errorf("failed to set key ID: %w", err))
+	if err := ctx.Err(); err != nil {
+		return NewAuthError("AddOrReplaceKeyToSet", err)
 	}
 
-	if err := set.AddKey(key); err != nil {
-		return NewAuthError("InitializeJwkSet", fmt.Errorf("failed to add key to set: %w", err))
+	if err := j.putKey(keyPrefix, prepared, true); err != nil {
+		return NewAuthError("AddOrReplaceKeyToSet", err)
 	}
+	return nil
+}
 
-	j.jwkSet = set
+// EnsureKey adds a key for keyPrefix unless it already has one, so tokens
+// signed with the existing key stay valid. Compromised and external keys are
+// left in place; signing with them reports the problem.
+func (j *jwkManager) EnsureKey(keyPrefix string) error {
+	return j.EnsureKeyContext(context.Background(), keyPrefix)
+}
 
-	// Cache the key and metadata
-	j.keyCache[keyPrefix] = &cachedKey{
-		privateKey: privateKey,
-		publicKey:  &privateKey.PublicKey,
-		keyID:      keyID,
-		lastUsed:   time.Now(),
+func (j *jwkManager) EnsureKeyContext(ctx context.Context, keyPrefix string) error {
+	if err := j.validator.ValidateKeyPrefix(keyPrefix); err != nil {
+		return NewAuthError("EnsureKey", err)
+	}
+	if j.hasKey(j.snapshot.Load(), keyPrefix) {
+		return nil
 	}
 
-	j.keyMetadata[keyPrefix] = &KeyMetadata{
-		KeyID:     keyID,
-		CreatedAt: time.Now(),
-		Algorithm: j.config.Algorithm,
-		KeySize:   j.config.KeySize,
+	prepared, err := j.generateKey(ctx, keyPrefix)
+	if err != nil {
+		return NewAuthError("EnsureKey", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return NewAuthError("EnsureKey", err)
 	}
 
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// Another caller may have added the key while this one was generated
+	current := j.snapshot.Load()
+	if j.hasKey(current, keyPrefix) {
+		return nil
+	}
+	next := newKeySetSnapshot()
+	if current != nil {
+		next = current.clone()
+	}
+	next.putKey(keyPrefix, prepared, j.config.Now())
+	if err := j.publishLocked(next); err != nil {
+		return NewAuthError("EnsureKey", err)
+	}
 	return nil
 }
 
-func (j *jwkManager) AddOrReplaceKeyToSet(keyPrefix string) error {
-	if err := j.validator.ValidateKeyPrefix(keyPrefix); err != nil {
-		return NewAuthError("AddOrReplaceKeyToSet", err)
+func (j *jwkManager) hasKey(snapshot *keySetSnapshot, keyPrefix string) bool {
+	if snapshot == nil {
+		return false
 	}
+	_, exists := snapshot.metadata[keyPrefix]
+	return exists
+}
 
+// putKey adds or replaces the key owned by keyPrefix and publishes a new
+// snapshot. Rotation never replaces a key held by an external signer.
+func (j *jwkManager) putKey(keyPrefix string, prepared *preparedKey, rotate bool) error {
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
 
-	if j.jwkSet == nil {
-		j.mutex.Unlock() // Unlock before calling InitializeJwkSet
-		err := j.InitializeJwkSet(keyPrefix)
-		j.mutex.Lock() // Re-lock
-		return err
+	current := j.snapshot.Load()
+	if rotate && j.isExternal(current, keyPrefix) {
+		return ErrExternalSigner
+	}
+
+	next := newKeySetSnapshot()
+	if current != nil {
+		next = current.clone()
 	}
 
-	keyID := fmt.Sprintf("key-%s", keyPrefix)
+	next.putKey(keyPrefix, prepared, j.config.Now())
+	return j.publishLocked(next)
+}
 
-	// Remove old key if exists
-	if oldKey, found := j.jwkSet.LookupKeyID(keyID); found {
-		_ = j.jwkSet.RemoveKey(oldKey)
+func (j *jwkManager) isExternal(snapshot *keySetSnapshot, keyPrefix string) bool {
+	if snapshot == nil {
+		return false
 	}
+	metadata, exists := snapshot.metadata[keyPrefix]
+	return exists && metadata.External
+}
 
-	privateKey, err := rsa.GenerateKey(rand.Reader, j.config.KeySize)
+// preparedKey is a key wrapped as an annotated JWK, ready to be published
+type preparedKey struct {
+	key jwk.Key
+	// signer is nil for keys that can only be used for verification
+	signer Signer
+	// privateKey is nil for keys held by an external signer
+	privateKey crypto.Signer
+	publicKey  crypto.PublicKey
+	algorithm  jwa.SignatureAlgorithm
+	metadata   *KeyMetadata
+}
+
+// generateKey obtains a private key from the key source and prepares it for
+// keyPrefix. It must not be called with the writer lock held.
+func (j *jwkManager) generateKey(ctx context.Context, keyPrefix string) (*preparedKey, error) {
+	alg, err := lookupSignatureAlgorithm(j.config.Algorithm)
 	if err != nil {
-		return NewAuthError("AddOrReplaceKeyToSet", fmt.Errorf("failed to generate private key: %w", err))
+		return nil, err
 	}
 
+	privateKey, err := j.keySource.NextKey(ctx, KeySpec{Algorithm: j.config.Algorithm, Size: j.config.KeySize})
+	if err != nil {
+		return nil, err
+	}
+
+	return prepareKey(keyPrefix, privateKey, alg, j.config.Now())
+}
+
+// prepareKey wraps privateKey as a JWK carrying its key ID and metadata
+func prepareKey(keyPrefix string, privateKey crypto.Signer, alg jwa.SignatureAlgorithm, createdAt time.Time) (*preparedKey, error) {
 	key, err := jwk.Import(privateKey)
 	if err != nil {
-		return NewAuthError("AddOrReplaceKeyToSet", fmt.Errorf("failed to import RSA key into JWK: %w", err))
+		return nil, fmt.Errorf("failed to import private key into JWK: %w", err)
 	}
 
+	keyID := keyIDFor(keyPrefix)
 	if err := key.Set(jwk.KeyIDKey, keyID); err != nil {
-		return NewAuthError("AddOrReplaceKeyToSet", fmt.Errorf("failed to set key ID: %w", err))
+		return nil, fmt.Errorf("failed to set key ID: %w", err)
 	}
 
-	if err := j.jwkSet.AddKey(key); err != nil {
-		return NewAuthError("AddOrReplaceKeyToSet", fmt.Errorf("failed to add key to set: %w", err))
+	metadata := &KeyMetadata{
+		KeyID:     keyID,
+		CreatedAt: createdAt,
+		Algorithm: alg.String(),
+		KeySize:   keySizeOf(privateKey.Public()),
+		State:     KeyStateActive,
+		Owner:     keyPrefix,
+	}
+	if err := annotateKey(key, metadata); err != nil {
+		return nil, err
 	}
 
-	// Update cache and metadata
-	j.keyCache[keyPrefix] = &cachedKey{
+	signer, err := NewLocalSigner(privateKey, keyID, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &preparedKey{
+		key:        key,
+		signer:     signer,
 		privateKey: privateKey,
-		publicKey:  &privateKey.PublicKey,
-		keyID:      keyID,
-		lastUsed:   time.Now(),
+		publicKey:  privateKey.Public(),
+		algorithm:  alg,
+		metadata:   metadata,
+	}, nil
+}
+
+// prepareExternalKey publishes the public half of a key held by signer
+func prepareExternalKey(keyPrefix string, signer Signer, createdAt time.Time) (*preparedKey, error) {
+	key, err := jwk.Import(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to import public key into JWK: %w", err)
 	}
 
-	j.keyMetadata[keyPrefix] = &KeyMetadata{
-		KeyID:     keyID,
-		CreatedAt: time.Now(),
-		Algorithm: j.config.Algorithm,
-		KeySize:   j.config.KeySize,
+	if err := key.Set(jwk.KeyIDKey, signer.KeyID()); err != nil {
+		return nil, fmt.Errorf("failed to set key ID: %w", err)
+	}
+
+	metadata := &KeyMetadata{
+		KeyID:     signer.KeyID(),
+		CreatedAt: createdAt,
+		Algorithm: signer.Algorithm().String(),
+		KeySize:   keySizeOf(signer.Public()),
+		State:     KeyStateActive,
+		Owner:     keyPrefix,
+		External:  true,
 	}
+	if err := annotateKey(key, metadata); err != nil {
+		return nil, err
+	}
+
+	return &preparedKey{
+		key:       key,
+		signer:    signer,
+		publicKey: signer.Public(),
+		algorithm: signer.Algorithm(),
+		metadata:  metadata,
+	}, nil
+}
+
+// RegisterSigner publishes a key held by an external signer for keyPrefix.
+// Tokens for keyPrefix are then signed through signer.
+func (j *jwkManager) RegisterSigner(keyPrefix string, signer Signer) error {
+	return j.RegisterSignerContext(context.Background(), keyPrefix, signer)
+}
 
+func (j *jwkManager) RegisterSignerContext(ctx context.Context, keyPrefix string, signer Signer) error {
+	if err := j.validator.ValidateKeyPrefix(keyPrefix); err != nil {
+		return NewAuthError("RegisterSigner", err)
+	}
+	if signer.KeyID() == "" {
+		return NewAuthError("RegisterSigner", fmt.Errorf("%w: signer has no key ID", ErrInvalidKeyData))
+	}
+
+	alg, err := j.checkKeyPolicy(signer.Public(), signer.Algorithm().String())
+	if err != nil {
+		return NewAuthError("RegisterSigner", err)
+	}
+	if alg != signer.Algorithm() {
+		return NewAuthError("RegisterSigner", ErrAlgorithmMismatch)
+	}
+
+	// Keep the original creation time when a signer is re-attached after a restart
+	createdAt := j.config.Now()
+	if snapshot := j.snapshot.Load(); snapshot != nil {
+		if metadata, exists := snapshot.metadata[keyPrefix]; exists && metadata.External && metadata.KeyID == signer.KeyID() {
+			createdAt = metadata.CreatedAt
+		}
+	}
+
+	prepared, err := prepareExternalKey(keyPrefix, signer, createdAt)
+	if err != nil {
+		return NewAuthError("RegisterSigner", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return NewAuthError("RegisterSigner", err)
+	}
+
+	if err := j.putKey(keyPrefix, prepared, false); err != nil {
+		return NewAuthError("RegisterSigner", err)
+	}
+	return nil
+}
+
+// GetSigner returns the signer for keyPrefix
+func (j *jwkManager) GetSigner(keyPrefix string) (Signer, error) {
+	return j.GetSignerContext(context.Background(), keyPrefix)
+}
+
+func (j *jwkManager) GetSignerContext(ctx context.Context, keyPrefix string) (Signer, error) {
+	cached, err := j.signingKey(keyPrefix)
+	if err != nil {
+		return nil, NewAuthError("GetSigner", err)
+	}
+	return cached.signer, nil
+}
+
+// publishLocked seals next and makes it visible to readers. The caller must
+// hold the writer mutex.
+func (j *jwkManager) publishLocked(next *keySetSnapshot) error {
+	sealed, err := next.seal()
+	if err != nil {
+		return err
+	}
+	j.snapshot.Store(sealed)
 	return nil
 }
 
 func (j *jwkManager) GetPrivateKeyWithId(keyPrefix string) (*rsa.PrivateKey, string, error) {
-	if err := j.validator.ValidateKeyPrefix(keyPrefix); err != nil {
+	return j.GetPrivateKeyWithIdContext(context.Background(), keyPrefix)
+}
+
+func (j *jwkManager) GetPrivateKeyWithIdContext(ctx context.Context, keyPrefix string) (*rsa.PrivateKey, string, error) {
+	cached, err := j.signingKey(keyPrefix)
+	if err != nil {
 		return nil, "", NewAuthError("GetPrivateKeyWithId", err)
 	}
 
-	j.mutex.RLock()
-	defer j.mutex.RUnlock()
+	if cached.privateKey == nil {
+		return nil, "", NewAuthError("GetPrivateKeyWithId", ErrExternalSigner)
+	}
+
+	rsaPrivateKey, ok := cached.privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, "", NewAuthError("GetPrivateKeyWithId", fmt.Errorf("%w: %T is not an RSA key", ErrUnsupportedKeyType, cached.privateKey))
+	}
+	return rsaPrivateKey, cached.keyID, nil
+}
+
+// GetSigningKey returns the signing key for keyPrefix with its key ID and algorithm
+func (j *jwkManager) GetSigningKey(keyPrefix string) (crypto.Signer, string, jwa.SignatureAlgorithm, error) {
+	return j.GetSigningKeyContext(context.Background(), keyPrefix)
+}
+
+func (j *jwkManager) GetSigningKeyContext(ctx context.Context, keyPrefix string) (crypto.Signer, string, jwa.SignatureAlgorithm, error) {
+	cached, err := j.signingKey(keyPrefix)
+	if err != nil {
+		return nil, "", jwa.EmptySignatureAlgorithm(), NewAuthError("GetSigningKey", err)
+	}
+	if cached.privateKey == nil {
+		return AsCryptoSigner(ctx, cached.signer), cached.keyID, cached.algorithm, nil
+	}
+	return cached.privateKey, cached.keyID, cached.algorithm, nil
+}
+
+func (j *jwkManager) signingKey(keyPrefix string) (*cachedKey, error) {
+	if err := j.validator.ValidateKeyPrefix(keyPrefix); err != nil {
+		return nil, err
+	}
+
+	snapshot := j.snapshot.Load()
+	if snapshot == nil {
+		return nil, ErrJWKSetNotInitialized
+	}
 
 	// Check cache first
-	if cached, exists := j.keyCache[keyPrefix]; exists {
-		cached.lastUsed = time.Now()
-		return cached.privateKey, cached.keyID, nil
+	if cached, exists := snapshot.signingKeys[keyPrefix]; exists {
+		cached.touch(j.config.Now())
+		return cached, nil
 	}
 
-	// Fallback to JWK set lookup
-	keyID := fmt.Sprintf("key-%s", keyPrefix)
-	key, foundKey := j.jwkSet.LookupKeyID(keyID)
-	if !foundKey {
-		return nil, "", NewAuthError("GetPrivateKeyWithId", ErrKeyNotFound)
+	// Fallback to JWK set lookup for keys evicted by CleanupExpiredKeys
+	metadata, exists := snapshot.metadata[keyPrefix]
+	if !exists {
+		return nil, ErrKeyNotFound
+	}
+	if metadata.State == KeyStateCompromised {
+		return nil, ErrKeyCompromised
+	}
+	if metadata.External {
+		// Stored external keys need their signer registered again
+		return nil, ErrExternalSigner
 	}
+	return j.restoreCachedKey(keyPrefix, metadata.KeyID)
+}
+
+// restoreCachedKey exports an evicted signing key from the JWK set and
+// publishes it back into the cache
+func (j *jwkManager) restoreCachedKey(keyPrefix string, keyID string) (*cachedKey, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
 
-	var rsaPrivateKey rsa.PrivateKey
-	if err := jwk.Export(key, &rsaPrivateKey); err != nil {
-		return nil, "", NewAuthError("GetPrivateKeyWithId", fmt.Errorf("failed to export raw key: %w", err))
+	current := j.snapshot.Load()
+	if cached, exists := current.signingKeys[keyPrefix]; exists {
+		return cached, nil
 	}
 
-	// Update cache
-	j.keyCache[keyPrefix] = &cachedKey{
-		privateKey: &rsaPrivateKey,
-		publicKey:  &rsaPrivateKey.PublicKey,
-		keyID:      keyID,
-		lastUsed:   time.Now(),
+	key, found := current.jwkKeys[keyID]
+	if !found {
+		return nil, ErrKeyNotFound
 	}
 
-	return &rsaPrivateKey, keyID, nil
+	privateKey, err := exportSigner(key)
+	if err != nil {
+		return nil, err
+	}
+
+	alg := current.publicKeys[keyID].algorithm
+	signer, err := NewLocalSigner(privateKey, keyID, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	next := current.clone()
+	cached := newCachedKey(&preparedKey{
+		signer:     signer,
+		privateKey: privateKey,
+		algorithm:  alg,
+		metadata:   current.metadata[keyPrefix],
+	}, j.config.Now())
+	next.signingKeys[keyPrefix] = cached
+	if err := j.publishLocked(next); err != nil {
+		return nil, err
+	}
+	return cached, nil
 }
 
 func (j *jwkManager) GetPublicKeyBy(keyId string) (*rsa.PublicKey, error) {
-	j.mutex.RLock()
-	defer j.mutex.RUnlock()
+	return j.GetPublicKeyByContext(context.Background(), keyId)
+}
 
-	if j.jwkSet == nil {
+func (j *jwkManager) GetPublicKeyByContext(ctx context.Context, keyId string) (*rsa.PublicKey, error) {
+	snapshot := j.snapshot.Load()
+	if snapshot == nil {
 		return nil, NewAuthError("GetPublicKeyBy", ErrJWKSetNotInitialized)
 	}
 
-	key, found := j.jwkSet.LookupKeyID(keyId)
+	entry, found := snapshot.publicKeys[keyId]
 	if !found {
 		return nil, NewAuthError("GetPublicKeyBy", fmt.Errorf("no key found with kid: %s", keyId))
 	}
 
-	var rsaPrivateKey rsa.PrivateKey
-	if err := jwk.Export(key, &rsaPrivateKey); err != nil {
-		return nil, NewAuthError("GetPublicKeyBy", fmt.Errorf("failed to export raw key: %w", err))
+	publicKey, ok := entry.publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, NewAuthError("GetPublicKeyBy", fmt.Errorf("%w: %T is not an RSA key", ErrUnsupportedKeyType, entry.publicKey))
+	}
+	return publicKey, nil
+}
+
+// GetVerificationKey returns the public key for keyId and the algorithm bound to it
+func (j *jwkManager) GetVerificationKey(keyId string) (crypto.PublicKey, jwa.SignatureAlgorithm, error) {
+	return j.GetVerificationKeyContext(context.Background(), keyId)
+}
+
+func (j *jwkManager) GetVerificationKeyContext(ctx context.Context, keyId string) (crypto.PublicKey, jwa.SignatureAlgorithm, error) {
+	snapshot := j.snapshot.Load()
+	if snapshot == nil {
+		return nil, jwa.EmptySignatureAlgorithm(), NewAuthError("GetVerificationKey", ErrJWKSetNotInitialized)
+	}
+
+	entry, found := snapshot.publicKeys[keyId]
+	if !found {
+		if _, compromised := snapshot.compromised[keyId]; compromised {
+			return nil, jwa.EmptySignatureAlgorithm(), NewAuthError("GetVerificationKey", fmt.Errorf("%w: kid %s", ErrKeyCompromised, keyId))
+		}
+		return nil, jwa.EmptySignatureAlgorithm(), NewAuthError("GetVerificationKey", fmt.Errorf("%w: kid %s", ErrKeyNotFound, keyId))
+	}
+	return entry.publicKey, entry.algorithm, nil
+}
+
+// GetPublicJwkSet serializes the verification keys as a JWKS document for
+// publishing. Private key material, metadata and compromised keys are left out.
+func (j *jwkManager) GetPublicJwkSet() ([]byte, error) {
+	return j.GetPublicJwkSetContext(context.Background())
+}
+
+func (j *jwkManager) GetPublicJwkSetContext(ctx context.Context) ([]byte, error) {
+	snapshot := j.snapshot.Load()
+	if snapshot == nil {
+		return nil, NewAuthError("GetPublicJwkSet", ErrJWKSetNotInitialized)
+	}
+
+	keyIDs := make([]string, 0, len(snapshot.publicKeys))
+	for keyID := range snapshot.publicKeys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+
+	set := jwk.NewSet()
+	for _, keyID := range keyIDs {
+		entry := snapshot.publicKeys[keyID]
+		key, err := jwk.Import(entry.publicKey)
+		if err != nil {
+			return nil, NewAuthError("GetPublicJwkSet", fmt.Errorf("failed to import public key %s: %w", keyID, err))
+		}
+		for name, value := range map[string]any{
+			jwk.KeyIDKey:     keyID,
+			jwk.AlgorithmKey: entry.algorithm,
+			jwk.KeyUsageKey:  jwk.ForSignature,
+		} {
+			if err := key.Set(name, value); err != nil {
+				return nil, NewAuthError("GetPublicJwkSet", fmt.Errorf("failed to set %s on key %s: %w", name, keyID, err))
+			}
+		}
+		if err := set.AddKey(key); err != nil {
+			return nil, NewAuthError("GetPublicJwkSet", fmt.Errorf("failed to add key to set: %w", err))
+		}
 	}
 
-	return &rsaPrivateKey.PublicKey, nil
+	publicJSON, err := json.Marshal(set)
+	if err != nil {
+		return nil, NewAuthError("GetPublicJwkSet", err)
+	}
+	return publicJSON, nil
 }
 
+// GetJwkSetForStorage serializes the JWK set together with key metadata
+// in the versioned storage format
 func (j *jwkManager) GetJwkSetForStorage() ([]byte, error) {
-	updatedJwkSetJSON, err := json.Marshal(j.jwkSet)
+	return j.GetJwkSetForStorageContext(context.Background())
+}
+
+func (j *jwkManager) GetJwkSetForStorageContext(ctx context.Context) ([]byte, error) {
+	snapshot := j.snapshot.Load()
+	if snapshot == nil {
+		return nil, NewAuthError("GetJwkSetForStorage", ErrJWKSetNotInitialized)
+	}
+
+	set := jwk.NewSet()
+	for i := 0; i < snapshot.set.Len(); i++ {
+		key, _ := snapshot.set.Key(i)
+		if err := set.AddKey(key); err != nil {
+			return nil, NewAuthError("GetJwkSetForStorage", fmt.Errorf("failed to add key to set: %w", err))
+		}
+	}
+
+	if err := set.Set(storageVersionMember, StorageFormatVersion); err != nil {
+		return nil, NewAuthError("GetJwkSetForStorage", fmt.Errorf("failed to set storage version: %w", err))
+	}
+
+	if err := storeCompromisedKeys(set, snapshot.compromised); err != nil {
+		return nil, NewAuthError("GetJwkSetForStorage", fmt.Errorf("failed to store compromised keys: %w", err))
+	}
+
+	updatedJwkSetJSON, err := json.Marshal(set)
 	if err != nil {
-		return nil, err
+		return nil, NewAuthError("GetJwkSetForStorage", err)
 	}
 	return updatedJwkSetJSON, nil
 }
 
+// GetJwkSetFromStorage replaces the JWK set with a stored one and rebuilds
+// the key cache and metadata from it
 func (j *jwkManager) GetJwkSetFromStorage(jwkSetJSON string) error {
+	return j.GetJwkSetFromStorageContext(context.Background(), jwkSetJSON)
+}
+
+func (j *jwkManager) GetJwkSetFromStorageContext(ctx context.Context, jwkSetJSON string) error {
 	set, err := jwk.ParseString(jwkSetJSON)
 	if err != nil {
-		return err
+		return NewAuthError("GetJwkSetFromStorage", err)
+	}
+
+	version, err := storageVersionOf(set)
+	if err != nil {
+		return NewAuthError("GetJwkSetFromStorage", err)
+	}
+	if version > StorageFormatVersion {
+		return NewAuthError("GetJwkSetFromStorage", fmt.Errorf("%w: %d", ErrUnsupportedStorage, version))
+	}
+	next := newKeySetSnapshot()
+	now := j.config.Now()
+
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Key(i)
+
+		prepared, err := preparedKeyFromStorage(key)
+		if err != nil {
+			return NewAuthError("GetJwkSetFromStorage", err)
+		}
+
+		next.putKey(prepared.metadata.Owner, prepared, now)
+	}
+
+	compromised, err := loadCompromisedKeys(set)
+	if err != nil {
+		return NewAuthError("GetJwkSetFromStorage", err)
+	}
+	for _, record := range compromised {
+		next.compromised[record.KeyID] = record
+		// Keep reporting the compromise until the key prefix is rotated
+		if _, exists := next.metadata[record.Owner]; !exists {
+			next.metadata[record.Owner] = record
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return NewAuthError("GetJwkSetFromStorage", err)
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if err := j.publishLocked(next); err != nil {
+		return NewAuthError("GetJwkSetFromStorage", err)
 	}
-	j.jwkSet = set
 	return nil
 }
 
 // New methods for better management
 func (j *jwkManager) GetKeyCount() int {
-	j.mutex.RLock()
-	defer j.mutex.RUnlock()
+	return j.GetKeyCountContext(context.Background())
+}
 
-	if j.jwkSet == nil {
+func (j *jwkManager) GetKeyCountContext(ctx context.Context) int {
+	snapshot := j.snapshot.Load()
+	if snapshot == nil {
 		return 0
 	}
-	return j.jwkSet.Len()
+	return len(snapshot.jwkKeys)
 }
 
 func (j *jwkManager) CleanupExpiredKeys() error {
+	return j.CleanupExpiredKeysContext(context.Background())
+}
+
+func (j *jwkManager) CleanupExpiredKeysContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return NewAuthError("CleanupExpiredKeys", err)
+	}
+
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
 
+	current := j.snapshot.Load()
+	if current == nil {
+		return nil
+	}
+
 	// Clean up cache entries that haven't been used in a while
-	cutoff := time.Now().Add(-24 * time.Hour)
-	for keyPrefix, cached := range j.keyCache {
-		if cached.lastUsed.Before(cutoff) {
-			delete(j.keyCache, keyPrefix)
+	cutoff := j.config.Now().Add(-24 * time.Hour)
+	next := current.clone()
+	for keyPrefix, cached := range next.signingKeys {
+		// External signers cannot be restored from the JWK set
+		if cached.privateKey != nil && cached.lastUsedAt().Before(cutoff) {
+			delete(next.signingKeys, keyPrefix)
 		}
 	}
 
-	return nil
+	if len(next.signingKeys) == len(current.signingKeys) {
+		return nil
+	}
+	return j.publishLocked(next)
 }
 
 func (j *jwkManager) GetKeyMetadata(keyPrefix string) (*KeyMetadata, error) {
-	j.mutex.RLock()
-	defer j.mutex.RUnlock()
+	return j.GetKeyMetadataContext(context.Background(), keyPrefix)
+}
 
-	metadata, exists := j.keyMetadata[keyPrefix]
+func (j *jwkManager) GetKeyMetadataContext(ctx context.Context, keyPrefix string) (*KeyMetadata, error) {
+	snapshot := j.snapshot.Load()
+	if snapshot == nil {
+		return nil, NewAuthError("GetKeyMetadata", ErrKeyNotFound)
+	}
+
+	metadata, exists := snapshot.metadata[keyPrefix]
 	if !exists {
 		return nil, NewAuthError("GetKeyMetadata", ErrKeyNotFound)
 	}
 
 	// Return a copy to prevent external modification
-	return &KeyMetadata{
-		KeyID:     metadata.KeyID,
-		CreatedAt: metadata.CreatedAt,
-		Algorithm: metadata.Algorithm,
-		KeySize:   metadata.KeySize,
-	}, nil
+	return copyKeyMetadata(metadata), nil
 }
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyOperationsHonourCancelledContext(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := manager.InitializeJwkSetContext(ctx, "alice"); !errors.Is(err, context.Canceled) {
+		t.Errorf("InitializeJwkSetContext error = %v, want context.Canceled", err)
+	}
+	if err := manager.AddOrReplaceKeyToSetContext(ctx, "alice"); !errors.Is(err, context.Canceled) {
+		t.Errorf("AddOrReplaceKeyToSetContext error = %v, want context.Canceled", err)
+	}
+	if err := manager.CleanupExpiredKeysContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("CleanupExpiredKeysContext error = %v, want context.Canceled", err)
+	}
+	if got := manager.GetKeyCount(); got != 0 {
+		t.Errorf("key count = %d after cancelled calls, want 0", got)
+	}
+}
+
+func TestLocalSignerHonoursCancelledContext(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+	signer, err := manager.GetSigner("alice")
+	if err != nil {
+		t.Fatalf("GetSigner: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := signer.SignDigest(ctx, make([]byte, 32)); !errors.Is(err, context.Canceled) {
+		t.Errorf("SignDigest error = %v, want context.Canceled", err)
+	}
+}
+
+func TestGetKeyMetadataReturnsCopy(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+
+	metadata, err := manager.GetKeyMetadataContext(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("GetKeyMetadataContext: %v", err)
+	}
+	metadata.State = KeyStateCompromised
+
+	again, _ := manager.GetKeyMetadata("alice")
+	if again.State != KeyStateActive {
+		t.Error("changing returned metadata changed the published metadata")
+	}
+}
+
+func TestEnsureKeyKeepsExistingKey(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	if err := manager.EnsureKey("alice"); err != nil {
+		t.Fatalf("EnsureKey: %v", err)
+	}
+	first, err := manager.GetSigner("alice")
+	if err != nil {
+		t.Fatalf("GetSigner: %v", err)
+	}
+
+	if err := manager.EnsureKey("alice"); err != nil {
+		t.Fatalf("EnsureKey again: %v", err)
+	}
+	second, err := manager.GetSigner("alice")
+	if err != nil {
+		t.Fatalf("GetSigner: %v", err)
+	}
+	if !second.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(first.Public()) {
+		t.Error("EnsureKey replaced an existing key")
+	}
+	if got := manager.GetKeyCount(); got != 1 {
+		t.Errorf("key count = %d, want 1", got)
+	}
+}
+
+func TestEnsureKeyConcurrentCallersAgree(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	keys := make([]crypto.PublicKey, 8)
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := manager.EnsureKey("alice"); err != nil {
+				t.Error(err)
+				return
+			}
+			signer, err := manager.GetSigner("alice")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			keys[i] = signer.Public()
+		}()
+	}
+	wg.Wait()
+
+	// Only one of the generated keys is ever published
+	for i, key := range keys {
+		if key == nil || !key.(interface{ Equal(crypto.PublicKey) bool }).Equal(keys[0]) {
+			t.Errorf("caller %d signs with a different key", i)
+		}
+	}
+}
+
+func TestEnsureKeyLeavesCompromisedKey(t *testing.T) {
+	clock := newTestClock()
+	manager := newTestManager(t, clock)
+	if err := manager.EnsureKey("alice"); err != nil {
+		t.Fatalf("EnsureKey: %v", err)
+	}
+	if _, err := manager.MarkKeyCompromised("alice", "leaked", time.Time{}); err != nil {
+		t.Fatalf("MarkKeyCompromised: %v", err)
+	}
+
+	if err := manager.EnsureKey("alice"); err != nil {
+		t.Fatalf("EnsureKey: %v", err)
+	}
+	metadata, err := manager.GetKeyMetadata("alice")
+	if err != nil {
+		t.Fatalf("GetKeyMetadata: %v", err)
+	}
+	if metadata.CompromisedAt == nil {
+		t.Error("EnsureKey replaced a compromised key; only rotation may do that")
+	}
+}
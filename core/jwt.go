@@ -1,6 +1,8 @@
 package core
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -16,21 +18,45 @@ type JwtManager interface {
 }
 
 type jwtManager struct {
+	clock Clock
 }
 
-func NewJwtManager() JwtManager {
-	return &jwtManager{}
+// JwtManagerOption configures optional JwtManager dependencies
+type JwtManagerOption func(*jwtManager)
+
+// WithJwtClock sets the clock used for the iat and exp claims
+func WithJwtClock(clock Clock) JwtManagerOption {
+	return func(j *jwtManager) {
+		j.clock = clock
+	}
+}
+
+func NewJwtManager(opts ...JwtManagerOption) JwtManager {
+	j := &jwtManager{clock: SystemClock()}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
 }
 
 func (j *jwtManager) GenerateUnsignedToken(claims map[string]any, expiry time.Duration) (jwt.Token, error) {
 	token := jwt.New()
 
-	var currentTime = time.Now()
+	var currentTime = j.clock.Now()
 	var tokenKeys = map[string]any{
 		jwt.IssuedAtKey:   currentTime.Unix(),
 		jwt.ExpirationKey: currentTime.Add(expiry).Unix(),
 	}
 
+	// Every token gets a unique ID so it can be revoked individually
+	if _, exists := claims[jwt.JwtIDKey]; !exists {
+		tokenID, err := NewTokenID()
+		if err != nil {
+			return nil, err
+		}
+		tokenKeys[jwt.JwtIDKey] = tokenID
+	}
+
 	for key, value := range tokenKeys {
 		if err := token.Set(key, value); err != nil {
 			return nil, fmt.Errorf("failed to set claim %s: %w", key, err)
@@ -44,6 +70,15 @@ func (j *jwtManager) GenerateUnsignedToken(claims map[string]any, expiry time.Du
 	return token, nil
 }
 
+// NewTokenID returns a random, URL-safe token identifier
+func NewTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
 func (j *jwtManager) ParseToken(jwtToken string) (map[string]any, error) {
 	parsedToken, err := jws.Parse([]byte(jwtToken))
 	if err != nil {
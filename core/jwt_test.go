@@ -0,0 +1,23 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerateUnsignedTokenUsesClock(t *testing.T) {
+	clock := newTestClock()
+	token, err := NewJwtManager(WithJwtClock(clock)).GenerateUnsignedToken(map[string]any{"sub": "alice"}, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateUnsignedToken: %v", err)
+	}
+
+	issuedAt, _ := token.IssuedAt()
+	expiresAt, _ := token.Expiration()
+	if !issuedAt.Equal(clock.Now()) || !expiresAt.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("iat, exp = %s, %s, want %s, %s", issuedAt, expiresAt, clock.Now(), clock.Now().Add(time.Hour))
+	}
+	if tokenID, ok := token.JwtID(); !ok || tokenID == "" {
+		t.Error("token has no jti")
+	}
+}
@@ -0,0 +1,237 @@
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"slices"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// KeyFormat identifies the encoding of a single signing key
+type KeyFormat string
+
+const (
+	// KeyFormatPEM detects the encoding from the PEM block type on import
+	KeyFormatPEM   KeyFormat = "pem"
+	KeyFormatPKCS1 KeyFormat = "pkcs1" // PEM "RSA PRIVATE KEY"
+	KeyFormatPKCS8 KeyFormat = "pkcs8" // PEM "PRIVATE KEY"
+	KeyFormatSEC1  KeyFormat = "sec1"  // PEM "EC PRIVATE KEY"
+	KeyFormatJWK   KeyFormat = "jwk"
+)
+
+// PEM block types for each key format
+const (
+	pemTypePKCS1 = "RSA PRIVATE KEY"
+	pemTypePKCS8 = "PRIVATE KEY"
+	pemTypeSEC1  = "EC PRIVATE KEY"
+)
+
+// ImportSigningKey replaces the key for keyPrefix with an externally provided
+// private key. When algorithm is empty it is taken from the JWK "alg" member
+// or inferred from the key type.
+func (j *jwkManager) ImportSigningKey(keyPrefix string, data []byte, format KeyFormat, algorithm string) error {
+	return j.ImportSigningKeyContext(context.Background(), keyPrefix, data, format, algorithm)
+}
+
+func (j *jwkManager) ImportSigningKeyContext(ctx context.Context, keyPrefix string, data []byte, format KeyFormat, algorithm string) error {
+	if err := j.validator.ValidateKeyPrefix(keyPrefix); err != nil {
+		return NewAuthError("ImportSigningKey", err)
+	}
+
+	privateKey, keyAlgorithm, err := parseSigningKey(data, format)
+	if err != nil {
+		return NewAuthError("ImportSigningKey", err)
+	}
+	if algorithm == "" {
+		algorithm = keyAlgorithm
+	}
+
+	alg, err := j.checkKeyPolicy(privateKey.Public(), algorithm)
+	if err != nil {
+		return NewAuthError("ImportSigningKey", err)
+	}
+
+	prepared, err := prepareKey(keyPrefix, privateKey, alg, j.config.Now())
+	if err != nil {
+		return NewAuthError("ImportSigningKey", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return NewAuthError("ImportSigningKey", err)
+	}
+
+	if err := j.putKey(keyPrefix, prepared, false); err != nil {
+		return NewAuthError("ImportSigningKey", err)
+	}
+	return nil
+}
+
+// ExportSigningKey encodes the private key for keyPrefix in the given format
+func (j *jwkManager) ExportSigningKey(keyPrefix string, format KeyFormat) ([]byte, error) {
+	return j.ExportSigningKeyContext(context.Background(), keyPrefix, format)
+}
+
+func (j *jwkManager) ExportSigningKeyContext(ctx context.Context, keyPrefix string, format KeyFormat) ([]byte, error) {
+	cached, err := j.signingKey(keyPrefix)
+	if err != nil {
+		return nil, NewAuthError("ExportSigningKey", err)
+	}
+
+	if cached.privateKey == nil {
+		return nil, NewAuthError("ExportSigningKey", ErrExternalSigner)
+	}
+
+	data, err := encodeSigningKey(cached, format)
+	if err != nil {
+		return nil, NewAuthError("ExportSigningKey", err)
+	}
+	return data, nil
+}
+
+// checkKeyPolicy validates a key against the configured algorithms and sizes
+func (j *jwkManager) checkKeyPolicy(publicKey crypto.PublicKey, algorithm string) (jwa.SignatureAlgorithm, error) {
+	var alg jwa.SignatureAlgorithm
+	var err error
+	if algorithm == "" {
+		alg, err = defaultAlgorithmFor(publicKey)
+	} else {
+		alg, err = lookupSignatureAlgorithm(algorithm)
+	}
+	if err != nil {
+		return jwa.EmptySignatureAlgorithm(), err
+	}
+
+	if !slices.Contains(j.config.SignatureAlgorithms(), alg.String()) {
+		return jwa.EmptySignatureAlgorithm(), fmt.Errorf("%w: algorithm %s is not allowed", ErrKeyPolicyViolation, alg)
+	}
+
+	if err := checkKeyAlgorithm(alg, publicKey); err != nil {
+		return jwa.EmptySignatureAlgorithm(), err
+	}
+
+	if rsaPublicKey, ok := publicKey.(*rsa.PublicKey); ok && rsaPublicKey.N.BitLen() < j.config.MinRSAKeySize {
+		return jwa.EmptySignatureAlgorithm(), fmt.Errorf("%w: RSA key size %d is below minimum %d",
+			ErrKeyPolicyViolation, rsaPublicKey.N.BitLen(), j.config.MinRSAKeySize)
+	}
+
+	return alg, nil
+}
+
+// parseSigningKey decodes a private key and any algorithm it declares
+func parseSigningKey(data []byte, format KeyFormat) (crypto.Signer, string, error) {
+	if format == KeyFormatJWK {
+		return parseJWKSigningKey(data)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, "", fmt.Errorf("%w: no PEM block found", ErrInvalidKeyData)
+	}
+
+	if format == KeyFormatPEM {
+		switch block.Type {
+		case pemTypePKCS1:
+			format = KeyFormatPKCS1
+		case pemTypePKCS8:
+			format = KeyFormatPKCS8
+		case pemTypeSEC1:
+			format = KeyFormatSEC1
+		default:
+			return nil, "", fmt.Errorf("%w: unsupported PEM block type %q", ErrInvalidKeyData, block.Type)
+		}
+	}
+
+	var raw any
+	var err error
+	switch format {
+	case KeyFormatPKCS1:
+		raw, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case KeyFormatPKCS8:
+		raw, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case KeyFormatSEC1:
+		raw, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, "", fmt.Errorf("%w: unknown key format %q", ErrInvalidKeyData, format)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidKeyData, err)
+	}
+
+	switch key := raw.(type) {
+	case *rsa.PrivateKey:
+		return key, "", nil
+	case *ecdsa.PrivateKey:
+		return key, "", nil
+	case ed25519.PrivateKey:
+		return key, "", nil
+	}
+	return nil, "", fmt.Errorf("%w: %T", ErrUnsupportedKeyType, raw)
+}
+
+func parseJWKSigningKey(data []byte) (crypto.Signer, string, error) {
+	key, err := jwk.ParseKey(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidKeyData, err)
+	}
+
+	privateKey, err := exportSigner(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var algorithm string
+	if alg, ok := key.Algorithm(); ok {
+		algorithm = alg.String()
+	}
+	return privateKey, algorithm, nil
+}
+
+// encodeSigningKey encodes a cached signing key in the requested format
+func encodeSigningKey(cached *cachedKey, format KeyFormat) ([]byte, error) {
+	switch format {
+	case KeyFormatJWK:
+		key, err := jwk.Import(cached.privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import private key into JWK: %w", err)
+		}
+		if err := key.Set(jwk.KeyIDKey, cached.keyID); err != nil {
+			return nil, fmt.Errorf("failed to set key ID: %w", err)
+		}
+		if err := key.Set(jwk.AlgorithmKey, cached.algorithm); err != nil {
+			return nil, fmt.Errorf("failed to set algorithm: %w", err)
+		}
+		return json.Marshal(key)
+	case KeyFormatPKCS1:
+		rsaPrivateKey, ok := cached.privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: PKCS#1 requires an RSA key", ErrUnsupportedKeyType)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: pemTypePKCS1, Bytes: x509.MarshalPKCS1PrivateKey(rsaPrivateKey)}), nil
+	case KeyFormatPKCS8, KeyFormatPEM:
+		der, err := x509.MarshalPKCS8PrivateKey(cached.privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedKeyType, err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: pemTypePKCS8, Bytes: der}), nil
+	case KeyFormatSEC1:
+		ecPrivateKey, ok := cached.privateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: SEC1 requires an EC key", ErrUnsupportedKeyType)
+		}
+		der, err := x509.MarshalECPrivateKey(ecPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal EC key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: pemTypeSEC1, Bytes: der}), nil
+	}
+	return nil, fmt.Errorf("%w: unknown key format %q", ErrInvalidKeyData, format)
+}
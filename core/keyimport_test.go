@@ -0,0 +1,147 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func pemEncode(t *testing.T, blockType string, der []byte, err error) []byte {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("marshal %s: %v", blockType, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestImportSigningKeyFormats(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	sec1, sec1Err := x509.MarshalECPrivateKey(ecKey)
+	pkcs8, pkcs8Err := x509.MarshalPKCS8PrivateKey(edKey)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		format  KeyFormat
+		wantAlg string
+	}{
+		{"sec1", pemEncode(t, pemTypeSEC1, sec1, sec1Err), KeyFormatSEC1, "ES256"},
+		{"pem detects sec1", pemEncode(t, pemTypeSEC1, sec1, sec1Err), KeyFormatPEM, "ES256"},
+		{"pkcs8 ed25519", pemEncode(t, pemTypePKCS8, pkcs8, pkcs8Err), KeyFormatPKCS8, "EdDSA"},
+		{"pem detects pkcs8", pemEncode(t, pemTypePKCS8, pkcs8, pkcs8Err), KeyFormatPEM, "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(t, newTestClock())
+			if err := manager.ImportSigningKey("imported", tt.data, tt.format, ""); err != nil {
+				t.Fatalf("ImportSigningKey: %v", err)
+			}
+			metadata, err := manager.GetKeyMetadata("imported")
+			if err != nil {
+				t.Fatalf("GetKeyMetadata: %v", err)
+			}
+			if metadata.Algorithm != tt.wantAlg || metadata.KeyID != "key-imported" {
+				t.Errorf("metadata = %+v, want algorithm %s and kid key-imported", metadata, tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []KeyFormat{KeyFormatJWK, KeyFormatPKCS8, KeyFormatSEC1} {
+		t.Run(string(format), func(t *testing.T) {
+			source := newTestManager(t, newTestClock())
+			if err := source.AddOrReplaceKeyToSet("alice"); err != nil {
+				t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+			}
+			data, err := source.ExportSigningKey("alice", format)
+			if err != nil {
+				t.Fatalf("ExportSigningKey: %v", err)
+			}
+
+			target := newTestManager(t, newTestClock())
+			if err := target.ImportSigningKey("alice", data, format, ""); err != nil {
+				t.Fatalf("ImportSigningKey: %v", err)
+			}
+
+			want, _ := source.GetSigner("alice")
+			got, err := target.GetSigner("alice")
+			if err != nil {
+				t.Fatalf("GetSigner: %v", err)
+			}
+			if !got.Public().(*ecdsa.PublicKey).Equal(want.Public()) || got.Algorithm() != want.Algorithm() {
+				t.Error("imported key differs from the exported one")
+			}
+		})
+	}
+}
+
+func TestExportSigningKeyRejectsWrongFormat(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+	if _, err := manager.ExportSigningKey("alice", KeyFormatPKCS1); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("ExportSigningKey(pkcs1) error = %v, want ErrUnsupportedKeyType", err)
+	}
+}
+
+func TestImportSigningKeyPolicy(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	smallRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	sec1, sec1Err := x509.MarshalECPrivateKey(ecKey)
+	ecPEM := pemEncode(t, pemTypeSEC1, sec1, sec1Err)
+	rsaPEM := pemEncode(t, pemTypePKCS1, x509.MarshalPKCS1PrivateKey(smallRSA), nil)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		format    KeyFormat
+		algorithm string
+		allowed   []string
+		wantErr   error
+	}{
+		{"curve mismatch", ecPEM, KeyFormatPEM, "ES384", nil, ErrAlgorithmMismatch},
+		{"algorithm not allowed", ecPEM, KeyFormatPEM, "", []string{"EdDSA"}, ErrKeyPolicyViolation},
+		{"rsa key too small", rsaPEM, KeyFormatPKCS1, "RS256", nil, ErrKeyPolicyViolation},
+		{"symmetric algorithm", ecPEM, KeyFormatPEM, "HS256", nil, ErrUnsupportedAlgorithm},
+		{"not pem", []byte("not a key"), KeyFormatPEM, "", nil, ErrInvalidKeyData},
+		{"wrong block type", rsaPEM, KeyFormatSEC1, "", nil, ErrInvalidKeyData},
+		{"invalid jwk", []byte(`{"kty":"EC"}`), KeyFormatJWK, "", nil, ErrInvalidKeyData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig(newTestClock())
+			if tt.allowed != nil {
+				config.AllowedAlgorithms = tt.allowed
+			}
+			manager := NewJwkManager(config)
+			err := manager.ImportSigningKey("imported", tt.data, tt.format, tt.algorithm)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ImportSigningKey error = %v, want %v", err, tt.wantErr)
+			}
+			if manager.GetKeyCount() != 0 {
+				t.Error("rejected key was added to the set")
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+)
+
+// KeySpec identifies the kind of key a KeySource produces
+type KeySpec struct {
+	Algorithm string
+	Size      int
+}
+
+// KeySource supplies newly generated private keys for rotation. NextKey
+// returns ctx.Err() if ctx is done before a key is available.
+type KeySource interface {
+	NextKey(ctx context.Context, spec KeySpec) (crypto.Signer, error)
+}
+
+// generateKey creates a new key for spec
+func generateKey(spec KeySpec) (crypto.Signer, error) {
+	alg, err := lookupSignatureAlgorithm(spec.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var privateKey crypto.Signer
+	if curve, ok := curveFor(alg); ok {
+		privateKey, err = ecdsa.GenerateKey(curve, rand.Reader)
+	} else if isRSAAlgorithm(alg) {
+		privateKey, err = rsa.GenerateKey(rand.Reader, spec.Size)
+	} else if alg == jwa.EdDSA() {
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		return nil, fmt.Errorf("%w: cannot generate keys for %s", ErrUnsupportedAlgorithm, alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+	return privateKey, nil
+}
+
+// generateKeyContext runs generateKey on its own goroutine so the caller can
+// give up when ctx is done. A key finished after cancellation is handed to
+// abandoned, which may be nil.
+func generateKeyContext(ctx context.Context, spec KeySpec, abandoned func(crypto.Signer)) (crypto.Signer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil {
+		return generateKey(spec)
+	}
+
+	type result struct {
+		privateKey crypto.Signer
+		err        error
+	}
+	done := make(chan result, 1)
+	go func() {
+		privateKey, err := generateKey(spec)
+		done <- result{privateKey, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.privateKey, r.err
+	case <-ctx.Done():
+		if abandoned != nil {
+			go func() {
+				if r := <-done; r.err == nil {
+					abandoned(r.privateKey)
+				}
+			}()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// generatingKeySource generates every key on demand
+type generatingKeySource struct{}
+
+func (generatingKeySource) NextKey(ctx context.Context, spec KeySpec) (crypto.Signer, error) {
+	return generateKeyContext(ctx, spec, nil)
+}
+
+// KeyPool keeps pre-generated keys for each KeySpec so rotation does not pay
+// for key generation. When a bucket drops below the low watermark a
+// background goroutine refills it up to the high watermark.
+type KeyPool struct {
+	lowWatermark  int
+	highWatermark int
+	// generate creates the keys of background refills
+	generate func(KeySpec) (crypto.Signer, error)
+
+	mutex   sync.Mutex
+	buckets map[KeySpec]*keyBucket
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type keyBucket struct {
+	keys      []crypto.Signer
+	refilling bool
+}
+
+// NewKeyPool creates a key pool with the given watermarks
+func NewKeyPool(lowWatermark, highWatermark int) *KeyPool {
+	if lowWatermark < 0 {
+		lowWatermark = 0
+	}
+	if highWatermark < lowWatermark {
+		highWatermark = lowWatermark
+	}
+	return &KeyPool{
+		lowWatermark:  lowWatermark,
+		highWatermark: highWatermark,
+		generate:      generateKey,
+		buckets:       make(map[KeySpec]*keyBucket),
+	}
+}
+
+// NextKey pops a pre-generated key for spec. If the pool is empty a key is
+// generated for the caller; if ctx is done first, that key is kept for the
+// next caller instead of being thrown away.
+func (p *KeyPool) NextKey(ctx context.Context, spec KeySpec) (crypto.Signer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	bucket := p.bucketLocked(spec)
+	var privateKey crypto.Signer
+	if n := len(bucket.keys); n > 0 {
+		privateKey = bucket.keys[n-1]
+		bucket.keys[n-1] = nil
+		bucket.keys = bucket.keys[:n-1]
+	}
+	p.refillLocked(spec, bucket)
+	p.mutex.Unlock()
+
+	if privateKey != nil {
+		return privateKey, nil
+	}
+	return generateKeyContext(ctx, spec, func(privateKey crypto.Signer) {
+		p.put(spec, privateKey)
+	})
+}
+
+// put returns an unused key to the bucket for spec unless the bucket is full
+func (p *KeyPool) put(spec KeySpec, privateKey crypto.Signer) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	bucket := p.bucketLocked(spec)
+	if !p.closed && len(bucket.keys) < p.highWatermark {
+		bucket.keys = append(bucket.keys, privateKey)
+	}
+}
+
+// Warm starts filling the bucket for spec up to the high watermark
+func (p *KeyPool) Warm(spec KeySpec) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	bucket := p.bucketLocked(spec)
+	if len(bucket.keys) < p.highWatermark && !bucket.refilling && !p.closed {
+		p.startRefillLocked(spec, bucket)
+	}
+}
+
+// Size returns the number of ready keys for spec
+func (p *KeyPool) Size(spec KeySpec) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if bucket, exists := p.buckets[spec]; exists {
+		return len(bucket.keys)
+	}
+	return 0
+}
+
+// Close stops background refills and waits for them to finish
+func (p *KeyPool) Close() {
+	p.mutex.Lock()
+	p.closed = true
+	p.mutex.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *KeyPool) bucketLocked(spec KeySpec) *keyBucket {
+	bucket, exists := p.buckets[spec]
+	if !exists {
+		bucket = &keyBucket{}
+		p.buckets[spec] = bucket
+	}
+	return bucket
+}
+
+// refillLocked starts a refill when the bucket has dropped below the low watermark
+func (p *KeyPool) refillLocked(spec KeySpec, bucket *keyBucket) {
+	if len(bucket.keys) < p.lowWatermark && !bucket.refilling && !p.closed {
+		p.startRefillLocked(spec, bucket)
+	}
+}
+
+func (p *KeyPool) startRefillLocked(spec KeySpec, bucket *keyBucket) {
+	bucket.refilling = true
+	p.wg.Add(1)
+	go p.refill(spec, bucket)
+}
+
+// refill generates keys outside the pool lock until the bucket reaches the
+// high watermark or the pool is closed. Both are checked again before a new
+// key is added, since the bucket may have been filled or the pool closed
+// while the key was generated.
+func (p *KeyPool) refill(spec KeySpec, bucket *keyBucket) {
+	defer p.wg.Done()
+
+	for {
+		p.mutex.Lock()
+		if p.closed || len(bucket.keys) >= p.highWatermark {
+			bucket.refilling = false
+			p.mutex.Unlock()
+			return
+		}
+		p.mutex.Unlock()
+
+		privateKey, err := p.generate(spec)
+
+		p.mutex.Lock()
+		if err != nil {
+			// Leave the bucket for the next NextKey call to retry
+			bucket.refilling = false
+			p.mutex.Unlock()
+			return
+		}
+		if !p.closed && len(bucket.keys) < p.highWatermark {
+			bucket.keys = append(bucket.keys, privateKey)
+		}
+		p.mutex.Unlock()
+	}
+}
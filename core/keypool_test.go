@@ -0,0 +1,165 @@
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testKeySpec = KeySpec{Algorithm: "ES256"}
+
+// waitForPoolSize polls until the pool holds want keys for spec
+func waitForPoolSize(t *testing.T, pool *KeyPool, spec KeySpec, want int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for pool.Size(spec) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool size = %d, want %d", pool.Size(spec), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKeyPoolWarmFillsToHighWatermark(t *testing.T) {
+	pool := NewKeyPool(2, 4)
+	defer pool.Close()
+
+	pool.Warm(testKeySpec)
+	waitForPoolSize(t, pool, testKeySpec, 4)
+}
+
+func TestKeyPoolRefillsBelowLowWatermark(t *testing.T) {
+	pool := NewKeyPool(2, 3)
+	defer pool.Close()
+	pool.Warm(testKeySpec)
+	waitForPoolSize(t, pool, testKeySpec, 3)
+
+	// Dropping to the low watermark does not refill yet
+	if _, err := pool.NextKey(context.Background(), testKeySpec); err != nil {
+		t.Fatalf("NextKey: %v", err)
+	}
+	if got := pool.Size(testKeySpec); got != 2 {
+		t.Fatalf("pool size = %d, want 2", got)
+	}
+
+	// Dropping below it refills up to the high watermark
+	if _, err := pool.NextKey(context.Background(), testKeySpec); err != nil {
+		t.Fatalf("NextKey: %v", err)
+	}
+	waitForPoolSize(t, pool, testKeySpec, 3)
+}
+
+func TestKeyPoolGeneratesWhenEmpty(t *testing.T) {
+	pool := NewKeyPool(0, 0)
+	defer pool.Close()
+
+	privateKey, err := pool.NextKey(context.Background(), testKeySpec)
+	if err != nil {
+		t.Fatalf("NextKey: %v", err)
+	}
+	if _, ok := privateKey.(*ecdsa.PrivateKey); !ok {
+		t.Errorf("NextKey returned %T, want *ecdsa.PrivateKey", privateKey)
+	}
+}
+
+func TestKeyPoolNextKeyCancelled(t *testing.T) {
+	pool := NewKeyPool(0, 1)
+	defer pool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pool.NextKey(ctx, testKeySpec); !errors.Is(err, context.Canceled) {
+		t.Fatalf("NextKey error = %v, want context.Canceled", err)
+	}
+}
+
+func TestKeyPoolCloseStopsRefills(t *testing.T) {
+	pool := NewKeyPool(1, 2)
+	pool.Close()
+
+	pool.Warm(testKeySpec)
+	if got := pool.Size(testKeySpec); got != 0 {
+		t.Errorf("closed pool size = %d, want 0", got)
+	}
+}
+
+func TestKeyPoolFeedsRotation(t *testing.T) {
+	config := testConfig(newTestClock())
+	spec := KeySpec{Algorithm: config.Algorithm, Size: config.KeySize}
+	pool := NewKeyPool(0, 1)
+	defer pool.Close()
+	pool.Warm(spec)
+	waitForPoolSize(t, pool, spec, 1)
+
+	manager := NewJwkManager(config, WithKeySource(pool))
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+	if got := pool.Size(spec); got != 0 {
+		t.Errorf("pool size after rotation = %d, want 0", got)
+	}
+}
+
+// blockingGenerator makes pool refills wait for release before each key
+// and reports on started when a key is being generated
+func blockingGenerator(pool *KeyPool) (started chan struct{}, release chan struct{}) {
+	started = make(chan struct{}, 1)
+	release = make(chan struct{})
+	pool.generate = func(spec KeySpec) (crypto.Signer, error) {
+		started <- struct{}{}
+		<-release
+		return generateKey(spec)
+	}
+	return started, release
+}
+
+func TestKeyPoolRefillStopsAtHighWatermark(t *testing.T) {
+	pool := NewKeyPool(0, 1)
+	started, release := blockingGenerator(pool)
+	pool.Warm(testKeySpec)
+	<-started
+
+	// The bucket fills up while the refill generates its key
+	privateKey, err := generateKey(testKeySpec)
+	if err != nil {
+		t.Fatalf("generateKey: %v", err)
+	}
+	pool.put(testKeySpec, privateKey)
+	close(release)
+	pool.Close()
+
+	if got := pool.Size(testKeySpec); got != 1 {
+		t.Errorf("pool size = %d, want the high watermark 1", got)
+	}
+}
+
+func TestKeyPoolRefillDiscardsKeysAfterClose(t *testing.T) {
+	pool := NewKeyPool(0, 2)
+	started, release := blockingGenerator(pool)
+	pool.Warm(testKeySpec)
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+	for {
+		pool.mutex.Lock()
+		isClosed := pool.closed
+		pool.mutex.Unlock()
+		if isClosed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-closed
+
+	if got := pool.Size(testKeySpec); got != 0 {
+		t.Errorf("closed pool size = %d, want 0", got)
+	}
+}
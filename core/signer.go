@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+)
+
+// Signer signs token digests with a key that may never leave its keystore.
+// For ECDSA algorithms SignDigest returns an ASN.1 DER signature, as
+// crypto.Signer does; for EdDSA the digest is the full signing input.
+type Signer interface {
+	KeyID() string
+	Algorithm() jwa.SignatureAlgorithm
+	Public() crypto.PublicKey
+	SignDigest(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// localSigner signs with a private key held in process memory
+type localSigner struct {
+	privateKey crypto.Signer
+	keyID      string
+	algorithm  jwa.SignatureAlgorithm
+}
+
+// NewLocalSigner creates a Signer backed by an in-memory private key
+func NewLocalSigner(privateKey crypto.Signer, keyID string, algorithm jwa.SignatureAlgorithm) (Signer, error) {
+	if err := checkKeyAlgorithm(algorithm, privateKey.Public()); err != nil {
+		return nil, err
+	}
+	return &localSigner{privateKey: privateKey, keyID: keyID, algorithm: algorithm}, nil
+}
+
+func (s *localSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *localSigner) Algorithm() jwa.SignatureAlgorithm {
+	return s.algorithm
+}
+
+func (s *localSigner) Public() crypto.PublicKey {
+	return s.privateKey.Public()
+}
+
+func (s *localSigner) SignDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.privateKey.Sign(rand.Reader, digest, SignerOptsFor(s.algorithm))
+}
+
+// SignerOptsFor returns the crypto.SignerOpts matching a JWS algorithm
+func SignerOptsFor(alg jwa.SignatureAlgorithm) crypto.SignerOpts {
+	switch alg {
+	case jwa.RS256(), jwa.ES256():
+		return crypto.SHA256
+	case jwa.RS384(), jwa.ES384():
+		return crypto.SHA384
+	case jwa.RS512(), jwa.ES512():
+		return crypto.SHA512
+	case jwa.PS256():
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	case jwa.PS384():
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA384}
+	case jwa.PS512():
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA512}
+	}
+	return crypto.Hash(0)
+}
+
+// cryptoSigner adapts a Signer to crypto.Signer for use with the JWS library
+type cryptoSigner struct {
+	ctx    context.Context
+	signer Signer
+}
+
+// AsCryptoSigner adapts signer to crypto.Signer, binding ctx to every signature
+func AsCryptoSigner(ctx context.Context, signer Signer) crypto.Signer {
+	return &cryptoSigner{ctx: ctx, signer: signer}
+}
+
+func (c *cryptoSigner) Public() crypto.PublicKey {
+	return c.signer.Public()
+}
+
+func (c *cryptoSigner) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return c.signer.SignDigest(c.ctx, digest)
+}
+
+// RemoteSignerClient is the minimal surface of a PKCS#11 session or remote
+// signing service. Keys are referenced by an opaque handle and private key
+// material is never returned.
+type RemoteSignerClient interface {
+	PublicKey(ctx context.Context, keyHandle string) (crypto.PublicKey, error)
+	Sign(ctx context.Context, keyHandle string, algorithm jwa.SignatureAlgorithm, digest []byte) ([]byte, error)
+}
+
+// remoteSigner signs through a RemoteSignerClient
+type remoteSigner struct {
+	client    RemoteSignerClient
+	keyHandle string
+	keyID     string
+	algorithm jwa.SignatureAlgorithm
+	publicKey crypto.PublicKey
+}
+
+// NewRemoteSigner creates a Signer for a key held by a remote signer or HSM.
+// The public key is fetched once and checked against algorithm.
+func NewRemoteSigner(ctx context.Context, client RemoteSignerClient, keyHandle string, keyID string, algorithm jwa.SignatureAlgorithm) (Signer, error) {
+	if keyID == "" {
+		return nil, fmt.Errorf("%w: remote signer requires a key ID", ErrInvalidKeyData)
+	}
+
+	publicKey, err := client.PublicKey(ctx, keyHandle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch public key for %s: %w", keyHandle, err)
+	}
+
+	if err := checkKeyAlgorithm(algorithm, publicKey); err != nil {
+		return nil, err
+	}
+
+	return &remoteSigner{
+		client:    client,
+		keyHandle: keyHandle,
+		keyID:     keyID,
+		algorithm: algorithm,
+		publicKey: publicKey,
+	}, nil
+}
+
+func (s *remoteSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *remoteSigner) Algorithm() jwa.SignatureAlgorithm {
+	return s.algorithm
+}
+
+func (s *remoteSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+func (s *remoteSigner) SignDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	signature, err := s.client.Sign(ctx, s.keyHandle, s.algorithm, digest)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer %s: %w", s.keyHandle, err)
+	}
+	return signature, nil
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+)
+
+// stubSignerClient is a RemoteSignerClient holding a single key
+type stubSignerClient struct {
+	privateKey crypto.Signer
+	signed     int
+}
+
+func (c *stubSignerClient) PublicKey(ctx context.Context, keyHandle string) (crypto.PublicKey, error) {
+	return c.privateKey.Public(), nil
+}
+
+func (c *stubSignerClient) Sign(ctx context.Context, keyHandle string, algorithm jwa.SignatureAlgorithm, digest []byte) ([]byte, error) {
+	c.signed++
+	return c.privateKey.Sign(rand.Reader, digest, SignerOptsFor(algorithm))
+}
+
+func TestNewLocalSignerRejectsAlgorithmMismatch(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if _, err := NewLocalSigner(privateKey, "key-a", jwa.ES256()); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Fatalf("NewLocalSigner error = %v, want ErrAlgorithmMismatch", err)
+	}
+}
+
+func TestRemoteSignerSignsThroughClient(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	client := &stubSignerClient{privateKey: privateKey}
+
+	if _, err := NewRemoteSigner(context.Background(), client, "handle", "key-remote", jwa.ES384()); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("NewRemoteSigner with ES384 error = %v, want ErrAlgorithmMismatch", err)
+	}
+	if _, err := NewRemoteSigner(context.Background(), client, "handle", "", jwa.ES256()); !errors.Is(err, ErrInvalidKeyData) {
+		t.Errorf("NewRemoteSigner without key ID error = %v, want ErrInvalidKeyData", err)
+	}
+
+	signer, err := NewRemoteSigner(context.Background(), client, "handle", "key-remote", jwa.ES256())
+	if err != nil {
+		t.Fatalf("NewRemoteSigner: %v", err)
+	}
+	digest := sha256.Sum256([]byte("payload"))
+	signature, err := AsCryptoSigner(context.Background(), signer).Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if !ecdsa.VerifyASN1(&privateKey.PublicKey, digest[:], signature) || client.signed != 1 {
+		t.Errorf("signature verified = false or client signed %d times, want one valid signature", client.signed)
+	}
+}
+
+func TestRegisterSignerKeepsKeyOutOfRotation(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := NewRemoteSigner(context.Background(), &stubSignerClient{privateKey: privateKey}, "handle", "key-hsm", jwa.ES256())
+	if err != nil {
+		t.Fatalf("NewRemoteSigner: %v", err)
+	}
+
+	manager := newTestManager(t, newTestClock())
+	if err := manager.RegisterSigner("hsm", signer); err != nil {
+		t.Fatalf("RegisterSigner: %v", err)
+	}
+
+	if err := manager.AddOrReplaceKeyToSet("hsm"); !errors.Is(err, ErrExternalSigner) {
+		t.Errorf("AddOrReplaceKeyToSet error = %v, want ErrExternalSigner", err)
+	}
+	if _, err := manager.ExportSigningKey("hsm", KeyFormatJWK); !errors.Is(err, ErrExternalSigner) {
+		t.Errorf("ExportSigningKey error = %v, want ErrExternalSigner", err)
+	}
+	got, err := manager.GetSigner("hsm")
+	if err != nil || got != signer {
+		t.Errorf("GetSigner = %v, %v, want the registered signer", got, err)
+	}
+
+	// The stored set keeps the public key only, so the signer must be registered again
+	stored, err := manager.GetJwkSetForStorage()
+	if err != nil {
+		t.Fatalf("GetJwkSetForStorage: %v", err)
+	}
+	restored := newTestManager(t, newTestClock())
+	if err := restored.GetJwkSetFromStorage(string(stored)); err != nil {
+		t.Fatalf("GetJwkSetFromStorage: %v", err)
+	}
+	if _, err := restored.GetSigner("hsm"); !errors.Is(err, ErrExternalSigner) {
+		t.Errorf("restored GetSigner error = %v, want ErrExternalSigner", err)
+	}
+	if _, _, err := restored.GetVerificationKey("key-hsm"); err != nil {
+		t.Errorf("restored GetVerificationKey: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"crypto"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// keySetSnapshot is an immutable view of the managed keys. Writers build a
+// modified copy and publish it atomically, so readers never take a lock.
+type keySetSnapshot struct {
+	set jwk.Set
+	// Keys indexed by key ID
+	jwkKeys    map[string]jwk.Key
+	publicKeys map[string]*publicKeyEntry
+	// Signing keys and metadata indexed by key prefix
+	signingKeys map[string]*cachedKey
+	metadata    map[string]*KeyMetadata
+	// Compromise records indexed by key ID
+	compromised map[string]*KeyMetadata
+}
+
+// publicKeyEntry is a pre-parsed verification key and the algorithm bound to it
+type publicKeyEntry struct {
+	publicKey crypto.PublicKey
+	algorithm jwa.SignatureAlgorithm
+}
+
+type cachedKey struct {
+	signer Signer
+	// privateKey is nil when the key is held by an external signer
+	privateKey crypto.Signer
+	keyID      string
+	algorithm  jwa.SignatureAlgorithm
+	// lastUsed holds unix nanoseconds so readers can update it without a lock
+	lastUsed atomic.Int64
+}
+
+func newCachedKey(prepared *preparedKey, now time.Time) *cachedKey {
+	cached := &cachedKey{
+		signer:     prepared.signer,
+		privateKey: prepared.privateKey,
+		keyID:      prepared.metadata.KeyID,
+		algorithm:  prepared.algorithm,
+	}
+	cached.touch(now)
+	return cached
+}
+
+func (c *cachedKey) touch(now time.Time) {
+	c.lastUsed.Store(now.UnixNano())
+}
+
+func (c *cachedKey) lastUsedAt() time.Time {
+	return time.Unix(0, c.lastUsed.Load())
+}
+
+func newKeySetSnapshot() *keySetSnapshot {
+	return &keySetSnapshot{
+		jwkKeys:     make(map[string]jwk.Key),
+		publicKeys:  make(map[string]*publicKeyEntry),
+		signingKeys: make(map[string]*cachedKey),
+		metadata:    make(map[string]*KeyMetadata),
+		compromised: make(map[string]*KeyMetadata),
+	}
+}
+
+// clone returns a copy of the snapshot that a writer may modify before sealing it
+func (s *keySetSnapshot) clone() *keySetSnapshot {
+	c := &keySetSnapshot{
+		jwkKeys:     make(map[string]jwk.Key, len(s.jwkKeys)),
+		publicKeys:  make(map[string]*publicKeyEntry, len(s.publicKeys)),
+		signingKeys: make(map[string]*cachedKey, len(s.signingKeys)),
+		metadata:    make(map[string]*KeyMetadata, len(s.metadata)),
+		compromised: make(map[string]*KeyMetadata, len(s.compromised)),
+	}
+	for k, v := range s.jwkKeys {
+		c.jwkKeys[k] = v
+	}
+	for k, v := range s.publicKeys {
+		c.publicKeys[k] = v
+	}
+	for k, v := range s.signingKeys {
+		c.signingKeys[k] = v
+	}
+	for k, v := range s.metadata {
+		c.metadata[k] = v
+	}
+	for k, v := range s.compromised {
+		c.compromised[k] = v
+	}
+	return c
+}
+
+// putKey adds or replaces the key owned by keyPrefix. Keys without a signer
+// are published for verification only.
+func (s *keySetSnapshot) putKey(keyPrefix string, prepared *preparedKey, now time.Time) {
+	if previous, exists := s.metadata[keyPrefix]; exists && previous.KeyID != prepared.metadata.KeyID {
+		delete(s.jwkKeys, previous.KeyID)
+		delete(s.publicKeys, previous.KeyID)
+	}
+
+	keyID := prepared.metadata.KeyID
+	s.jwkKeys[keyID] = prepared.key
+	s.publicKeys[keyID] = &publicKeyEntry{
+		publicKey: prepared.publicKey,
+		algorithm: prepared.algorithm,
+	}
+	if prepared.signer != nil {
+		s.signingKeys[keyPrefix] = newCachedKey(prepared, now)
+	} else {
+		delete(s.signingKeys, keyPrefix)
+	}
+	s.metadata[keyPrefix] = prepared.metadata
+}
+
+// seal builds the JWK set for the snapshot. The snapshot must not be
+// modified once it has been sealed and published.
+func (s *keySetSnapshot) seal() (*keySetSnapshot, error) {
+	keyIDs := make([]string, 0, len(s.jwkKeys))
+	for keyID := range s.jwkKeys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+
+	set := jwk.NewSet()
+	for _, keyID := range keyIDs {
+		if err := set.AddKey(s.jwkKeys[keyID]); err != nil {
+			return nil, fmt.Errorf("failed to add key to set: %w", err)
+		}
+	}
+	s.set = set
+	return s, nil
+}
@@ -0,0 +1,260 @@
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// TestSnapshotConcurrentSignRotateVerify signs, rotates and looks up keys
+// from many goroutines. Run it with -race to check that readers never see a
+// snapshot while it is being written.
+func TestSnapshotConcurrentSignRotateVerify(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	prefixes := []string{"alice", "bob", "carol"}
+	for _, prefix := range prefixes {
+		if err := manager.AddOrReplaceKeyToSet(prefix); err != nil {
+			t.Fatalf("AddOrReplaceKeyToSet(%s): %v", prefix, err)
+		}
+	}
+
+	const rounds = 50
+	digest := sha256.Sum256([]byte("payload"))
+	errs := make(chan error, 64)
+	var wg sync.WaitGroup
+
+	for _, prefix := range prefixes {
+		wg.Add(3)
+
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				if err := manager.AddOrReplaceKeyToSet(prefix); err != nil {
+					errs <- fmt.Errorf("rotate %s: %w", prefix, err)
+					return
+				}
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				signer, err := manager.GetSigner(prefix)
+				if err != nil {
+					errs <- fmt.Errorf("signer %s: %w", prefix, err)
+					return
+				}
+				signature, err := signer.SignDigest(context.Background(), digest[:])
+				if err != nil {
+					errs <- fmt.Errorf("sign %s: %w", prefix, err)
+					return
+				}
+				if !ecdsa.VerifyASN1(signer.Public().(*ecdsa.PublicKey), digest[:], signature) {
+					errs <- fmt.Errorf("signature by %s does not verify with its own key", prefix)
+					return
+				}
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			keyID := keyIDFor(prefix)
+			for range rounds {
+				publicKey, alg, err := manager.GetVerificationKey(keyID)
+				if err != nil {
+					errs <- fmt.Errorf("verification key %s: %w", keyID, err)
+					return
+				}
+				if _, ok := publicKey.(*ecdsa.PublicKey); !ok || alg.String() != "ES256" {
+					errs <- fmt.Errorf("verification key %s is %T with %s", keyID, publicKey, alg)
+					return
+				}
+				if _, err := manager.GetPublicJwkSet(); err != nil {
+					errs <- fmt.Errorf("public set: %w", err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := manager.GetKeyCount(); got != len(prefixes) {
+		t.Errorf("key count = %d, want %d", got, len(prefixes))
+	}
+}
+
+func TestSnapshotIsImmutableAfterRotation(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+	before := manager.snapshot.Load()
+	oldKey := before.publicKeys[keyIDFor("alice")].publicKey
+
+	if err := manager.AddOrReplaceKeyToSet("alice"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+	if before == manager.snapshot.Load() {
+		t.Fatal("rotation did not publish a new snapshot")
+	}
+	if before.publicKeys[keyIDFor("alice")].publicKey != oldKey {
+		t.Error("rotation modified a published snapshot")
+	}
+}
+
+// rwMutexKeySet is the lookup path used before snapshots: a JWK set
+// guarded by an RWMutex, with the raw key exported on every lookup
+type rwMutexKeySet struct {
+	mutex sync.RWMutex
+	set   jwk.Set
+}
+
+func (r *rwMutexKeySet) publicKey(keyID string) (*rsa.PublicKey, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	key, found := r.set.LookupKeyID(keyID)
+	if !found {
+		return nil, ErrKeyNotFound
+	}
+	var privateKey rsa.PrivateKey
+	if err := jwk.Export(key, &privateKey); err != nil {
+		return nil, err
+	}
+	return &privateKey.PublicKey, nil
+}
+
+const benchmarkKeyCount = 4
+
+// newBenchmarkManager returns a manager holding RSA keys, as the old lookup
+// path only supported RSA
+func newBenchmarkManager(b *testing.B) (*jwkManager, *rwMutexKeySet) {
+	b.Helper()
+	manager := NewJwkManager(DefaultConfig()).(*jwkManager)
+	for i := range benchmarkKeyCount {
+		if err := manager.AddOrReplaceKeyToSet(fmt.Sprintf("user%d", i)); err != nil {
+			b.Fatalf("AddOrReplaceKeyToSet: %v", err)
+		}
+	}
+
+	legacy := &rwMutexKeySet{set: jwk.NewSet()}
+	snapshot := manager.snapshot.Load()
+	for _, key := range snapshot.jwkKeys {
+		if err := legacy.set.AddKey(key); err != nil {
+			b.Fatalf("AddKey: %v", err)
+		}
+	}
+	return manager, legacy
+}
+
+func BenchmarkVerificationKeyLookup(b *testing.B) {
+	manager, legacy := newBenchmarkManager(b)
+	keyIDs := make([]string, benchmarkKeyCount)
+	for i := range keyIDs {
+		keyIDs[i] = keyIDFor(fmt.Sprintf("user%d", i))
+	}
+
+	b.Run("snapshot", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if _, _, err := manager.GetVerificationKey(keyIDs[i%len(keyIDs)]); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("rwmutex", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if _, err := legacy.publicKey(keyIDs[i%len(keyIDs)]); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+// BenchmarkVerificationKeyLookupDuringRotation measures lookups while a
+// writer keeps rotating another key
+func BenchmarkVerificationKeyLookupDuringRotation(b *testing.B) {
+	manager, legacy := newBenchmarkManager(b)
+	keyID := keyIDFor("user0")
+
+	// Pre-generate replacement keys so the writer only measures publishing
+	replacements := make([]*preparedKey, 8)
+	for i := range replacements {
+		prepared, err := manager.generateKey(context.Background(), "rotating")
+		if err != nil {
+			b.Fatalf("generateKey: %v", err)
+		}
+		replacements[i] = prepared
+	}
+
+	run := func(b *testing.B, rotate func(*preparedKey), lookup func() error) {
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+					rotate(replacements[i%len(replacements)])
+				}
+			}
+		}()
+
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if err := lookup(); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+		b.StopTimer()
+		close(stop)
+		wg.Wait()
+	}
+
+	b.Run("snapshot", func(b *testing.B) {
+		run(b, func(prepared *preparedKey) {
+			if err := manager.putKey("rotating", prepared, true); err != nil {
+				b.Error(err)
+			}
+		}, func() error {
+			_, _, err := manager.GetVerificationKey(keyID)
+			return err
+		})
+	})
+
+	b.Run("rwmutex", func(b *testing.B) {
+		run(b, func(prepared *preparedKey) {
+			legacy.mutex.Lock()
+			defer legacy.mutex.Unlock()
+			if existing, found := legacy.set.LookupKeyID(prepared.metadata.KeyID); found {
+				_ = legacy.set.RemoveKey(existing)
+			}
+			_ = legacy.set.AddKey(prepared.key)
+		}, func() error {
+			_, err := legacy.publicKey(keyID)
+			return err
+		})
+	})
+}
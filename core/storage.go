@@ -0,0 +1,194 @@
+package core
+
+import (
+	"crypto"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// StorageFormatVersion is the version of the document produced by GetJwkSetForStorage
+const StorageFormatVersion = 1
+
+// Private JWK members used to persist key metadata inside the stored set
+const (
+	storageVersionMember = "x-storage-version"
+	keyCreatedAtMember   = "x-created-at"
+	keyStateMember       = "x-key-state"
+	keyOwnerMember       = "x-key-owner"
+	keySignerMember      = "x-key-signer"
+	// Set-level member holding the records of compromised keys
+	compromisedKeysMember = "x-compromised-keys"
+)
+
+// keySignerExternal marks keys whose private half lives in an external signer
+const keySignerExternal = "external"
+
+// Key states recorded in KeyMetadata
+const (
+	KeyStateActive      = "active"
+	KeyStateCompromised = "compromised"
+)
+
+// keyIDFor returns the key ID used for the given key prefix
+func keyIDFor(keyPrefix string) string {
+	return fmt.Sprintf("key-%s", keyPrefix)
+}
+
+// annotateKey stores metadata on the key as private JWK members
+func annotateKey(key jwk.Key, metadata *KeyMetadata) error {
+	if alg, ok := jwa.LookupSignatureAlgorithm(metadata.Algorithm); ok {
+		if err := key.Set(jwk.AlgorithmKey, alg); err != nil {
+			return fmt.Errorf("failed to set algorithm: %w", err)
+		}
+	}
+
+	members := map[string]any{
+		keyCreatedAtMember: metadata.CreatedAt.UTC().Format(time.RFC3339Nano),
+		keyStateMember:     metadata.State,
+		keyOwnerMember:     metadata.Owner,
+	}
+	if metadata.External {
+		members[keySignerMember] = keySignerExternal
+	}
+	for name, value := range members {
+		if err := key.Set(name, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// metadataFromKey rebuilds key metadata from a stored key.
+// Keys written before the storage format was versioned carry no private
+// members, so the owner is derived from the key ID and the state defaults to active.
+func metadataFromKey(key jwk.Key, publicKey crypto.PublicKey) (*KeyMetadata, error) {
+	keyID, ok := key.KeyID()
+	if !ok || keyID == "" {
+		return nil, fmt.Errorf("%w: stored key has no key ID", ErrInvalidStorageFormat)
+	}
+
+	metadata := &KeyMetadata{
+		KeyID:   keyID,
+		State:   KeyStateActive,
+		KeySize: keySizeOf(publicKey),
+	}
+
+	if alg, ok := key.Algorithm(); ok {
+		metadata.Algorithm = alg.String()
+	} else {
+		alg, err := defaultAlgorithmFor(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		metadata.Algorithm = alg.String()
+	}
+
+	var owner string
+	if err := key.Get(keyOwnerMember, &owner); err == nil && owner != "" {
+		metadata.Owner = owner
+	} else {
+		metadata.Owner = strings.TrimPrefix(keyID, "key-")
+	}
+
+	var state string
+	if err := key.Get(keyStateMember, &state); err == nil && state != "" {
+		metadata.State = state
+	}
+
+	var signer string
+	if err := key.Get(keySignerMember, &signer); err == nil {
+		metadata.External = signer == keySignerExternal
+	}
+
+	var createdAt string
+	if err := key.Get(keyCreatedAtMember, &createdAt); err == nil && createdAt != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid created-at for key %s: %v", ErrInvalidStorageFormat, keyID, err)
+		}
+		metadata.CreatedAt = parsed
+	}
+
+	return metadata, nil
+}
+
+// storageVersionOf returns the storage format version of a parsed set.
+// Sets without a version member predate versioning and report version 0.
+func storageVersionOf(set jwk.Set) (int, error) {
+	var raw any
+	if err := set.Get(storageVersionMember, &raw); err != nil {
+		return 0, nil
+	}
+
+	switch version := raw.(type) {
+	case float64:
+		if version >= 0 && version == float64(int(version)) {
+			return int(version), nil
+		}
+	case int:
+		if version >= 0 {
+			return version, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: invalid storage version %v", ErrInvalidStorageFormat, raw)
+}
+
+// exportSigner extracts the raw private key from a stored JWK
+func exportSigner(key jwk.Key) (crypto.Signer, error) {
+	var raw any
+	if err := jwk.Export(key, &raw); err != nil {
+		return nil, fmt.Errorf("failed to export raw key: %w", err)
+	}
+
+	signer, ok := raw.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: stored key %T is not a private key", ErrUnsupportedKeyType, raw)
+	}
+	return signer, nil
+}
+
+// preparedKeyFromStorage rebuilds a stored key. Private keys regain their
+// local signer; public keys, such as those of external signers, are restored
+// for verification only.
+func preparedKeyFromStorage(key jwk.Key) (*preparedKey, error) {
+	var raw any
+	if err := jwk.Export(key, &raw); err != nil {
+		return nil, fmt.Errorf("failed to export raw key: %w", err)
+	}
+
+	privateKey, isPrivate := raw.(crypto.Signer)
+	publicKey := raw
+	if isPrivate {
+		publicKey = privateKey.Public()
+	}
+
+	metadata, err := metadataFromKey(key, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, err := lookupSignatureAlgorithm(metadata.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	prepared := &preparedKey{
+		key:       key,
+		publicKey: publicKey,
+		algorithm: alg,
+		metadata:  metadata,
+	}
+	if isPrivate {
+		signer, err := NewLocalSigner(privateKey, metadata.KeyID, alg)
+		if err != nil {
+			return nil, err
+		}
+		prepared.signer = signer
+		prepared.privateKey = privateKey
+	}
+	return prepared, nil
+}
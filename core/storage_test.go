@@ -0,0 +1,170 @@
+package core
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a settable Clock for tests
+type testClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// testConfig returns a config issuing ES256 keys, which are fast to generate
+func testConfig(clock Clock) *Config {
+	return NewConfigBuilder().WithAlgorithm("ES256").WithClock(clock).Build()
+}
+
+func newTestManager(t testing.TB, clock Clock) *jwkManager {
+	t.Helper()
+	return NewJwkManager(testConfig(clock)).(*jwkManager)
+}
+
+func TestStorageRoundTripKeepsMetadata(t *testing.T) {
+	clock := newTestClock()
+	manager := newTestManager(t, clock)
+	if err := manager.InitializeJwkSet("alice"); err != nil {
+		t.Fatalf("InitializeJwkSet: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := manager.AddOrReplaceKeyToSet("bob"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+
+	stored, err := manager.GetJwkSetForStorage()
+	if err != nil {
+		t.Fatalf("GetJwkSetForStorage: %v", err)
+	}
+
+	restored := newTestManager(t, clock)
+	if err := restored.GetJwkSetFromStorage(string(stored)); err != nil {
+		t.Fatalf("GetJwkSetFromStorage: %v", err)
+	}
+	if got := restored.GetKeyCount(); got != 2 {
+		t.Fatalf("restored %d keys, want 2", got)
+	}
+
+	for _, prefix := range []string{"alice", "bob"} {
+		want, err := manager.GetKeyMetadata(prefix)
+		if err != nil {
+			t.Fatalf("GetKeyMetadata(%s): %v", prefix, err)
+		}
+		got, err := restored.GetKeyMetadata(prefix)
+		if err != nil {
+			t.Fatalf("restored GetKeyMetadata(%s): %v", prefix, err)
+		}
+		if got.KeyID != want.KeyID || got.Owner != want.Owner || got.Algorithm != want.Algorithm ||
+			got.KeySize != want.KeySize || got.State != want.State || !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("metadata for %s = %+v, want %+v", prefix, got, want)
+		}
+	}
+
+	// The restored signing key still matches the published public key
+	signer, err := restored.GetSigner("bob")
+	if err != nil {
+		t.Fatalf("GetSigner: %v", err)
+	}
+	publicKey, _, err := restored.GetVerificationKey(signer.KeyID())
+	if err != nil {
+		t.Fatalf("GetVerificationKey: %v", err)
+	}
+	if !publicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(signer.Public()) {
+		t.Error("restored signer does not match its verification key")
+	}
+}
+
+func TestStorageLoadsUnversionedSet(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	if err := manager.InitializeJwkSet("legacy"); err != nil {
+		t.Fatalf("InitializeJwkSet: %v", err)
+	}
+	stored, err := manager.GetJwkSetForStorage()
+	if err != nil {
+		t.Fatalf("GetJwkSetForStorage: %v", err)
+	}
+
+	// Strip every private member, as written before metadata was persisted
+	var document map[string]any
+	if err := json.Unmarshal(stored, &document); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	delete(document, storageVersionMember)
+	for _, key := range document["keys"].([]any) {
+		member := key.(map[string]any)
+		for _, name := range []string{keyCreatedAtMember, keyStateMember, keyOwnerMember, "alg"} {
+			delete(member, name)
+		}
+	}
+	legacy, err := json.Marshal(document)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	restored := newTestManager(t, newTestClock())
+	if err := restored.GetJwkSetFromStorage(string(legacy)); err != nil {
+		t.Fatalf("GetJwkSetFromStorage: %v", err)
+	}
+	metadata, err := restored.GetKeyMetadata("legacy")
+	if err != nil {
+		t.Fatalf("GetKeyMetadata: %v", err)
+	}
+	if metadata.Owner != "legacy" || metadata.State != KeyStateActive || metadata.Algorithm != "ES256" {
+		t.Errorf("legacy metadata = %+v, want owner legacy, state active, algorithm ES256", metadata)
+	}
+}
+
+func TestStorageRejectsNewerVersion(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	err := manager.GetJwkSetFromStorage(`{"keys": [], "x-storage-version": 99}`)
+	if !errors.Is(err, ErrUnsupportedStorage) {
+		t.Fatalf("GetJwkSetFromStorage error = %v, want ErrUnsupportedStorage", err)
+	}
+}
+
+func TestStorageRejectsInvalidCreatedAt(t *testing.T) {
+	manager := newTestManager(t, newTestClock())
+	if err := manager.InitializeJwkSet("alice"); err != nil {
+		t.Fatalf("InitializeJwkSet: %v", err)
+	}
+	stored, err := manager.GetJwkSetForStorage()
+	if err != nil {
+		t.Fatalf("GetJwkSetForStorage: %v", err)
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal(stored, &document); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	document["keys"].([]any)[0].(map[string]any)[keyCreatedAtMember] = "yesterday"
+	corrupt, err := json.Marshal(document)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	err = newTestManager(t, newTestClock()).GetJwkSetFromStorage(string(corrupt))
+	if !errors.Is(err, ErrInvalidStorageFormat) {
+		t.Fatalf("GetJwkSetFromStorage error = %v, want ErrInvalidStorageFormat", err)
+	}
+}
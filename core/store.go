@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// KeyStore persists the serialized JWK set produced by GetJwkSetForStorage
+type KeyStore interface {
+	// Load returns ErrKeySetNotStored when nothing has been saved yet
+	Load(ctx context.Context) ([]byte, error)
+	Save(ctx context.Context, data []byte) error
+}
+
+// memoryKeyStore keeps the stored set in memory
+type memoryKeyStore struct {
+	mutex sync.RWMutex
+	data  []byte
+}
+
+// NewMemoryKeyStore creates a KeyStore that keeps the set in process memory
+func NewMemoryKeyStore() KeyStore {
+	return &memoryKeyStore{}
+}
+
+func (s *memoryKeyStore) Load(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.data == nil {
+		return nil, ErrKeySetNotStored
+	}
+	return append([]byte(nil), s.data...), nil
+}
+
+func (s *memoryKeyStore) Save(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.data = append([]byte(nil), data...)
+	return nil
+}
+
+// fileKeyStore keeps the stored set in a single file
+type fileKeyStore struct {
+	path string
+}
+
+// NewFileKeyStore creates a KeyStore that writes the set to path. The file
+// contains private keys and is created with 0600 permissions.
+func NewFileKeyStore(path string) KeyStore {
+	return &fileKeyStore{path: path}
+}
+
+func (s *fileKeyStore) Load(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrKeySetNotStored
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key store: %w", err)
+	}
+	return data, nil
+}
+
+// Save writes to a temporary file and renames it so readers never see a partial set
+func (s *fileKeyStore) Save(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create key store file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set key store permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	// Leave the previous set in place if the caller gave up during the write
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace key store: %w", err)
+	}
+	return nil
+}
@@ -7,8 +7,18 @@ type DeviceClaims struct {
 	UserID   string `json:"user_id,omitempty"`
 }
 
+// TokenResponse is an RFC 6749 access token response
 type TokenResponse struct {
-	Token     string `json:"token"`
-	ExpiresAt int64  `json:"expires_at"`
-	TokenType string `json:"token_type"`
+	AccessToken string `json:"access_token"`
+	// Deprecated: Token repeats AccessToken under its pre-RFC 6749 name and
+	// is kept for existing clients; read AccessToken instead.
+	Token        string `json:"token"`
+	ExpiresAt    int64  `json:"expires_at"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	// IssuedTokenType is set on RFC 8693 token exchange responses
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
 }
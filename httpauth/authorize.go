@@ -0,0 +1,182 @@
+package httpauth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// ErrAccessDenied is returned by a UserAuthenticator when the user refuses
+// or is not allowed to authorize the client
+var ErrAccessDenied = errors.New("access denied")
+
+// AuthenticatedUser is the resource owner approving an authorization request
+type AuthenticatedUser struct {
+	Subject string
+	// Claims are added to the tokens issued for the authorization
+	Claims map[string]any
+	// AuthTime is when the user last logged in, reported as auth_time in ID tokens
+	AuthTime time.Time
+}
+
+// UserAuthenticator tells the authorization endpoint who the user is, for
+// example from a session cookie. When the user still has to log in or
+// consent it writes that response itself, such as a redirect to a login
+// page, and returns a nil user and nil error. It returns ErrAccessDenied
+// when the user denies the request.
+type UserAuthenticator interface {
+	AuthenticateUser(w http.ResponseWriter, r *http.Request) (*AuthenticatedUser, error)
+}
+
+// UserAuthenticatorFunc adapts a function to a UserAuthenticator
+type UserAuthenticatorFunc func(w http.ResponseWriter, r *http.Request) (*AuthenticatedUser, error)
+
+func (f UserAuthenticatorFunc) AuthenticateUser(w http.ResponseWriter, r *http.Request) (*AuthenticatedUser, error) {
+	return f(w, r)
+}
+
+// authorizeHandler serves the RFC 6749 authorization endpoint
+type authorizeHandler struct {
+	clients service.ClientRegistry
+	codes   service.AuthorizationCodeStore
+	users   UserAuthenticator
+	config  *core.Config
+}
+
+// NewAuthorizeHandler returns a handler for /authorize issuing authorization
+// codes. Clients must be allowed the authorization_code grant, send one of
+// their registered redirect URIs and use PKCE with the S256 method. Codes
+// are stored in codes and expire after config.AuthorizationCodeTTL.
+func NewAuthorizeHandler(clients service.ClientRegistry, codes service.AuthorizationCodeStore, users UserAuthenticator, config *core.Config) http.Handler {
+	return &authorizeHandler{clients: clients, codes: codes, users: users, config: config}
+}
+
+func (h *authorizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, ErrorInvalidRequest, "method must be GET or POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "malformed request")
+		return
+	}
+
+	// Until the redirect URI is known to belong to the client, errors are
+	// shown to the user instead of being redirected
+	client, err := h.clients.GetClient(r.Context(), r.Form.Get("client_id"))
+	if errors.Is(err, core.ErrClientNotFound) {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "unknown client")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return
+	}
+	redirectURI := r.Form.Get("redirect_uri")
+	if redirectURI == "" || !client.AllowsRedirectURI(redirectURI) {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "redirect_uri is missing or not registered for this client")
+		return
+	}
+
+	state := r.Form.Get("state")
+	if r.Form.Get("response_type") != "code" {
+		redirectError(w, r, redirectURI, state, ErrorUnsupportedResponseType, "response_type must be code")
+		return
+	}
+	if !client.AllowsGrant(service.GrantTypeAuthorizationCode) {
+		redirectError(w, r, redirectURI, state, ErrorUnauthorizedClient, "client may not use the authorization code grant")
+		return
+	}
+
+	codeChallenge := r.Form.Get("code_challenge")
+	if codeChallenge == "" {
+		redirectError(w, r, redirectURI, state, ErrorInvalidRequest, "code_challenge is required")
+		return
+	}
+	if !service.ValidCodeChallenge(codeChallenge) {
+		redirectError(w, r, redirectURI, state, ErrorInvalidRequest, "code_challenge is malformed")
+		return
+	}
+	if r.Form.Get("code_challenge_method") != service.CodeChallengeMethodS256 {
+		redirectError(w, r, redirectURI, state, ErrorInvalidRequest, "code_challenge_method must be S256")
+		return
+	}
+
+	scope, ok := narrowScope(service.NewScope(client.Scopes...), r.Form.Get("scope"))
+	if !ok {
+		redirectError(w, r, redirectURI, state, ErrorInvalidScope, "requested scope is not allowed for this client")
+		return
+	}
+
+	user, err := h.users.AuthenticateUser(w, r)
+	if errors.Is(err, ErrAccessDenied) {
+		redirectError(w, r, redirectURI, state, ErrorAccessDenied, "the user denied the request")
+		return
+	}
+	if err != nil {
+		redirectError(w, r, redirectURI, state, ErrorServerError, "")
+		return
+	}
+	if user == nil {
+		// The authenticator has already responded
+		return
+	}
+
+	code, err := service.NewAuthorizationCode()
+	if err != nil {
+		redirectError(w, r, redirectURI, state, ErrorServerError, "")
+		return
+	}
+	authorization := &service.AuthorizationCode{
+		ClientID:      client.ID,
+		RedirectURI:   redirectURI,
+		CodeChallenge: codeChallenge,
+		Scope:         scope,
+		Subject:       user.Subject,
+		Claims:        user.Claims,
+		Nonce:         r.Form.Get("nonce"),
+		AuthTime:      user.AuthTime,
+		ExpiresAt:     h.config.Now().Add(h.config.AuthorizationCodeTTL),
+	}
+	if err := h.codes.Put(r.Context(), code, authorization); err != nil {
+		redirectError(w, r, redirectURI, state, ErrorServerError, "")
+		return
+	}
+
+	redirect(w, r, redirectURI, url.Values{"code": {code}}, state)
+}
+
+// redirectError sends an OAuth 2.0 error back to the client's redirect URI
+func redirectError(w http.ResponseWriter, r *http.Request, redirectURI string, state string, code string, description string) {
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	redirect(w, r, redirectURI, params, state)
+}
+
+// redirect adds params and state to the query of redirectURI and redirects there
+func redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values, state string) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "redirect_uri is malformed")
+		return
+	}
+
+	query := target.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	target.RawQuery = query.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
@@ -0,0 +1,210 @@
+package httpauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+const (
+	testRedirectURI  = "https://app.example/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// testCodeChallenge is the S256 challenge for testCodeVerifier
+func testCodeChallenge() string {
+	sum := sha256.Sum256([]byte(testCodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorizationServer wires the authorize and token endpoints for a public
+// client "app" allowed the authorization_code grant
+type authorizationServer struct {
+	tokens    service.TokenService
+	authorize http.Handler
+	token     http.Handler
+}
+
+func newAuthorizationServer(t *testing.T) *authorizationServer {
+	t.Helper()
+	// The user is named by the "user" request parameter
+	users := UserAuthenticatorFunc(func(w http.ResponseWriter, r *http.Request) (*AuthenticatedUser, error) {
+		return &AuthenticatedUser{Subject: r.Form.Get("user")}, nil
+	})
+	return newAuthorizationServerFor(t, &service.Client{
+		ID:           "app",
+		GrantTypes:   []string{service.GrantTypeAuthorizationCode},
+		Scopes:       []string{"profile"},
+		RedirectURIs: []string{testRedirectURI},
+	}, users)
+}
+
+// newAuthorizationServerFor wires the endpoints for client, which must be
+// named "app" and allow testRedirectURI, with users logged in by users
+func newAuthorizationServerFor(t *testing.T, client *service.Client, users UserAuthenticator) *authorizationServer {
+	t.Helper()
+	clock := authtest.NewFakeClock(testStart)
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(clock).Build()
+	clients := service.NewMemoryClientRegistry(client)
+	codes := service.NewMemoryAuthorizationCodeStore(service.WithCodeStoreClock(clock))
+	tokens := service.NewServiceFactory(config).CreateTokenService()
+	return &authorizationServer{
+		tokens:    tokens,
+		authorize: NewAuthorizeHandler(clients, codes, users, config),
+		token:     NewTokenHandler(tokens, clients, config, WithAuthorizationCodes(codes)),
+	}
+}
+
+// startAuthorization sends an authorization request and returns the
+// redirect it answers with
+func (s *authorizationServer) startAuthorization(t *testing.T, params url.Values) url.Values {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/authorize?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	s.authorize.ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("authorize status %d, body %s", w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURI) {
+		t.Fatalf("redirected to %s, want %s", location, testRedirectURI)
+	}
+	return location.Query()
+}
+
+func authorizationParams(user string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"app"},
+		"redirect_uri":          {testRedirectURI},
+		"code_challenge":        {testCodeChallenge()},
+		"code_challenge_method": {service.CodeChallengeMethodS256},
+		"scope":                 {"profile"},
+		"state":                 {"xyz"},
+		"user":                  {user},
+	}
+}
+
+// login runs the authorization code flow for user and returns the access token
+func (s *authorizationServer) login(t *testing.T, user string) string {
+	t.Helper()
+	return s.exchange(t, authorizationParams(user)).AccessToken
+}
+
+// exchange runs the authorization code flow with params and returns the
+// token response
+func (s *authorizationServer) exchange(t *testing.T, params url.Values) *core.TokenResponse {
+	t.Helper()
+	query := s.startAuthorization(t, params)
+	if query.Get("state") != "xyz" || query.Get("code") == "" {
+		t.Fatalf("redirect query %v, want a code and state xyz", query)
+	}
+	return requestToken(t, s.token, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"app"},
+		"code":          {query.Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testCodeVerifier},
+	})
+}
+
+func TestAuthorizationCodeUsersOfOneClientStayLoggedIn(t *testing.T) {
+	server := newAuthorizationServer(t)
+	aliceToken := server.login(t, "alice")
+	bobToken := server.login(t, "bob")
+
+	// Bob's login must not invalidate Alice's token
+	for user, token := range map[string]string{"alice": aliceToken, "bob": bobToken} {
+		claims, err := server.tokens.ValidateAccessToken(token)
+		if err != nil {
+			t.Fatalf("%s's token: %v", user, err)
+		}
+		if claims.Claims["sub"] != user || claims.Claims["client_id"] != "app" {
+			t.Errorf("%s's token claims = %v", user, claims.Claims)
+		}
+	}
+}
+
+func TestAuthorizationCodeDropsInternalClaims(t *testing.T) {
+	users := UserAuthenticatorFunc(func(w http.ResponseWriter, r *http.Request) (*AuthenticatedUser, error) {
+		return &AuthenticatedUser{Subject: "alice", Claims: map[string]any{
+			"email":                   "alice@example.com",
+			"jti":                     "forged",
+			"iat":                     1,
+			"exp":                     2,
+			"nbf":                     3,
+			"kid":                     "forged",
+			"purpose":                 "forged",
+			service.TokenFamilyClaim:  "forged",
+			service.ConfirmationClaim: map[string]any{"jkt": "forged"},
+		}}, nil
+	})
+	server := newAuthorizationServerFor(t, &service.Client{
+		ID:           "app",
+		GrantTypes:   []string{service.GrantTypeAuthorizationCode, service.GrantTypeRefreshToken},
+		Scopes:       []string{ScopeOpenID, "profile"},
+		RedirectURIs: []string{testRedirectURI},
+	}, users)
+	params := authorizationParams("alice")
+	params.Set("scope", ScopeOpenID+" profile")
+	response := server.exchange(t, params)
+
+	accessClaims, err := server.tokens.ValidateAccessToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("access token: %v", err)
+	}
+	refreshClaims, err := server.tokens.ValidateRefreshToken(response.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh token: %v", err)
+	}
+	idClaims, err := server.tokens.ValidateIDToken(response.IDToken, "app", "")
+	if err != nil {
+		t.Fatalf("ID token: %v", err)
+	}
+	for name, claims := range map[string]*service.TokenClaims{"access": accessClaims, "refresh": refreshClaims, "id": idClaims} {
+		if claims.Claims["email"] != "alice@example.com" {
+			t.Errorf("%s token email = %v, want the user's claim", name, claims.Claims["email"])
+		}
+		for _, claim := range []string{"jti", "kid", "purpose", service.TokenFamilyClaim} {
+			if claims.Claims[claim] == "forged" {
+				t.Errorf("%s token %s was taken from the user's claims", name, claim)
+			}
+		}
+		if claims.DPoPThumbprint() != "" {
+			t.Errorf("%s token has a cnf claim from the user's claims", name)
+		}
+		if !claims.IssuedAt.Equal(testStart) {
+			t.Errorf("%s token iat = %s, want %s", name, claims.IssuedAt, testStart)
+		}
+	}
+}
+
+func TestAuthorizeRejectsMalformedCodeChallenge(t *testing.T) {
+	server := newAuthorizationServer(t)
+	challenges := map[string]string{
+		"too short":          "abc",
+		"too long":           strings.Repeat("a", 129),
+		"reserved character": testCodeChallenge()[:42] + "+",
+	}
+	for name, challenge := range challenges {
+		t.Run(name, func(t *testing.T) {
+			params := authorizationParams("alice")
+			params.Set("code_challenge", challenge)
+			query := server.startAuthorization(t, params)
+			if query.Get("error") != ErrorInvalidRequest || query.Get("code") != "" {
+				t.Errorf("redirect query %v, want invalid_request and no code", query)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Package httpauth provides net/http handlers for the OAuth 2.0 endpoints
+// built on jwk-auth services.
+package httpauth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// ErrInvalidClient is returned by a ClientAuthenticator that rejects the caller
+var ErrInvalidClient = errors.New("client authentication failed")
+
+// ClientAuthenticator identifies the client calling an endpoint, for example
+// from HTTP Basic credentials. It returns ErrInvalidClient when the request
+// does not carry valid client credentials.
+type ClientAuthenticator interface {
+	AuthenticateClient(r *http.Request) (clientID string, err error)
+}
+
+// ClientAuthenticatorFunc adapts a function to a ClientAuthenticator
+type ClientAuthenticatorFunc func(r *http.Request) (string, error)
+
+func (f ClientAuthenticatorFunc) AuthenticateClient(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// clientSecretAuthenticator authenticates clients from a ClientRegistry
+type clientSecretAuthenticator struct {
+	registry service.ClientRegistry
+}
+
+// NewClientSecretAuthenticator authenticates registered clients with HTTP
+// Basic credentials or client_id/client_secret form parameters. Public
+// clients identify themselves with client_id alone.
+func NewClientSecretAuthenticator(registry service.ClientRegistry) ClientAuthenticator {
+	return &clientSecretAuthenticator{registry: registry}
+}
+
+func (a *clientSecretAuthenticator) AuthenticateClient(r *http.Request) (string, error) {
+	client, err := authenticateRegisteredClient(r, a.registry)
+	if err != nil {
+		return "", err
+	}
+	return client.ID, nil
+}
+
+// authenticateRegisteredClient returns the registered client making r. The
+// request form must already be parsed.
+func authenticateRegisteredClient(r *http.Request, registry service.ClientRegistry) (*service.Client, error) {
+	clientID, secret, hasSecret, err := clientCredentials(r)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := registry.GetClient(r.Context(), clientID)
+	if errors.Is(err, core.ErrClientNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.IsPublic() {
+		if hasSecret {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+	if !hasSecret || !service.VerifyClientSecret(client.SecretHash, secret) {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// clientCredentials reads client credentials from the Authorization header
+// or, failing that, from the form body (RFC 6749 section 2.3.1)
+func clientCredentials(r *http.Request) (clientID, secret string, hasSecret bool, err error) {
+	if username, password, ok := r.BasicAuth(); ok {
+		if r.PostForm.Get("client_secret") != "" {
+			// Clients must not use more than one authentication method
+			return "", "", false, ErrInvalidClient
+		}
+		clientID, err = url.QueryUnescape(username)
+		if err != nil {
+			return "", "", false, ErrInvalidClient
+		}
+		secret, err = url.QueryUnescape(password)
+		if err != nil {
+			return "", "", false, ErrInvalidClient
+		}
+		return clientID, secret, true, nil
+	}
+
+	clientID = r.PostForm.Get("client_id")
+	if clientID == "" {
+		return "", "", false, ErrInvalidClient
+	}
+	secret = r.PostForm.Get("client_secret")
+	return clientID, secret, secret != "", nil
+}
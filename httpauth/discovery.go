@@ -0,0 +1,118 @@
+package httpauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// ScopeOpenID marks OpenID Connect requests; the token endpoint adds an ID
+// token when it is granted
+const ScopeOpenID = "openid"
+
+// ProviderMetadata is the OpenID Connect discovery document served at
+// /.well-known/openid-configuration
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint,omitempty"`
+	RevocationEndpoint                string   `json:"revocation_endpoint,omitempty"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+	ClaimsSupported                   []string `json:"claims_supported,omitempty"`
+}
+
+// NewProviderMetadata describes a provider at config.Issuer that serves the
+// handlers of this package under their usual paths. Adjust the returned
+// fields if the handlers are mounted elsewhere.
+func NewProviderMetadata(config *core.Config) *ProviderMetadata {
+	issuer := strings.TrimSuffix(config.Issuer, "/")
+	return &ProviderMetadata{
+		Issuer:                 issuer,
+		AuthorizationEndpoint:  issuer + "/authorize",
+		TokenEndpoint:          issuer + "/token",
+		UserInfoEndpoint:       issuer + "/userinfo",
+		JWKSURI:                issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:  issuer + "/introspect",
+		RevocationEndpoint:     issuer + "/revoke",
+		ScopesSupported:        []string{ScopeOpenID},
+		ResponseTypesSupported: []string{"code"},
+		GrantTypesSupported: []string{
+			service.GrantTypeAuthorizationCode,
+			service.GrantTypeRefreshToken,
+			service.GrantTypeClientCredentials,
+			service.GrantTypeTokenExchange,
+		},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{config.Algorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{service.CodeChallengeMethodS256},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash"},
+	}
+}
+
+// NewDiscoveryHandler returns a handler for GET /.well-known/openid-configuration
+// serving metadata. The document is encoded once, so later changes to
+// metadata are not picked up.
+func NewDiscoveryHandler(metadata *ProviderMetadata) http.Handler {
+	document, err := json.Marshal(metadata)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowGet(w, r) {
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		_, _ = w.Write(document)
+	})
+}
+
+// NewJWKSHandler returns a handler for GET /.well-known/jwks.json serving
+// the public verification keys of keys. Private key material is never
+// included.
+func NewJWKSHandler(keys service.KeyService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowGet(w, r) {
+			return
+		}
+
+		document, err := keys.ExportJWKSContext(r.Context())
+		if errors.Is(err, core.ErrJWKSetNotInitialized) {
+			document, err = []byte(`{"keys":[]}`), nil
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+			return
+		}
+
+		// Keys rotate, so caches must not hold on to the set for long
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_, _ = w.Write(document)
+	})
+}
+
+// allowGet accepts only GET and HEAD requests
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, ErrorInvalidRequest, "method must be GET")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package httpauth
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+func TestProviderMetadataListsTokenEndpointGrants(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(clock).WithIssuer("https://auth.example").Build()
+	grantTypes := []string{
+		service.GrantTypeAuthorizationCode,
+		service.GrantTypeRefreshToken,
+		service.GrantTypeClientCredentials,
+		service.GrantTypeTokenExchange,
+	}
+	clients := service.NewMemoryClientRegistry(&service.Client{
+		ID:         "backend",
+		SecretHash: testSecretHash(t, "s3cret"),
+		GrantTypes: grantTypes,
+	})
+	tokens := service.NewServiceFactory(config).CreateTokenService()
+	handler := NewTokenHandler(tokens, clients, config,
+		WithAuthorizationCodes(service.NewMemoryAuthorizationCodeStore(service.WithCodeStoreClock(clock))))
+	metadata := NewProviderMetadata(config)
+
+	for _, grantType := range grantTypes {
+		if !slices.Contains(metadata.GrantTypesSupported, grantType) {
+			t.Errorf("grant_types_supported = %q, missing %s", metadata.GrantTypesSupported, grantType)
+		}
+		// The endpoint accepts the grant and only objects to the missing parameters
+		w := postForm(handler, url.Values{"grant_type": {grantType}, "client_id": {"backend"}, "client_secret": {"s3cret"}})
+		if body := decodeBody[ErrorResponse](t, w); body.Error == ErrorUnsupportedGrantType {
+			t.Errorf("token endpoint does not support %s", grantType)
+		}
+	}
+}
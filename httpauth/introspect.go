@@ -0,0 +1,42 @@
+package httpauth
+
+import (
+	"net/http"
+
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// introspectionHandler serves RFC 7662 token introspection
+type introspectionHandler struct {
+	tokens  service.TokenService
+	clients ClientAuthenticator
+}
+
+// NewIntrospectionHandler returns a handler for POST /introspect. Callers
+// must authenticate through clients; the token is passed in the "token"
+// form parameter and "token_type_hint" is accepted but not needed.
+func NewIntrospectionHandler(tokens service.TokenService, clients ClientAuthenticator) http.Handler {
+	return &introspectionHandler{tokens: tokens, clients: clients}
+}
+
+func (h *introspectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !parsePostForm(w, r) {
+		return
+	}
+	if _, ok := authenticateClient(w, r, h.clients); !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "missing token parameter")
+		return
+	}
+
+	response, err := h.tokens.IntrospectContext(r.Context(), token)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
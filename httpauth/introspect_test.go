@@ -0,0 +1,90 @@
+package httpauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+var testStart = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newTestTokenService returns a token service issuing ES256 tokens on clock
+func newTestTokenService(t *testing.T, clock core.Clock, opts ...service.FactoryOption) service.TokenService {
+	t.Helper()
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(clock).WithTokenExpiry(time.Hour).Build()
+	return service.NewServiceFactory(config, opts...).CreateTokenService()
+}
+
+// authenticateAs accepts every request as coming from clientID
+func authenticateAs(clientID string) ClientAuthenticator {
+	return ClientAuthenticatorFunc(func(*http.Request) (string, error) { return clientID, nil })
+}
+
+// postForm serves a form POST through handler
+func postForm(handler http.Handler, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// decodeBody decodes a JSON response body into a value of type T
+func decodeBody[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var body T
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+func TestIntrospectionHandler(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	tokens := newTestTokenService(t, clock, service.WithOpaqueTokens(service.NewMemoryTokenStore()))
+	token, err := tokens.CreateAccessToken(map[string]any{"sub": "alice", "scope": "read"}, "partner")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	handler := NewIntrospectionHandler(tokens, authenticateAs("resource-server"))
+
+	w := postForm(handler, url.Values{"token": {token}})
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("status %d, Cache-Control %q, want 200 and no-store", w.Code, w.Header().Get("Cache-Control"))
+	}
+	response := decodeBody[service.IntrospectionResponse](t, w)
+	if !response.Active || response.Subject != "alice" || response.Scope != "read" {
+		t.Errorf("response = %+v, want active token for alice with scope read", response)
+	}
+
+	clock.Advance(time.Hour)
+	if response := decodeBody[service.IntrospectionResponse](t, postForm(handler, url.Values{"token": {token}})); response.Active {
+		t.Errorf("expired token response = %+v, want inactive", response)
+	}
+}
+
+func TestIntrospectionHandlerErrors(t *testing.T) {
+	tokens := newTestTokenService(t, authtest.NewFakeClock(testStart))
+
+	w := postForm(NewIntrospectionHandler(tokens, authenticateAs("resource-server")), url.Values{})
+	if body := decodeBody[ErrorResponse](t, w); w.Code != http.StatusBadRequest || body.Error != ErrorInvalidRequest {
+		t.Errorf("missing token: status %d, body %+v, want 400 invalid_request", w.Code, body)
+	}
+
+	rejectAll := ClientAuthenticatorFunc(func(*http.Request) (string, error) { return "", ErrInvalidClient })
+	w = postForm(NewIntrospectionHandler(tokens, rejectAll), url.Values{"token": {"anything"}})
+	if body := decodeBody[ErrorResponse](t, w); w.Code != http.StatusUnauthorized || body.Error != ErrorInvalidClient {
+		t.Errorf("unauthenticated: status %d, body %+v, want 401 invalid_client", w.Code, body)
+	}
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Error("unauthenticated response has no WWW-Authenticate header")
+	}
+}
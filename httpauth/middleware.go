@@ -0,0 +1,218 @@
+package httpauth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// Authorization schemes and the DPoP proof header
+const (
+	schemeBearer = "Bearer"
+	schemeDPoP   = "DPoP"
+	headerDPoP   = "DPoP"
+)
+
+// claimsContextKey is the context key for the claims of an authenticated request
+type claimsContextKey struct{}
+
+// ClaimsFromContext returns the access token claims stored by Authenticate
+func ClaimsFromContext(ctx context.Context) (*service.TokenClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*service.TokenClaims)
+	return claims, ok
+}
+
+// ContextWithClaims returns a copy of ctx carrying claims, for handlers
+// that authenticate requests themselves
+func ContextWithClaims(ctx context.Context, claims *service.TokenClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+type middleware struct {
+	tokens            service.TokenService
+	dpop              service.DPoPVerifier
+	requestURL        func(r *http.Request) string
+	clientCertificate func(r *http.Request) *x509.Certificate
+}
+
+// MiddlewareOption configures Authenticate
+type MiddlewareOption func(*middleware)
+
+// WithDPoP accepts DPoP-bound access tokens, checking their proofs with verifier
+func WithDPoP(verifier service.DPoPVerifier) MiddlewareOption {
+	return func(m *middleware) {
+		m.dpop = verifier
+	}
+}
+
+// WithRequestURL sets how the public URL of a request is determined for
+// DPoP htu checks, for example behind a reverse proxy
+func WithRequestURL(requestURL func(r *http.Request) string) MiddlewareOption {
+	return func(m *middleware) {
+		m.requestURL = requestURL
+	}
+}
+
+// WithClientCertificate sets how the client certificate of a request is
+// found for certificate-bound tokens, for example from a header set by a
+// TLS-terminating proxy. By default it is the first peer certificate of the
+// request's TLS connection.
+func WithClientCertificate(clientCertificate func(r *http.Request) *x509.Certificate) MiddlewareOption {
+	return func(m *middleware) {
+		m.clientCertificate = clientCertificate
+	}
+}
+
+// Authenticate returns middleware that requires a valid access token in the
+// Authorization header and stores its claims in the request context.
+// Tokens bound to a DPoP key must be sent with the DPoP scheme and a proof
+// made with that key; unbound tokens use the Bearer scheme. Tokens bound to
+// a client certificate are only accepted over a connection presenting that
+// certificate.
+func Authenticate(tokens service.TokenService, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	m := newMiddleware(tokens, opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := m.authenticate(w, r)
+			if !ok {
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+func newMiddleware(tokens service.TokenService, opts []MiddlewareOption) *middleware {
+	m := &middleware{
+		tokens:            tokens,
+		requestURL:        requestURL,
+		clientCertificate: peerCertificate,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// authenticate validates the request's access token and any DPoP proof,
+// writing the error response on failure
+func (m *middleware) authenticate(w http.ResponseWriter, r *http.Request) (*service.TokenClaims, bool) {
+	scheme, token, ok := authorizationToken(r)
+	if !ok || (scheme == schemeDPoP && m.dpop == nil) {
+		m.challenge(w, http.StatusUnauthorized, "", "")
+		return nil, false
+	}
+
+	claims, err := m.tokens.ValidateAccessTokenContext(r.Context(), token)
+	var validationErr *core.ValidationError
+	if errors.As(err, &validationErr) {
+		m.challenge(w, http.StatusUnauthorized, ErrorInvalidToken, "access token is invalid, expired or revoked")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return nil, false
+	}
+
+	if claims.CertificateThumbprint() != "" {
+		err := service.CheckCertificateBinding(claims, m.clientCertificate(r))
+		if errors.As(err, &validationErr) {
+			m.challenge(w, http.StatusUnauthorized, ErrorCertificateMismatch, "access token is bound to a different client certificate")
+			return nil, false
+		}
+	}
+
+	if claims.DPoPThumbprint() == "" {
+		if scheme != schemeBearer {
+			m.challenge(w, http.StatusUnauthorized, ErrorInvalidToken, "access token is not DPoP-bound")
+			return nil, false
+		}
+		return claims, true
+	}
+
+	// Bound tokens are useless without a proof from the bound key
+	if scheme != schemeDPoP || m.dpop == nil {
+		m.challenge(w, http.StatusUnauthorized, ErrorInvalidToken, "access token is DPoP-bound")
+		return nil, false
+	}
+	proofs := r.Header.Values(headerDPoP)
+	if len(proofs) != 1 {
+		m.challenge(w, http.StatusUnauthorized, ErrorInvalidDPoPProof, "exactly one DPoP proof is required")
+		return nil, false
+	}
+	proof, err := m.dpop.VerifyProof(r.Context(), proofs[0], r.Method, m.requestURL(r), token)
+	if err == nil {
+		err = service.CheckDPoPBinding(claims, proof)
+	}
+	if errors.As(err, &validationErr) {
+		m.challenge(w, http.StatusUnauthorized, ErrorInvalidDPoPProof, "DPoP proof is invalid")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return nil, false
+	}
+	return claims, true
+}
+
+// challenge writes an error response with WWW-Authenticate challenges for
+// the schemes this middleware accepts
+func (m *middleware) challenge(w http.ResponseWriter, status int, code string, description string) {
+	var errorParams string
+	if code != "" {
+		errorParams = fmt.Sprintf(` error=%q, error_description=%q`, code, description)
+	}
+	if code == ErrorInvalidDPoPProof {
+		// Proof errors only concern the DPoP scheme
+		w.Header().Add("WWW-Authenticate", schemeDPoP+errorParams)
+	} else {
+		w.Header().Add("WWW-Authenticate", schemeBearer+errorParams)
+		if m.dpop != nil {
+			w.Header().Add("WWW-Authenticate", schemeDPoP+errorParams)
+		}
+	}
+
+	if code == "" {
+		code, description = ErrorInvalidRequest, "missing access token"
+	}
+	writeError(w, status, code, description)
+}
+
+// authorizationToken reads a Bearer or DPoP token from the Authorization header
+func authorizationToken(r *http.Request) (scheme string, token string, ok bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !found || token == "" {
+		return "", "", false
+	}
+	switch {
+	case strings.EqualFold(scheme, schemeBearer):
+		return schemeBearer, token, true
+	case strings.EqualFold(scheme, schemeDPoP):
+		return schemeDPoP, token, true
+	}
+	return "", "", false
+}
+
+// peerCertificate returns the client certificate of r's TLS connection, if any
+func peerCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// requestURL reconstructs the URL a client used to reach r, without query
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.EscapedPath()
+}
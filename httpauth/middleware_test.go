@@ -0,0 +1,170 @@
+package httpauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// newTestCertificate returns a self-signed client certificate for name
+func newTestCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    testStart,
+		NotAfter:     testStart.Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert
+}
+
+// withPeerCertificate makes r arrive over mutual TLS with cert, or over
+// plain HTTP when cert is nil
+func withPeerCertificate(r *http.Request, cert *x509.Certificate) *http.Request {
+	if cert != nil {
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	}
+	return r
+}
+
+// protectedHandler answers 200 with the subject of the authenticated token
+func protectedHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			t.Error("handler reached without claims in the context")
+		}
+		subject, _ := claims.Claims["sub"].(string)
+		_, _ = w.Write([]byte(subject))
+	})
+}
+
+// getWithToken sends a GET with a Bearer token to handler
+func getWithToken(handler http.Handler, token string, cert *x509.Certificate) *httptest.ResponseRecorder {
+	r := withPeerCertificate(httptest.NewRequest(http.MethodGet, "/api", nil), cert)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthenticateBearerToken(t *testing.T) {
+	tokens := newTestTokenService(t, authtest.NewFakeClock(testStart))
+	token, err := tokens.CreateAccessToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	handler := Authenticate(tokens)(protectedHandler(t))
+
+	if w := getWithToken(handler, token, nil); w.Code != http.StatusOK || w.Body.String() != "alice" {
+		t.Errorf("valid token: status %d, body %q", w.Code, w.Body.String())
+	}
+
+	w := getWithToken(handler, "", nil)
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer") {
+		t.Errorf("missing token: status %d, WWW-Authenticate %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+	w = getWithToken(handler, "not-a-token", nil)
+	if body := decodeBody[ErrorResponse](t, w); w.Code != http.StatusUnauthorized || body.Error != ErrorInvalidToken {
+		t.Errorf("invalid token: status %d, body %+v", w.Code, body)
+	}
+}
+
+func TestAuthenticateCertificateBoundToken(t *testing.T) {
+	tokens := newTestTokenService(t, authtest.NewFakeClock(testStart))
+	cert := newTestCertificate(t, "billing")
+	claims := map[string]any{"sub": "billing"}
+	service.BindCertificate(claims, cert)
+	token, err := tokens.CreateAccessToken(claims, "mesh")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	handler := Authenticate(tokens)(protectedHandler(t))
+
+	if w := getWithToken(handler, token, cert); w.Code != http.StatusOK {
+		t.Errorf("bound certificate: status %d, body %s", w.Code, w.Body.String())
+	}
+	for name, other := range map[string]*x509.Certificate{"other certificate": newTestCertificate(t, "orders"), "no certificate": nil} {
+		w := getWithToken(handler, token, other)
+		if body := decodeBody[ErrorResponse](t, w); w.Code != http.StatusUnauthorized || body.Error != ErrorCertificateMismatch {
+			t.Errorf("%s: status %d, body %+v, want 401 %s", name, w.Code, body, ErrorCertificateMismatch)
+		}
+	}
+}
+
+func TestAuthenticateClientCertificateFromProxy(t *testing.T) {
+	tokens := newTestTokenService(t, authtest.NewFakeClock(testStart))
+	cert := newTestCertificate(t, "billing")
+	claims := map[string]any{"sub": "billing"}
+	service.BindCertificate(claims, cert)
+	token, err := tokens.CreateAccessToken(claims, "mesh")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+
+	// A TLS-terminating proxy passes the certificate on out of band
+	fromProxy := WithClientCertificate(func(*http.Request) *x509.Certificate { return cert })
+	handler := Authenticate(tokens, fromProxy)(protectedHandler(t))
+	if w := getWithToken(handler, token, nil); w.Code != http.StatusOK {
+		t.Errorf("status %d, body %s, want 200", w.Code, w.Body.String())
+	}
+}
+
+func TestTokenEndpointBindsClientCertificate(t *testing.T) {
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(authtest.NewFakeClock(testStart)).Build()
+	tokens := service.NewServiceFactory(config).CreateTokenService()
+	clients := service.NewMemoryClientRegistry(&service.Client{
+		ID:         "billing",
+		SecretHash: testSecretHash(t, "s3cret"),
+		GrantTypes: []string{service.GrantTypeClientCredentials},
+	})
+	handler := NewTokenHandler(tokens, clients, config, WithCertificateBinding())
+	cert := newTestCertificate(t, "billing")
+
+	form := url.Values{"grant_type": {"client_credentials"}, "client_id": {"billing"}, "client_secret": {"s3cret"}}
+	r := withPeerCertificate(httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode())), cert)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", w.Code, w.Body.String())
+	}
+
+	response := decodeBody[core.TokenResponse](t, w)
+	claims, err := tokens.ValidateAccessToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.CertificateThumbprint() != service.CertificateThumbprint(cert) {
+		t.Errorf("token bound to %q, want the client certificate", claims.CertificateThumbprint())
+	}
+}
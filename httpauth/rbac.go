@@ -0,0 +1,37 @@
+package httpauth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// RequirePermission returns middleware that lets a request through only if
+// authorizer grants permission to the roles of its access token. Apply it
+// per route, chained after Authenticate, whose claims it reads. Requests
+// without the permission get 403 access_denied.
+func RequirePermission(authorizer service.Authorizer, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				w.Header().Add("WWW-Authenticate", schemeBearer)
+				writeError(w, http.StatusUnauthorized, ErrorInvalidRequest, "missing access token")
+				return
+			}
+
+			err := authorizer.Authorize(claims, permission)
+			if errors.Is(err, core.ErrPermissionDenied) {
+				writeError(w, http.StatusForbidden, ErrorAccessDenied, "access token does not grant the required permission")
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
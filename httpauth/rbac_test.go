@@ -0,0 +1,79 @@
+package httpauth
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// failingAuthorizer fails every check with err
+type failingAuthorizer struct {
+	service.Authorizer
+	err error
+}
+
+func (a failingAuthorizer) Authorize(claims *service.TokenClaims, permission string) error {
+	return a.err
+}
+
+func TestRequirePermission(t *testing.T) {
+	policy, err := service.ParseRolePolicy([]byte(`{
+  "role_claim": "groups",
+  "roles": {
+    "viewer": {"permissions": ["articles:read"]},
+    "editor": {"permissions": ["articles:write"], "inherits": ["viewer"]}
+  }
+}`))
+	if err != nil {
+		t.Fatalf("ParseRolePolicy: %v", err)
+	}
+	authorizer, err := service.NewRoleAuthorizer(policy)
+	if err != nil {
+		t.Fatalf("NewRoleAuthorizer: %v", err)
+	}
+
+	tokens := newTestTokenService(t, authtest.NewFakeClock(testStart))
+	token, err := tokens.CreateAccessToken(map[string]any{"sub": "alice", "groups": []string{"viewer"}}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	protect := Authenticate(tokens)
+
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		wantStatus int
+		wantError  string
+	}{
+		{"granted", RequirePermission(authorizer, "articles:read"), http.StatusOK, ""},
+		{"denied", RequirePermission(authorizer, "articles:write"), http.StatusForbidden, ErrorAccessDenied},
+		{"authorizer failure", RequirePermission(failingAuthorizer{err: errors.New("policy unavailable")}, "articles:read"),
+			http.StatusInternalServerError, ErrorServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getWithToken(protect(tt.middleware(protectedHandler(t))), token, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d, body %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantError == "" {
+				return
+			}
+			if body := decodeBody[ErrorResponse](t, w); body.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", body.Error, tt.wantError)
+			}
+		})
+	}
+
+	t.Run("without authenticate", func(t *testing.T) {
+		handler := RequirePermission(authorizer, "articles:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler reached without claims")
+		}))
+		if w := getWithToken(handler, token, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package httpauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// OAuth 2.0 error codes used in error responses
+const (
+	ErrorInvalidRequest       = "invalid_request"
+	ErrorInvalidClient        = "invalid_client"
+	ErrorInvalidGrant         = "invalid_grant"
+	ErrorUnauthorizedClient   = "unauthorized_client"
+	ErrorUnsupportedGrantType = "unsupported_grant_type"
+	ErrorInvalidScope         = "invalid_scope"
+	ErrorServerError          = "server_error"
+
+	ErrorInvalidTarget           = "invalid_target"
+	ErrorAccessDenied            = "access_denied"
+	ErrorUnsupportedResponseType = "unsupported_response_type"
+
+	// Bearer token errors from RFC 6750
+	ErrorInvalidToken      = "invalid_token"
+	ErrorInsufficientScope = "insufficient_scope"
+	// DPoP proof errors from RFC 9449
+	ErrorInvalidDPoPProof = "invalid_dpop_proof"
+	// Sent when a certificate-bound token is used without its certificate
+	ErrorCertificateMismatch = "certificate_mismatch"
+)
+
+// ErrorResponse is an OAuth 2.0 error response body
+type ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// writeJSON writes body as an uncacheable JSON response
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes an OAuth 2.0 error response
+func writeError(w http.ResponseWriter, status int, code string, description string) {
+	writeJSON(w, status, ErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// authenticateClient runs clients and writes the error response on failure
+func authenticateClient(w http.ResponseWriter, r *http.Request, clients ClientAuthenticator) (string, bool) {
+	clientID, err := clients.AuthenticateClient(r)
+	if errors.Is(err, ErrInvalidClient) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		writeError(w, http.StatusUnauthorized, ErrorInvalidClient, "client authentication failed")
+		return "", false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return "", false
+	}
+	return clientID, true
+}
+
+// parsePostForm accepts only POST requests with form-encoded bodies
+func parsePostForm(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, ErrorInvalidRequest, "method must be POST")
+		return false
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "malformed form body")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package httpauth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// revocationHandler serves RFC 7009 token revocation
+type revocationHandler struct {
+	tokens  service.TokenService
+	clients ClientAuthenticator
+}
+
+// NewRevocationHandler returns a handler for POST /revoke. Callers must
+// authenticate through clients and can only revoke their own tokens. As
+// RFC 7009 requires, the response is 200 whether or not the token was valid,
+// so the endpoint cannot be used to probe tokens.
+func NewRevocationHandler(tokens service.TokenService, clients ClientAuthenticator) http.Handler {
+	return &revocationHandler{tokens: tokens, clients: clients}
+}
+
+func (h *revocationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !parsePostForm(w, r) {
+		return
+	}
+	clientID, ok := authenticateClient(w, r, h.clients)
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "missing token parameter")
+		return
+	}
+
+	err := h.tokens.RevokeTokenContext(r.Context(), token, r.PostForm.Get("token_type_hint"), clientID)
+	if err != nil && !errors.Is(err, core.ErrTokenNotOwned) {
+		// The token may still be valid, so the client should retry
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, ErrorServerError, "token could not be revoked")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
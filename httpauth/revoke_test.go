@@ -0,0 +1,69 @@
+package httpauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// revokeErrorService fails every revocation with err
+type revokeErrorService struct {
+	service.TokenService
+	err error
+}
+
+func (s revokeErrorService) RevokeTokenContext(context.Context, string, string, string) error {
+	return s.err
+}
+
+func TestRevocationHandler(t *testing.T) {
+	tokens := newTestTokenService(t, authtest.NewFakeClock(testStart))
+	issue := func(keyPrefix string, claims map[string]any) string {
+		t.Helper()
+		token, err := tokens.CreateAccessToken(claims, keyPrefix)
+		if err != nil {
+			t.Fatalf("CreateAccessToken: %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantActive bool
+	}{
+		{"own token", issue("own", map[string]any{"sub": "alice", "client_id": "partner"}), false},
+		{"another client's token", issue("other", map[string]any{"sub": "alice", "client_id": "other"}), true},
+		{"token without owner", issue("unowned", map[string]any{"sub": "alice"}), true},
+		{"unknown token", "not-a-token", false},
+	}
+	handler := NewRevocationHandler(tokens, authenticateAs("partner"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postForm(handler, url.Values{"token": {tt.token}})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d, want 200", w.Code)
+			}
+			if tt.token == "not-a-token" {
+				return
+			}
+			_, err := tokens.ValidateAccessToken(tt.token)
+			if active := err == nil; active != tt.wantActive {
+				t.Errorf("token active = %v (%v), want %v", active, err, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestRevocationHandlerStoreFailure(t *testing.T) {
+	tokens := revokeErrorService{err: errors.New("store unavailable")}
+	w := postForm(NewRevocationHandler(tokens, authenticateAs("partner")), url.Values{"token": {"anything"}})
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("status %d, Retry-After %q, want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,52 @@
+package httpauth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// RequireAll returns middleware that lets a request through only if its
+// access token was granted every one of scopes, directly or through a
+// wildcard scope such as data:*. It reads the claims stored by
+// Authenticate, so it must be chained after it.
+func RequireAll(scopes ...string) func(http.Handler) http.Handler {
+	required := service.NewScope(scopes...)
+	return requireScope(required, func(claims *service.TokenClaims) bool {
+		return claims.Scope().ContainsAll(required)
+	})
+}
+
+// RequireAny returns middleware that lets a request through only if its
+// access token was granted at least one of scopes. Like RequireAll, it must
+// be chained after Authenticate.
+func RequireAny(scopes ...string) func(http.Handler) http.Handler {
+	required := service.NewScope(scopes...)
+	return requireScope(required, func(claims *service.TokenClaims) bool {
+		return claims.Scope().ContainsAny(required)
+	})
+}
+
+// requireScope rejects requests whose claims fail granted with 403 and an
+// insufficient_scope challenge naming the required scope (RFC 6750)
+func requireScope(required service.Scope, granted func(*service.TokenClaims) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				w.Header().Add("WWW-Authenticate", schemeBearer)
+				writeError(w, http.StatusUnauthorized, ErrorInvalidRequest, "missing access token")
+				return
+			}
+			if !granted(claims) {
+				description := "access token was not granted the required scope"
+				w.Header().Add("WWW-Authenticate", fmt.Sprintf(`%s error=%q, error_description=%q, scope=%q`,
+					schemeBearer, ErrorInsufficientScope, description, required.String()))
+				writeError(w, http.StatusForbidden, ErrorInsufficientScope, description)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
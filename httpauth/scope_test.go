@@ -0,0 +1,85 @@
+package httpauth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+func TestRequireScope(t *testing.T) {
+	tokens := newTestTokenService(t, authtest.NewFakeClock(testStart))
+	token, err := tokens.CreateAccessToken(map[string]any{"sub": "alice", "scope": "data:* profile"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		wantStatus int
+	}{
+		{"all granted", RequireAll("data:read", "profile"), http.StatusOK},
+		{"all through wildcard", RequireAll("data:read:own"), http.StatusOK},
+		{"all missing one", RequireAll("data:read", "email"), http.StatusForbidden},
+		{"any granted", RequireAny("email", "profile"), http.StatusOK},
+		{"any missing", RequireAny("email", "files:read"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Authenticate(tokens)(tt.middleware(protectedHandler(t)))
+			w := getWithToken(handler, token, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d, body %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusForbidden {
+				return
+			}
+			if body := decodeBody[ErrorResponse](t, w); body.Error != ErrorInsufficientScope {
+				t.Errorf("error = %q, want %q", body.Error, ErrorInsufficientScope)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if !strings.HasPrefix(challenge, "Bearer") || !strings.Contains(challenge, `error="insufficient_scope"`) {
+				t.Errorf("WWW-Authenticate = %q, want an insufficient_scope challenge", challenge)
+			}
+		})
+	}
+}
+
+func TestRequireScopeWithoutAuthenticate(t *testing.T) {
+	handler := RequireAll("profile")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler reached without claims")
+	}))
+	if w := getWithToken(handler, "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestClientCredentialsNarrowsWildcardScope(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(clock).Build()
+	tokens := service.NewServiceFactory(config).CreateTokenService()
+	clients := service.NewMemoryClientRegistry(&service.Client{
+		ID:         "backend",
+		SecretHash: testSecretHash(t, "s3cret"),
+		GrantTypes: []string{service.GrantTypeClientCredentials},
+		Scopes:     []string{"data:*"},
+	})
+	handler := NewTokenHandler(tokens, clients, config)
+	form := func(scope string) url.Values {
+		return url.Values{"grant_type": {"client_credentials"}, "client_id": {"backend"},
+			"client_secret": {"s3cret"}, "scope": {scope}}
+	}
+
+	if response := requestToken(t, handler, form("data:read data:write")); response.Scope != "data:read data:write" {
+		t.Errorf("scope = %q, want %q", response.Scope, "data:read data:write")
+	}
+	w := postForm(handler, form("data:read files:read"))
+	if body := decodeBody[ErrorResponse](t, w); w.Code != http.StatusBadRequest || body.Error != ErrorInvalidScope {
+		t.Errorf("status %d, body %+v, want invalid_scope", w.Code, body)
+	}
+}
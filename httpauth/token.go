@@ -0,0 +1,447 @@
+package httpauth
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// tokenHandler serves the RFC 6749 token endpoint
+type tokenHandler struct {
+	tokens  service.TokenService
+	clients service.ClientRegistry
+	config  *core.Config
+	// codes is set when the authorization_code grant is enabled
+	codes service.AuthorizationCodeStore
+	// dpop is set when access tokens can be bound to DPoP keys
+	dpop         service.DPoPVerifier
+	dpopEndpoint string
+	// bindCertificates binds access tokens to the client's TLS certificate
+	bindCertificates bool
+}
+
+// TokenHandlerOption configures optional token endpoint behaviour
+type TokenHandlerOption func(*tokenHandler)
+
+// WithAuthorizationCodes enables the authorization_code grant for codes
+// issued by NewAuthorizeHandler into store
+func WithAuthorizationCodes(store service.AuthorizationCodeStore) TokenHandlerOption {
+	return func(h *tokenHandler) {
+		h.codes = store
+	}
+}
+
+// WithDPoPBinding binds access tokens to the key of a DPoP proof sent with
+// the token request, checked by verifier. endpointURL is the public URL of
+// the token endpoint that proofs must name; if empty it is taken from the
+// request. Refresh tokens of public clients are bound as well.
+func WithDPoPBinding(verifier service.DPoPVerifier, endpointURL string) TokenHandlerOption {
+	return func(h *tokenHandler) {
+		h.dpop = verifier
+		h.dpopEndpoint = endpointURL
+	}
+}
+
+// WithCertificateBinding binds access tokens to the client certificate of
+// the mutual TLS connection the token request arrives on (RFC 8705).
+// Requests without a client certificate get unbound tokens.
+func WithCertificateBinding() TokenHandlerOption {
+	return func(h *tokenHandler) {
+		h.bindCertificates = true
+	}
+}
+
+// NewTokenHandler returns a handler for POST /token supporting the
+// refresh_token, client_credentials and token exchange grants, and the
+// authorization_code grant when WithAuthorizationCodes is given. Clients authenticate against
+// clients and may only use the grant types and scopes registered for them.
+func NewTokenHandler(tokens service.TokenService, clients service.ClientRegistry, config *core.Config, opts ...TokenHandlerOption) http.Handler {
+	h := &tokenHandler{tokens: tokens, clients: clients, config: config}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !parsePostForm(w, r) {
+		return
+	}
+
+	client, err := authenticateRegisteredClient(r, h.clients)
+	if errors.Is(err, ErrInvalidClient) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		writeError(w, http.StatusUnauthorized, ErrorInvalidClient, "client authentication failed")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	switch grantType {
+	case "":
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "missing grant_type parameter")
+		return
+	case service.GrantTypeRefreshToken, service.GrantTypeClientCredentials, service.GrantTypeTokenExchange:
+	case service.GrantTypeAuthorizationCode:
+		if h.codes == nil {
+			writeError(w, http.StatusBadRequest, ErrorUnsupportedGrantType, "grant type "+grantType+" is not supported")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, ErrorUnsupportedGrantType, "grant type "+grantType+" is not supported")
+		return
+	}
+	if !client.AllowsGrant(grantType) {
+		writeError(w, http.StatusBadRequest, ErrorUnauthorizedClient, "client may not use grant type "+grantType)
+		return
+	}
+
+	confirmation, ok := h.confirmation(w, r)
+	if !ok {
+		return
+	}
+
+	switch grantType {
+	case service.GrantTypeAuthorizationCode:
+		h.authorizationCodeGrant(w, r, client, confirmation)
+	case service.GrantTypeRefreshToken:
+		h.refreshTokenGrant(w, r, client, confirmation)
+	case service.GrantTypeClientCredentials:
+		h.clientCredentialsGrant(w, r, client, confirmation)
+	case service.GrantTypeTokenExchange:
+		h.tokenExchangeGrant(w, r, client)
+	}
+}
+
+// confirmation returns the cnf claim binding issued tokens to the
+// request's client certificate and DPoP key, checking any DPoP proof
+func (h *tokenHandler) confirmation(w http.ResponseWriter, r *http.Request) (map[string]any, bool) {
+	confirmation := make(map[string]any)
+	if h.bindCertificates {
+		if cert := peerCertificate(r); cert != nil {
+			confirmation[service.CertificateThumbprintMember] = service.CertificateThumbprint(cert)
+		}
+	}
+
+	proofs := r.Header.Values(headerDPoP)
+	if h.dpop == nil || len(proofs) == 0 {
+		return confirmation, true
+	}
+	if len(proofs) > 1 {
+		writeError(w, http.StatusBadRequest, ErrorInvalidDPoPProof, "exactly one DPoP proof is allowed")
+		return nil, false
+	}
+
+	endpoint := h.dpopEndpoint
+	if endpoint == "" {
+		endpoint = requestURL(r)
+	}
+	proof, err := h.dpop.VerifyProof(r.Context(), proofs[0], r.Method, endpoint, "")
+	var validationErr *core.ValidationError
+	if errors.As(err, &validationErr) {
+		writeError(w, http.StatusBadRequest, ErrorInvalidDPoPProof, "DPoP proof is invalid")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return nil, false
+	}
+	confirmation["jkt"] = proof.Thumbprint
+	return confirmation, true
+}
+
+// bindClaims adds the cnf claim of the request's proof-of-possession key to claims
+func bindClaims(claims map[string]any, confirmation map[string]any) {
+	if len(confirmation) > 0 {
+		claims[service.ConfirmationClaim] = maps.Clone(confirmation)
+	}
+}
+
+// authorizationCodeGrant exchanges an authorization code and its PKCE
+// verifier for an access token and, if the client may refresh, a refresh token
+func (h *tokenHandler) authorizationCodeGrant(w http.ResponseWriter, r *http.Request, client *service.Client, confirmation map[string]any) {
+	code := r.PostForm.Get("code")
+	verifier := r.PostForm.Get("code_verifier")
+	if code == "" || verifier == "" {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "code and code_verifier are required")
+		return
+	}
+
+	// Taking the code consumes it, so a failed exchange cannot be retried
+	authorization, err := h.codes.Take(r.Context(), code)
+	if errors.Is(err, core.ErrCodeNotFound) {
+		writeError(w, http.StatusBadRequest, ErrorInvalidGrant, "authorization code is invalid or already used")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return
+	}
+
+	switch {
+	case !h.config.Now().Before(authorization.ExpiresAt):
+		writeError(w, http.StatusBadRequest, ErrorInvalidGrant, "authorization code has expired")
+		return
+	case authorization.ClientID != client.ID:
+		writeError(w, http.StatusBadRequest, ErrorInvalidGrant, "authorization code was not issued to this client")
+		return
+	case authorization.RedirectURI != r.PostForm.Get("redirect_uri"):
+		writeError(w, http.StatusBadRequest, ErrorInvalidGrant, "redirect_uri does not match the authorization request")
+		return
+	case !authorization.VerifyCodeVerifier(verifier):
+		writeError(w, http.StatusBadRequest, ErrorInvalidGrant, "code_verifier does not match the code challenge")
+		return
+	}
+
+	// Claims from the authenticator never set the library's own claims
+	claims := carriedClaims(authorization.Claims)
+	claims["sub"] = authorization.Subject
+	claims["client_id"] = client.ID
+	if authorization.Scope != "" {
+		claims["scope"] = authorization.Scope
+	}
+
+	accessClaims := maps.Clone(claims)
+	bindClaims(accessClaims, confirmation)
+	// Every user of the client shares its signing key, so one login must
+	// not invalidate the tokens of another
+	accessToken, err := h.tokens.CreateAccessTokenContext(r.Context(), accessClaims, client.SigningKeyPrefix(), service.WithoutKeyRotation())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return
+	}
+	response := h.tokenResponse(accessToken, authorization.Scope, confirmation)
+
+	// OpenID Connect requests also get an ID token bound to the access token
+	if slices.Contains(strings.Fields(authorization.Scope), ScopeOpenID) {
+		idToken, err := h.tokens.CreateIDTokenContext(r.Context(), &service.IDTokenRequest{
+			Subject:     authorization.Subject,
+			Audience:    []string{client.ID},
+			Nonce:       authorization.Nonce,
+			AuthTime:    authorization.AuthTime,
+			AccessToken: accessToken,
+			Claims:      carriedClaims(authorization.Claims),
+		}, client.SigningKeyPrefix())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+			return
+		}
+		response.IDToken = idToken
+	}
+
+	if client.AllowsGrant(service.GrantTypeRefreshToken) {
+		// Public clients cannot authenticate, so their refresh tokens are
+		// bound to the DPoP key instead
+		if client.IsPublic() {
+			bindClaims(claims, confirmation)
+		}
+		refreshToken, err := h.tokens.CreateRefreshTokenContext(r.Context(), claims, client.SigningKeyPrefix())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+			return
+		}
+		response.RefreshToken = refreshToken
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// refreshTokenGrant issues a new access token for a refresh token
+func (h *tokenHandler) refreshTokenGrant(w http.ResponseWriter, r *http.Request, client *service.Client, confirmation map[string]any) {
+	refreshToken := r.PostForm.Get("refresh_token")
+	if refreshToken == "" {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "missing refresh_token parameter")
+		return
+	}
+
+	refreshClaims, err := h.tokens.ValidateRefreshTokenContext(r.Context(), refreshToken)
+	var validationErr *core.ValidationError
+	if errors.As(err, &validationErr) {
+		writeError(w, http.StatusBadRequest, ErrorInvalidGrant, "refresh token is invalid, expired or revoked")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return
+	}
+
+	// Refresh tokens are bound to the client they were issued to
+	if owner, _ := refreshClaims.Claims["client_id"].(string); owner != client.ID {
+		writeError(w, http.StatusBadRequest, ErrorInvalidGrant, "refresh token was not issued to this client")
+		return
+	}
+	if thumbprint := refreshClaims.DPoPThumbprint(); thumbprint != "" && confirmation["jkt"] != thumbprint {
+		writeError(w, http.StatusBadRequest, ErrorInvalidDPoPProof, "refresh token is bound to a different DPoP key")
+		return
+	}
+	if thumbprint := refreshClaims.CertificateThumbprint(); thumbprint != "" && confirmation[service.CertificateThumbprintMember] != thumbprint {
+		writeError(w, http.StatusBadRequest, ErrorInvalidGrant, "refresh token is bound to a different client certificate")
+		return
+	}
+
+	// The new token may narrow, but never widen, the original scope
+	scope, ok := narrowScope(refreshClaims.Scope(), r.PostForm.Get("scope"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, ErrorInvalidScope, "requested scope exceeds the granted scope")
+		return
+	}
+
+	claims := carriedClaims(refreshClaims.Claims)
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	bindClaims(claims, confirmation)
+
+	accessToken, err := h.tokens.RefreshAccessTokenContext(r.Context(), refreshToken, claims, client.SigningKeyPrefix())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.tokenResponse(accessToken, scope, confirmation))
+}
+
+// clientCredentialsGrant issues an access token to a confidential client
+func (h *tokenHandler) clientCredentialsGrant(w http.ResponseWriter, r *http.Request, client *service.Client, confirmation map[string]any) {
+	if client.IsPublic() {
+		writeError(w, http.StatusBadRequest, ErrorUnauthorizedClient, "public clients may not use client_credentials")
+		return
+	}
+
+	scope, ok := narrowScope(service.NewScope(client.Scopes...), r.PostForm.Get("scope"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, ErrorInvalidScope, "requested scope is not allowed for this client")
+		return
+	}
+
+	claims := map[string]any{
+		"sub":       client.ID,
+		"client_id": client.ID,
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	bindClaims(claims, confirmation)
+
+	// Every token of the client shares its signing key, so issuing one
+	// must not invalidate the others
+	accessToken, err := h.tokens.CreateAccessTokenContext(r.Context(), claims, client.SigningKeyPrefix(), service.WithoutKeyRotation())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.tokenResponse(accessToken, scope, confirmation))
+}
+
+// tokenExchangeGrant swaps a subject access token for a token meant for
+// another audience (RFC 8693). The authenticated client is the actor.
+func (h *tokenHandler) tokenExchangeGrant(w http.ResponseWriter, r *http.Request, client *service.Client) {
+	if client.IsPublic() {
+		writeError(w, http.StatusBadRequest, ErrorUnauthorizedClient, "public clients may not exchange tokens")
+		return
+	}
+
+	form := r.PostForm
+	subjectToken := form.Get("subject_token")
+	if subjectToken == "" || form.Get("subject_token_type") != service.TokenTypeAccessToken {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "subject_token must be an access token")
+		return
+	}
+	if requested := form.Get("requested_token_type"); requested != "" && requested != service.TokenTypeAccessToken {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "only access tokens can be requested")
+		return
+	}
+	if form.Get("actor_token") != "" {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "actor_token is not supported; the client is the actor")
+		return
+	}
+	audience := form.Get("audience")
+	if audience == "" || len(form["audience"]) > 1 {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "exactly one audience is required")
+		return
+	}
+
+	exchanged, err := h.tokens.ExchangeTokenContext(r.Context(), &service.TokenExchangeRequest{
+		SubjectToken: subjectToken,
+		ActorID:      client.ID,
+		Audience:     audience,
+		Scope:        form.Get("scope"),
+	}, client.SigningKeyPrefix())
+	var validationErr *core.ValidationError
+	switch {
+	case errors.As(err, &validationErr), errors.Is(err, core.ErrTokenExpired):
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest, "subject_token is invalid, expired or revoked")
+		return
+	case errors.Is(err, core.ErrAudienceNotAllowed):
+		writeError(w, http.StatusBadRequest, ErrorInvalidTarget, "tokens cannot be issued for this audience")
+		return
+	case errors.Is(err, core.ErrScopeNotAllowed):
+		writeError(w, http.StatusBadRequest, ErrorInvalidScope, "requested scope is not allowed for this audience")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return
+	}
+
+	now := h.config.Now()
+	writeJSON(w, http.StatusOK, &core.TokenResponse{
+		AccessToken:     exchanged.Token,
+		Token:           exchanged.Token,
+		TokenType:       schemeBearer,
+		IssuedTokenType: service.TokenTypeAccessToken,
+		ExpiresIn:       int64(exchanged.ExpiresAt.Sub(now).Seconds()),
+		ExpiresAt:       exchanged.ExpiresAt.Unix(),
+		Scope:           exchanged.Scope,
+	})
+}
+
+func (h *tokenHandler) tokenResponse(accessToken string, scope string, confirmation map[string]any) *core.TokenResponse {
+	tokenType := schemeBearer
+	if _, bound := confirmation["jkt"]; bound {
+		tokenType = schemeDPoP
+	}
+	return &core.TokenResponse{
+		AccessToken: accessToken,
+		Token:       accessToken,
+		TokenType:   tokenType,
+		ExpiresIn:   int64(h.config.TokenExpiry.Seconds()),
+		ExpiresAt:   h.config.Now().Add(h.config.TokenExpiry).Unix(),
+		Scope:       scope,
+	}
+}
+
+// internalClaims are set by the library when a token is issued and are
+// never copied from a refresh token or an authorization
+var internalClaims = []string{"jti", "iat", "exp", "nbf", "kid", "purpose", service.TokenFamilyClaim, service.ConfirmationClaim}
+
+// carriedClaims copies the claims of a refresh token or an authorization
+// that carry over to a new token
+func carriedClaims(claims map[string]any) map[string]any {
+	carried := make(map[string]any, len(claims))
+	for name, value := range claims {
+		if !slices.Contains(internalClaims, name) {
+			carried[name] = value
+		}
+	}
+	return carried
+}
+
+// narrowScope returns the scope to issue when requested is asked for out of
+// granted: all of granted if requested is empty, otherwise requested, which
+// granted must cover, directly or through wildcards
+func narrowScope(granted service.Scope, requested string) (string, bool) {
+	if requested == "" {
+		return granted.String(), true
+	}
+	requestedScope := service.ParseScope(requested)
+	if !granted.ContainsAll(requestedScope) {
+		return "", false
+	}
+	return requestedScope.String(), true
+}
@@ -0,0 +1,136 @@
+package httpauth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// testSecretHash hashes secret in the format of service.HashClientSecret but
+// with a single iteration, to keep tests fast
+func testSecretHash(t *testing.T, secret string) string {
+	t.Helper()
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, secret, salt, 1, 32)
+	if err != nil {
+		t.Fatalf("pbkdf2: %v", err)
+	}
+	return strings.Join([]string{"pbkdf2-sha256", "1",
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)}, "$")
+}
+
+// requestToken posts a token request and decodes a successful response
+func requestToken(t *testing.T, handler http.Handler, form url.Values) *core.TokenResponse {
+	t.Helper()
+	w := postForm(handler, form)
+	if w.Code != http.StatusOK {
+		t.Fatalf("token request status %d, body %s", w.Code, w.Body.String())
+	}
+	response := decodeBody[core.TokenResponse](t, w)
+	return &response
+}
+
+func TestClientCredentialsTokensShareKey(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(clock).Build()
+	tokens := service.NewServiceFactory(config).CreateTokenService()
+	clients := service.NewMemoryClientRegistry(&service.Client{
+		ID:         "backend",
+		SecretHash: testSecretHash(t, "s3cret"),
+		GrantTypes: []string{service.GrantTypeClientCredentials},
+		Scopes:     []string{"read", "write"},
+	})
+	handler := NewTokenHandler(tokens, clients, config)
+
+	form := func() url.Values {
+		return url.Values{"grant_type": {"client_credentials"}, "client_id": {"backend"}, "client_secret": {"s3cret"}}
+	}
+	first := requestToken(t, handler, form())
+	second := requestToken(t, handler, form())
+
+	// Issuing the second token must not invalidate the first
+	for name, response := range map[string]*core.TokenResponse{"first": first, "second": second} {
+		claims, err := tokens.ValidateAccessToken(response.AccessToken)
+		if err != nil {
+			t.Fatalf("%s token: %v", name, err)
+		}
+		if claims.Claims["client_id"] != "backend" || response.Scope != "read write" {
+			t.Errorf("%s token claims %v, scope %q, want client backend with scope read write", name, claims.Claims, response.Scope)
+		}
+	}
+}
+
+func TestTokenExchangeGrantKeepsEarlierTokensValid(t *testing.T) {
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(authtest.NewFakeClock(testStart)).Build()
+	tokens := service.NewServiceFactory(config, service.WithTokenExchange(service.NewAudienceScopePolicy(map[string][]string{
+		"billing": {"billing:read"},
+	}))).CreateTokenService()
+	clients := service.NewMemoryClientRegistry(&service.Client{
+		ID:         "gateway",
+		SecretHash: testSecretHash(t, "s3cret"),
+		GrantTypes: []string{service.GrantTypeTokenExchange},
+	})
+	handler := NewTokenHandler(tokens, clients, config)
+
+	subject, err := tokens.CreateAccessToken(map[string]any{"sub": "alice", "scope": "billing:read"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	exchange := func() *core.TokenResponse {
+		return requestToken(t, handler, url.Values{
+			"grant_type":         {service.GrantTypeTokenExchange},
+			"client_id":          {"gateway"},
+			"client_secret":      {"s3cret"},
+			"subject_token":      {subject},
+			"subject_token_type": {service.TokenTypeAccessToken},
+			"audience":           {"billing"},
+		})
+	}
+	first := exchange()
+	second := exchange()
+
+	if first.IssuedTokenType != service.TokenTypeAccessToken {
+		t.Errorf("issued_token_type = %q, want %q", first.IssuedTokenType, service.TokenTypeAccessToken)
+	}
+	for name, response := range map[string]*core.TokenResponse{"first": first, "second": second} {
+		claims, err := tokens.ValidateAccessToken(response.AccessToken)
+		if err != nil {
+			t.Fatalf("%s exchanged token: %v", name, err)
+		}
+		if claims.Claims["sub"] != "alice" || claims.Claims["client_id"] != "gateway" {
+			t.Errorf("%s exchanged token claims = %v", name, claims.Claims)
+		}
+	}
+}
+
+func TestTokenResponseKeepsLegacyFields(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(clock).Build()
+	tokens := service.NewServiceFactory(config).CreateTokenService()
+	clients := service.NewMemoryClientRegistry(&service.Client{
+		ID:         "backend",
+		SecretHash: testSecretHash(t, "s3cret"),
+		GrantTypes: []string{service.GrantTypeClientCredentials},
+	})
+	handler := NewTokenHandler(tokens, clients, config)
+
+	w := postForm(handler, url.Values{"grant_type": {"client_credentials"}, "client_id": {"backend"}, "client_secret": {"s3cret"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", w.Code, w.Body.String())
+	}
+	body := decodeBody[map[string]any](t, w)
+	if body["access_token"] == nil || body["token"] != body["access_token"] {
+		t.Errorf("token = %v, access_token = %v, want the same token in both", body["token"], body["access_token"])
+	}
+	if want := float64(testStart.Add(config.TokenExpiry).Unix()); body["expires_at"] != want {
+		t.Errorf("expires_at = %v, want %v", body["expires_at"], want)
+	}
+}
@@ -0,0 +1,81 @@
+package httpauth
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+
+	"github.com/sushan531/jwk-auth/service"
+)
+
+// ErrUserNotFound is returned by a UserLookup that does not know the subject
+var ErrUserNotFound = errors.New("user not found")
+
+// UserLookup returns the claims about a user released to a client with the
+// given scope, such as name and email. It returns ErrUserNotFound for
+// unknown subjects.
+type UserLookup interface {
+	LookupUser(ctx context.Context, subject string, scope string) (map[string]any, error)
+}
+
+// UserLookupFunc adapts a function to a UserLookup
+type UserLookupFunc func(ctx context.Context, subject string, scope string) (map[string]any, error)
+
+func (f UserLookupFunc) LookupUser(ctx context.Context, subject string, scope string) (map[string]any, error) {
+	return f(ctx, subject, scope)
+}
+
+// userInfoHandler serves the OpenID Connect userinfo endpoint
+type userInfoHandler struct {
+	auth  *middleware
+	users UserLookup
+}
+
+// NewUserInfoHandler returns a handler for /userinfo. The caller presents an
+// access token granted the openid scope, checked as Authenticate does with
+// opts, and the response holds the claims users returns for the token's
+// subject.
+func NewUserInfoHandler(tokens service.TokenService, users UserLookup, opts ...MiddlewareOption) http.Handler {
+	return &userInfoHandler{auth: newMiddleware(tokens, opts), users: users}
+}
+
+func (h *userInfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, ErrorInvalidRequest, "method must be GET or POST")
+		return
+	}
+
+	tokenClaims, ok := h.auth.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if !tokenClaims.HasScope(ScopeOpenID) {
+		h.auth.challenge(w, http.StatusForbidden, ErrorInsufficientScope, "access token was not granted the openid scope")
+		return
+	}
+	subject, _ := tokenClaims.Claims["sub"].(string)
+	if subject == "" {
+		h.auth.challenge(w, http.StatusUnauthorized, ErrorInvalidToken, "access token has no subject")
+		return
+	}
+
+	userClaims, err := h.users.LookupUser(r.Context(), subject, tokenClaims.Scope().String())
+	if errors.Is(err, ErrUserNotFound) {
+		h.auth.challenge(w, http.StatusUnauthorized, ErrorInvalidToken, "the token's user no longer exists")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorServerError, "")
+		return
+	}
+
+	response := maps.Clone(userClaims)
+	if response == nil {
+		response = make(map[string]any)
+	}
+	response["sub"] = subject
+	writeJSON(w, http.StatusOK, response)
+}
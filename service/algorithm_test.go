@@ -0,0 +1,111 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// signWithHeaders signs a token with key under alg, naming kid in the
+// protected header unless it is empty
+func signWithHeaders(t *testing.T, alg jwa.SignatureAlgorithm, key any, kid string) string {
+	t.Helper()
+	token := jwt.New()
+	if err := token.Set(jwt.SubjectKey, "mallory"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := token.Set(jwt.ExpirationKey, testStart.Add(time.Hour)); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	headers := jws.NewHeaders()
+	if kid != "" {
+		if err := headers.Set(jws.KeyIDKey, kid); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(alg, key, jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return string(signed)
+}
+
+func TestValidateTokenEnforcesAlgorithms(t *testing.T) {
+	config := testConfig(authtest.NewFakeClock(testStart))
+	a, jwkManager := newTestAuth(t, config)
+	if _, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "access"); err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	signer, err := jwkManager.GetSigner("web")
+	if err != nil {
+		t.Fatalf("GetSigner: %v", err)
+	}
+
+	// An unsigned token naming a real key
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"key-web"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"mallory"}`))
+	unsigned := header + "." + payload + "."
+
+	tests := []struct {
+		name     string
+		token    string
+		code     core.ValidationCode
+		sentinel error
+	}{
+		{"alg none", unsigned, core.ValidationCodeAlgorithm, core.ErrUnsupportedAlgorithm},
+		// HMAC keyed with public key bytes is the classic confusion attack
+		{"hmac with kid", signWithHeaders(t, jwa.HS256(), []byte("public key bytes"), "key-web"), core.ValidationCodeAlgorithm, core.ErrUnsupportedAlgorithm},
+		{"missing kid", signWithHeaders(t, jwa.ES256(), core.AsCryptoSigner(t.Context(), signer), ""), core.ValidationCodeMissingKid, core.ErrMissingKidClaim},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.ValidateToken(tt.token, "")
+			var validationErr *core.ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Code != tt.code || !errors.Is(err, tt.sentinel) {
+				t.Errorf("ValidateToken error = %v, want code %s wrapping %v", err, tt.code, tt.sentinel)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRejectsAlgorithmsRemovedFromAllowList(t *testing.T) {
+	config := testConfig(authtest.NewFakeClock(testStart))
+	a, _ := newTestAuth(t, config)
+	token, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	config.AllowedAlgorithms = []string{"EdDSA"}
+	_, err = a.ValidateToken(token, "access")
+	var validationErr *core.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Code != core.ValidationCodeAlgorithm {
+		t.Fatalf("ValidateToken error = %v, want a disallowed_algorithm ValidationError", err)
+	}
+}
+
+func TestConfigLiteralUsesVerificationDefaults(t *testing.T) {
+	// Neither MaxTokenLength nor AllowedAlgorithms is set
+	config := &core.Config{Algorithm: "ES256", TokenExpiry: time.Hour, Clock: authtest.NewFakeClock(testStart)}
+	tokenService := NewServiceFactory(config).CreateTokenService()
+
+	token, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	if _, err := tokenService.ValidateAccessToken(token); err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+
+	oversized := token + string(make([]byte, core.DefaultMaxTokenLength))
+	if _, err := tokenService.ValidateAccessToken(oversized); !errors.Is(err, core.ErrTokenTooLarge) {
+		t.Errorf("ValidateAccessToken(oversized) error = %v, want ErrTokenTooLarge", err)
+	}
+}
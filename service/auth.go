@@ -1,11 +1,11 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/lestrrat-go/jwx/v3/jws"
 	"github.com/lestrrat-go/jwx/v3/jwt"
 	"github.com/sushan531/jwk-auth/core"
@@ -13,22 +13,48 @@ import (
 
 type Auth interface {
 	GenerateAccessRefreshTokenPair(input map[string]any, refresh map[string]any, keyPrefix string) (string, string, error)
-	GenerateToken(input map[string]any, keyPrefix string, expiry time.Duration, purpose string) (string, error)
+	GenerateToken(input map[string]any, keyPrefix string, expiry time.Duration, purpose string, opts ...IssueOption) (string, error)
 	GenerateTokenFromRefreshToken(input map[string]any, keyPrefix string, expiry time.Duration) (string, error)
+	GenerateIDToken(request *IDTokenRequest, keyPrefix string, expiry time.Duration) (string, error)
 	MarshalJwkSet() ([]byte, error)
 	ParseJsonBytes(jwkSetJSON string) error
 	VerifyTokenSignatureAndGetClaims(token string) (map[string]any, error)
 	// New methods for better functionality
 	ValidateToken(token string, expectedPurpose string) (*TokenClaims, error)
+	ValidateBatch(tokens []string, expectedPurpose string) []BatchResult
 	RevokeTokensForDevice(keyPrefix string) error
+	RevokeToken(token string) error
+	// Revocation of already validated tokens, including opaque tokens
+	RevokeTokenClaims(claims *TokenClaims) error
+	CheckRevocation(claims *TokenClaims) error
+
+	// Context-aware variants; the methods above call these with context.Background()
+	GenerateAccessRefreshTokenPairContext(ctx context.Context, input map[string]any, refresh map[string]any, keyPrefix string) (string, string, error)
+	GenerateTokenContext(ctx context.Context, input map[string]any, keyPrefix string, expiry time.Duration, purpose string, opts ...IssueOption) (string, error)
+	GenerateTokenFromRefreshTokenContext(ctx context.Context, input map[string]any, keyPrefix string, expiry time.Duration) (string, error)
+	GenerateIDTokenContext(ctx context.Context, request *IDTokenRequest, keyPrefix string, expiry time.Duration) (string, error)
+	MarshalJwkSetContext(ctx context.Context) ([]byte, error)
+	ParseJsonBytesContext(ctx context.Context, jwkSetJSON string) error
+	VerifyTokenSignatureAndGetClaimsContext(ctx context.Context, token string) (map[string]any, error)
+	ValidateTokenContext(ctx context.Context, token string, expectedPurpose string) (*TokenClaims, error)
+	ValidateBatchContext(ctx context.Context, tokens []string, expectedPurpose string) []BatchResult
+	RevokeTokensForDeviceContext(ctx context.Context, keyPrefix string) error
+	RevokeTokenContext(ctx context.Context, token string) error
+	RevokeTokenClaimsContext(ctx context.Context, claims *TokenClaims) error
+	CheckRevocationContext(ctx context.Context, claims *TokenClaims) error
 }
 
+// TokenFamilyClaim links a refresh token to the access tokens derived from it
+const TokenFamilyClaim = "family_id"
+
 type TokenClaims struct {
 	Claims    map[string]any `json:"claims"`
 	Purpose   string         `json:"purpose"`
 	ExpiresAt time.Time      `json:"expires_at"`
 	IssuedAt  time.Time      `json:"issued_at"`
 	KeyID     string         `json:"key_id"`
+	TokenID   string         `json:"token_id,omitempty"`
+	FamilyID  string         `json:"family_id,omitempty"`
 }
 
 type auth struct {
@@ -36,56 +62,117 @@ type auth struct {
 	jwkManager core.JwkManager
 	jwtManager core.JwtManager
 	validator  *core.Validator
+	revoker    Revoker
+	// encryptionKeys and decryptionKeys are set for nested encrypted tokens
+	encryptionKeys core.EncryptionKeySource
+	decryptionKeys core.DecryptionKeySource
+	// format is the encoding of issued access and refresh tokens
+	format TokenFormat
+	// batchConcurrency bounds the workers of ValidateBatch; 0 means GOMAXPROCS
+	batchConcurrency int
+	// tokenCache holds verified tokens when set
+	tokenCache *TokenCache
+}
+
+// AuthOption configures optional Auth dependencies
+type AuthOption func(*auth)
+
+// WithRevoker sets where revoked token IDs are recorded and checked
+func WithRevoker(revoker Revoker) AuthOption {
+	return func(a *auth) {
+		a.revoker = revoker
+	}
 }
 
-func NewAuth(jwkManager core.JwkManager, jwtManager core.JwtManager, config *core.Config) Auth {
-	return &auth{
+// NewAuth creates an Auth service. config.Clock is used for every time it
+// needs; jwtManager stamps the iat and exp of JWTs and should be built with
+// core.WithJwtClock(config) so both agree, as ServiceFactory does.
+func NewAuth(jwkManager core.JwkManager, jwtManager core.JwtManager, config *core.Config, opts ...AuthOption) Auth {
+	a := &auth{
 		config:     config,
 		jwkManager: jwkManager,
 		jwtManager: jwtManager,
 		validator:  core.NewValidator(),
+		revoker:    NewMemoryRevoker(),
+		format:     TokenFormatJWT,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 // Refactored to eliminate duplication
-func (a *auth) generateSignedToken(claims map[string]any, keyPrefix string, expiry time.Duration, rotateKey bool) (string, error) {
+func (a *auth) generateSignedToken(ctx context.Context, claims map[string]any, keyPrefix string, expiry time.Duration, rotateKey bool, format TokenFormat) (string, error) {
+	signer, err := a.signerFor(ctx, claims, keyPrefix, expiry, rotateKey)
+	if err != nil {
+		return "", err
+	}
+	return a.signToken(ctx, signer, claims, expiry, format)
+}
+
+// signerFor validates a token request and returns the signer for keyPrefix,
+// rotating its key first or creating it on first use
+func (a *auth) signerFor(ctx context.Context, claims map[string]any, keyPrefix string, expiry time.Duration, rotateKey bool) (core.Signer, error) {
 	// Validate inputs
 	if err := a.validator.ValidateKeyPrefix(keyPrefix); err != nil {
-		return "", core.NewAuthError("generateSignedToken", err)
+		return nil, core.NewAuthError("generateSignedToken", err)
 	}
 
 	if err := a.validator.ValidateClaims(claims); err != nil {
-		return "", core.NewAuthError("generateSignedToken", err)
+		return nil, core.NewAuthError("generateSignedToken", err)
 	}
 
 	if err := a.validator.ValidateExpiry(expiry); err != nil {
-		return "", core.NewAuthError("generateSignedToken", err)
+		return nil, core.NewAuthError("generateSignedToken", err)
 	}
 
-	// Rotate key if needed (for access tokens)
+	// Rotate key if needed (for access tokens); keys held by external
+	// signers are rotated in their own keystore. Otherwise the current key
+	// is used, created on first use.
 	if rotateKey {
-		if err := a.jwkManager.AddOrReplaceKeyToSet(keyPrefix); err != nil {
-			return "", core.NewAuthError("generateSignedToken", fmt.Errorf("failed to rotate key for device '%s': %w", keyPrefix, err))
+		if err := a.jwkManager.AddOrReplaceKeyToSetContext(ctx, keyPrefix); err != nil && !errors.Is(err, core.ErrExternalSigner) {
+			return nil, core.NewAuthError("generateSignedToken", fmt.Errorf("failed to rotate key for device '%s': %w", keyPrefix, err))
 		}
+	} else if err := a.jwkManager.EnsureKeyContext(ctx, keyPrefix); err != nil {
+		return nil, core.NewAuthError("generateSignedToken", fmt.Errorf("failed to create key for device '%s': %w", keyPrefix, err))
 	}
 
-	// Generate unsigned token
-	unsignedToken, err := a.jwtManager.GenerateUnsignedToken(claims, expiry)
+	signer, err := a.jwkManager.GetSignerContext(ctx, keyPrefix)
 	if err != nil {
-		return "", core.NewAuthError("generateSignedToken", err)
+		return nil, core.NewAuthError("generateSignedToken", err)
+	}
+	return signer, nil
+}
+
+// signToken signs claims with signer in format
+func (a *auth) signToken(ctx context.Context, signer core.Signer, claims map[string]any, expiry time.Duration, format TokenFormat) (string, error) {
+	if format == TokenFormatPASETO {
+		token, err := signPASETO(ctx, signer, claims, a.config.Now(), expiry)
+		if err != nil {
+			return "", core.NewAuthError("generateSignedToken", err)
+		}
+		return token, nil
 	}
 
-	// Get private key and sign
-	privateKey, kid, err := a.jwkManager.GetPrivateKeyWithId(keyPrefix)
+	// Generate unsigned token
+	unsignedToken, err := a.jwtManager.GenerateUnsignedToken(claims, expiry)
 	if err != nil {
 		return "", core.NewAuthError("generateSignedToken", err)
 	}
 
-	if err := unsignedToken.Set("kid", kid); err != nil {
+	if err := unsignedToken.Set("kid", signer.KeyID()); err != nil {
 		return "", core.NewAuthError("generateSignedToken", fmt.Errorf("failed to set key id in token: %w", err))
 	}
 
-	signedToken, err := jwt.Sign(unsignedToken, jwt.WithKey(jwa.RS256(), privateKey))
+	// Verifiers resolve the key from the protected header
+	headers := jws.NewHeaders()
+	if err := headers.Set(jws.KeyIDKey, signer.KeyID()); err != nil {
+		return "", core.NewAuthError("generateSignedToken", fmt.Errorf("failed to set key id in header: %w", err))
+	}
+
+	signingKey := core.AsCryptoSigner(ctx, signer)
+	signedToken, err := jwt.Sign(unsignedToken, jwt.WithKey(signer.Algorithm(), signingKey, jws.WithProtectedHeaders(headers)))
 	if err != nil {
 		return "", core.NewAuthError("generateSignedToken", fmt.Errorf("failed to sign token: %w", err))
 	}
@@ -94,14 +181,34 @@ func (a *auth) generateSignedToken(claims map[string]any, keyPrefix string, expi
 }
 
 func (a *auth) GenerateAccessRefreshTokenPair(input map[string]any, refresh map[string]any, keyPrefix string) (string, string, error) {
+	return a.GenerateAccessRefreshTokenPairContext(context.Background(), input, refresh, keyPrefix)
+}
+
+func (a *auth) GenerateAccessRefreshTokenPairContext(ctx context.Context, input map[string]any, refresh map[string]any, keyPrefix string) (string, string, error) {
+	// Both tokens belong to one family so revoking the refresh token
+	// also revokes the access token. The family is assigned before either
+	// token is minted.
+	if input == nil {
+		input = make(map[string]any)
+	}
+	if refresh == nil {
+		refresh = make(map[string]any)
+	}
+	if err := assignTokenFamily(refresh); err != nil {
+		return "", "", core.NewAuthError("GenerateAccessRefreshTokenPair", err)
+	}
+	input[TokenFamilyClaim] = refresh[TokenFamilyClaim]
+	input["purpose"] = "access"
+	refresh["purpose"] = "refresh"
+
 	// Generate access token (with key rotation)
-	accessToken, err := a.generateSignedToken(input, keyPrefix, a.config.TokenExpiry, true)
+	accessToken, err := a.issueToken(ctx, input, keyPrefix, a.config.TokenExpiry, true)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate access token: %w", err)
 	}
 
 	// Generate refresh token (without key rotation)
-	refreshToken, err := a.generateSignedToken(refresh, keyPrefix, a.config.RefreshTokenExpiry, false)
+	refreshToken, err := a.issueToken(ctx, refresh, keyPrefix, a.config.RefreshTokenExpiry, false)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
 	}
@@ -109,23 +216,99 @@ func (a *auth) GenerateAccessRefreshTokenPair(input map[string]any, refresh map[
 	return accessToken, refreshToken, nil
 }
 
-func (a *auth) GenerateToken(input map[string]any, keyPrefix string, expiry time.Duration, purpose string) (string, error) {
+// IssueOption adjusts how a single token is issued
+type IssueOption func(*issueOptions)
+
+type issueOptions struct {
+	// keepKey signs an access token with the current key instead of rotating it
+	keepKey bool
+	// dpopThumbprint binds the token to a DPoP key when set
+	dpopThumbprint string
+	// certificateThumbprint binds the token to a client certificate when set
+	certificateThumbprint string
+}
+
+// issueOptionsOf applies opts to the default issue options
+func issueOptionsOf(opts []IssueOption) issueOptions {
+	var options issueOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// applyClaims sets the claims called for by the options
+func (o issueOptions) applyClaims(claims map[string]any) error {
+	// Both bindings are written to cnf, and a token is bound to one key
+	if o.dpopThumbprint != "" && o.certificateThumbprint != "" {
+		return fmt.Errorf("%w: a token cannot be bound to both a DPoP key and a client certificate", core.ErrInvalidClaim)
+	}
+	if o.dpopThumbprint != "" {
+		BindDPoPKey(claims, o.dpopThumbprint)
+	}
+	if o.certificateThumbprint != "" {
+		confirmationOf(claims)[CertificateThumbprintMember] = o.certificateThumbprint
+	}
+	return nil
+}
+
+// WithoutKeyRotation signs an access token with the key prefix's current key,
+// adding one only if it has none. By default every access token rotates the
+// key, which invalidates the tokens signed before it; use this when several
+// live tokens share a key prefix, such as all tokens issued to one client.
+func WithoutKeyRotation() IssueOption {
+	return func(o *issueOptions) {
+		o.keepKey = true
+	}
+}
+
+// WithDPoPProof binds the token to the key of a verified DPoP proof by
+// setting cnf.jkt, as BindDPoPKey does. A nil proof leaves the token unbound.
+func WithDPoPProof(proof *DPoPProof) IssueOption {
+	return func(o *issueOptions) {
+		if proof != nil {
+			o.dpopThumbprint = proof.Thumbprint
+		}
+	}
+}
+
+func (a *auth) GenerateToken(input map[string]any, keyPrefix string, expiry time.Duration, purpose string, opts ...IssueOption) (string, error) {
+	return a.GenerateTokenContext(context.Background(), input, keyPrefix, expiry, purpose, opts...)
+}
+
+func (a *auth) GenerateTokenContext(ctx context.Context, input map[string]any, keyPrefix string, expiry time.Duration, purpose string, opts ...IssueOption) (string, error) {
 	if err := a.validator.ValidateTokenPurpose(purpose); err != nil {
 		return "", core.NewAuthError("GenerateToken", err)
 	}
 
+	options := issueOptionsOf(opts)
+
 	// Add purpose to claims
 	if input == nil {
 		input = make(map[string]any)
 	}
 	input["purpose"] = purpose
+	if err := options.applyClaims(input); err != nil {
+		return "", core.NewAuthError("GenerateToken", err)
+	}
+
+	// Each refresh token starts a new token family
+	if purpose == "refresh" {
+		if err := assignTokenFamily(input); err != nil {
+			return "", core.NewAuthError("GenerateToken", err)
+		}
+	}
 
-	// Rotate key only for access tokens
-	rotateKey := purpose == "access"
-	return a.generateSignedToken(input, keyPrefix, expiry, rotateKey)
+	// Rotate key only for access tokens, unless the caller keeps the key
+	rotateKey := purpose == "access" && !options.keepKey
+	return a.issueToken(ctx, input, keyPrefix, expiry, rotateKey)
 }
 
 func (a *auth) GenerateTokenFromRefreshToken(input map[string]any, keyPrefix string, expiry time.Duration) (string, error) {
+	return a.GenerateTokenFromRefreshTokenContext(context.Background(), input, keyPrefix, expiry)
+}
+
+func (a *auth) GenerateTokenFromRefreshTokenContext(ctx context.Context, input map[string]any, keyPrefix string, expiry time.Duration) (string, error) {
 	// Add purpose to claims
 	if input == nil {
 		input = make(map[string]any)
@@ -133,15 +316,26 @@ func (a *auth) GenerateTokenFromRefreshToken(input map[string]any, keyPrefix str
 	input["purpose"] = "access"
 
 	// Don't rotate key when generating from refresh token
-	return a.generateSignedToken(input, keyPrefix, expiry, false)
+	return a.issueToken(ctx, input, keyPrefix, expiry, false)
 }
 
 // Enhanced token validation with structured response
 func (a *auth) ValidateToken(token string, expectedPurpose string) (*TokenClaims, error) {
-	claims, err := a.VerifyTokenSignatureAndGetClaims(token)
+	return a.ValidateTokenContext(context.Background(), token, expectedPurpose)
+}
+
+func (a *auth) ValidateTokenContext(ctx context.Context, token string, expectedPurpose string) (*TokenClaims, error) {
+	verified, err := a.verifyToken(ctx, token)
 	if err != nil {
-		return nil, err
+		return nil, core.NewAuthError("ValidateToken", err)
 	}
+	return a.tokenClaimsOf(ctx, verified, expectedPurpose)
+}
+
+// tokenClaimsOf checks the purpose and revocation of a verified token
+func (a *auth) tokenClaimsOf(ctx context.Context, verified *verifiedToken, expectedPurpose string) (*TokenClaims, error) {
+	claims, keyID := verified.claims, verified.keyID
+
 	// Extract and validate purpose
 	purpose, ok := claims["purpose"].(string)
 	if !ok {
@@ -149,7 +343,8 @@ func (a *auth) ValidateToken(token string, expectedPurpose string) (*TokenClaims
 	}
 
 	if expectedPurpose != "" && purpose != expectedPurpose {
-		return nil, core.NewAuthError("ValidateToken", fmt.Errorf("expected purpose '%s', got '%s'", expectedPurpose, purpose))
+		return nil, core.NewAuthError("ValidateToken", core.NewValidationError(core.ValidationCodeWrongPurpose, "purpose", keyID,
+			fmt.Errorf("%w: expected '%s', got '%s'", core.ErrInvalidTokenPurpose, expectedPurpose, purpose)))
 	}
 
 	// Extract timing information
@@ -165,90 +360,154 @@ func (a *auth) ValidateToken(token string, expectedPurpose string) (*TokenClaims
 		}
 	}
 
-	keyID, _ := claims["kid"].(string)
+	tokenID, _ := claims["jti"].(string)
+	familyID, _ := claims[TokenFamilyClaim].(string)
 
-	return &TokenClaims{
+	tokenClaims := &TokenClaims{
 		Claims:    claims,
 		Purpose:   purpose,
 		ExpiresAt: expiresAt,
 		IssuedAt:  issuedAt,
 		KeyID:     keyID,
-	}, nil
+		TokenID:   tokenID,
+		FamilyID:  familyID,
+	}
+	if err := a.CheckRevocationContext(ctx, tokenClaims); err != nil {
+		return nil, core.NewAuthError("ValidateToken", err)
+	}
+	return tokenClaims, nil
 }
 
 func (a *auth) RevokeTokensForDevice(keyPrefix string) error {
-	return a.jwkManager.AddOrReplaceKeyToSet(keyPrefix)
+	return a.RevokeTokensForDeviceContext(context.Background(), keyPrefix)
 }
 
-// MarshalJwkSet marshals the JWK set to JSON for storage purpose
-// Do I need encryption here ?
-func (a *auth) MarshalJwkSet() ([]byte, error) {
-	jwkSet, err := a.jwkManager.GetJwkSetForStorage()
-	if err != nil {
-		return nil, err
-	}
-	return jwkSet, nil
+func (a *auth) RevokeTokensForDeviceContext(ctx context.Context, keyPrefix string) error {
+	return a.jwkManager.AddOrReplaceKeyToSetContext(ctx, keyPrefix)
 }
 
-// ParseJsonBytes parses the JWK set JSON string and updates the JWK set
-// Do I need decryption here ? i.e First decrypt then parse and initialize the jwk set
-func (a *auth) ParseJsonBytes(jwkSetJSON string) error {
-	err := a.jwkManager.GetJwkSetFromStorage(jwkSetJSON)
-	if err != nil {
-		return err
-	}
-	return nil
+// RevokeToken revokes a single valid token by its token ID
+func (a *auth) RevokeToken(token string) error {
+	return a.RevokeTokenContext(context.Background(), token)
 }
 
-// VerifyTokenSignatureAndGetClaims verifies the token signature and returns the claims if valid
-func (a *auth) VerifyTokenSignatureAndGetClaims(jwtToken string) (map[string]any, error) {
-	parsedToken, err := jws.Parse([]byte(jwtToken))
+func (a *auth) RevokeTokenContext(ctx context.Context, token string) error {
+	tokenClaims, err := a.ValidateTokenContext(ctx, token, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse JWT: %w", err)
+		return err
 	}
+	return a.RevokeTokenClaimsContext(ctx, tokenClaims)
+}
 
-	var payload map[string]any
-	payloadInBytes := parsedToken.Payload()
+// RevokeTokenClaims revokes a validated token. Revoking a refresh token
+// revokes its whole family, including access tokens derived from it.
+func (a *auth) RevokeTokenClaims(claims *TokenClaims) error {
+	return a.RevokeTokenClaimsContext(context.Background(), claims)
+}
 
-	errUnmarshallingData := json.Unmarshal(payloadInBytes, &payload)
-	if errUnmarshallingData != nil {
-		return nil, errUnmarshallingData
+func (a *auth) RevokeTokenClaimsContext(ctx context.Context, claims *TokenClaims) error {
+	if claims.Purpose == "refresh" && claims.FamilyID != "" {
+		// Access tokens of the family can be issued until the refresh token expires
+		expiresAt := claims.ExpiresAt
+		if !expiresAt.IsZero() {
+			expiresAt = expiresAt.Add(a.config.TokenExpiry)
+		}
+		if err := a.revoker.RevokeFamily(ctx, claims.FamilyID, expiresAt); err != nil {
+			return core.NewAuthError("RevokeToken", fmt.Errorf("failed to revoke token family: %w", err))
+		}
+		a.evictRevoked("", claims.FamilyID)
+		return nil
 	}
 
-	// Safe type assertion with validation
-	kidInterface, exists := payload["kid"]
-	if !exists {
-		return nil, fmt.Errorf("token missing required 'kid' claim")
+	if claims.TokenID == "" {
+		return core.NewAuthError("RevokeToken", fmt.Errorf("%w: token has no 'jti' claim", core.ErrInvalidTokenFormat))
 	}
+	if err := a.revoker.Revoke(ctx, claims.TokenID, claims.ExpiresAt); err != nil {
+		return core.NewAuthError("RevokeToken", fmt.Errorf("failed to revoke token: %w", err))
+	}
+	a.evictRevoked(claims.TokenID, "")
+	return nil
+}
 
-	kid, ok := kidInterface.(string)
-	if !ok {
-		return nil, fmt.Errorf("'kid' claim must be a string, got %T", kidInterface)
+// CheckRevocation returns a ValidationError wrapping core.ErrTokenRevoked
+// when the token or its family has been revoked
+func (a *auth) CheckRevocation(claims *TokenClaims) error {
+	return a.CheckRevocationContext(context.Background(), claims)
+}
+
+func (a *auth) CheckRevocationContext(ctx context.Context, claims *TokenClaims) error {
+	if claims.TokenID != "" {
+		revoked, err := a.revoker.IsRevoked(ctx, claims.TokenID)
+		if err != nil {
+			return fmt.Errorf("failed to check revocation: %w", err)
+		}
+		if revoked {
+			return core.NewValidationError(core.ValidationCodeRevoked, "jti", claims.KeyID, core.ErrTokenRevoked)
+		}
 	}
 
-	if kid == "" {
-		return nil, fmt.Errorf("'kid' claim cannot be empty")
+	if claims.FamilyID != "" {
+		revoked, err := a.revoker.IsFamilyRevoked(ctx, claims.FamilyID)
+		if err != nil {
+			return fmt.Errorf("failed to check revocation: %w", err)
+		}
+		if revoked {
+			return core.NewValidationError(core.ValidationCodeRevoked, TokenFamilyClaim, claims.KeyID, core.ErrTokenRevoked)
+		}
 	}
+	return nil
+}
 
-	publicKey, errFindingPublicKey := a.jwkManager.GetPublicKeyBy(kid)
-	if errFindingPublicKey != nil {
-		return nil, errFindingPublicKey
+// assignTokenFamily gives claims a new token family unless they have one
+func assignTokenFamily(claims map[string]any) error {
+	if familyID, _ := claims[TokenFamilyClaim].(string); familyID != "" {
+		return nil
+	}
+	familyID, err := core.NewTokenID()
+	if err != nil {
+		return err
 	}
+	claims[TokenFamilyClaim] = familyID
+	return nil
+}
 
-	_, errValidatingToken := jwt.Parse([]byte(jwtToken), jwt.WithKey(jwa.RS256(), publicKey))
-	if errValidatingToken != nil {
-		return nil, fmt.Errorf("failed to verify token signature: %w", errValidatingToken)
+// MarshalJwkSet marshals the JWK set to JSON for storage purpose
+// Do I need encryption here ?
+func (a *auth) MarshalJwkSet() ([]byte, error) {
+	return a.MarshalJwkSetContext(context.Background())
+}
+
+func (a *auth) MarshalJwkSetContext(ctx context.Context) ([]byte, error) {
+	jwkSet, err := a.jwkManager.GetJwkSetForStorageContext(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return jwkSet, nil
+}
 
-	// Validate expiration
-	if exp, exists := payload["exp"]; exists {
-		if expFloat, ok := exp.(float64); ok {
-			expTime := time.Unix(int64(expFloat), 0)
-			if time.Now().After(expTime) {
-				return nil, fmt.Errorf("token has expired")
-			}
-		}
+// ParseJsonBytes parses the JWK set JSON string and updates the JWK set
+// Do I need decryption here ? i.e First decrypt then parse and initialize the jwk set
+func (a *auth) ParseJsonBytes(jwkSetJSON string) error {
+	return a.ParseJsonBytesContext(context.Background(), jwkSetJSON)
+}
+
+func (a *auth) ParseJsonBytesContext(ctx context.Context, jwkSetJSON string) error {
+	err := a.jwkManager.GetJwkSetFromStorageContext(ctx, jwkSetJSON)
+	if err != nil {
+		return err
 	}
+	return nil
+}
+
+// VerifyTokenSignatureAndGetClaims verifies the token signature and returns the claims if valid
+func (a *auth) VerifyTokenSignatureAndGetClaims(jwtToken string) (map[string]any, error) {
+	return a.VerifyTokenSignatureAndGetClaimsContext(context.Background(), jwtToken)
+}
 
-	return payload, nil
+func (a *auth) VerifyTokenSignatureAndGetClaimsContext(ctx context.Context, jwtToken string) (map[string]any, error) {
+	verified, err := a.verifyToken(ctx, jwtToken)
+	if err != nil {
+		return nil, core.NewAuthError("VerifyTokenSignatureAndGetClaims", err)
+	}
+	return verified.claims, nil
 }
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// testStart is the time test clocks start at
+var testStart = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// testConfig returns a config issuing ES256 keys, which are fast to generate
+func testConfig(clock core.Clock) *core.Config {
+	return core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(clock).Build()
+}
+
+// newTestAuth returns an auth service and its key manager using config
+func newTestAuth(t *testing.T, config *core.Config, opts ...AuthOption) (*auth, core.JwkManager) {
+	t.Helper()
+	jwkManager := core.NewJwkManager(config)
+	jwtManager := core.NewJwtManager(core.WithJwtClock(config))
+	return NewAuth(jwkManager, jwtManager, config, opts...).(*auth), jwkManager
+}
+
+func TestExternalSignerIssuesVerifiableTokens(t *testing.T) {
+	hsm := authtest.NewFakeHSM()
+	if err := hsm.GenerateKey("signing-key", jwa.ES256()); err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := core.NewRemoteSigner(context.Background(), hsm, "signing-key", "key-hsm", jwa.ES256())
+	if err != nil {
+		t.Fatalf("NewRemoteSigner: %v", err)
+	}
+
+	a, jwkManager := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+	if err := jwkManager.RegisterSigner("hsm", signer); err != nil {
+		t.Fatalf("RegisterSigner: %v", err)
+	}
+
+	// Access tokens normally rotate the key; external keys are left alone
+	token, err := a.GenerateToken(map[string]any{"sub": "alice"}, "hsm", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if got := hsm.SignCount("signing-key"); got != 1 {
+		t.Errorf("HSM produced %d signatures, want 1", got)
+	}
+
+	claims, err := a.ValidateToken(token, "access")
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.KeyID != "key-hsm" || claims.Claims["sub"] != "alice" {
+		t.Errorf("claims = %+v, want kid key-hsm and sub alice", claims)
+	}
+}
+
+func TestExternalSignerErrorsReachCaller(t *testing.T) {
+	hsm := authtest.NewFakeHSM()
+	if err := hsm.GenerateKey("signing-key", jwa.ES256()); err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := core.NewRemoteSigner(context.Background(), hsm, "signing-key", "key-hsm", jwa.ES256())
+	if err != nil {
+		t.Fatalf("NewRemoteSigner: %v", err)
+	}
+	a, jwkManager := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+	if err := jwkManager.RegisterSigner("hsm", signer); err != nil {
+		t.Fatalf("RegisterSigner: %v", err)
+	}
+
+	unavailable := errors.New("hsm unavailable")
+	hsm.SetSignError(unavailable)
+	if _, err := a.GenerateToken(map[string]any{"sub": "alice"}, "hsm", time.Hour, "access"); !errors.Is(err, unavailable) {
+		t.Fatalf("GenerateToken error = %v, want the HSM error", err)
+	}
+}
+
+func TestAccessTokensRotateKeyByDefault(t *testing.T) {
+	a, _ := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+	first, err := a.GenerateToken(nil, "web", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := a.GenerateToken(nil, "web", time.Hour, "access"); err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := a.ValidateToken(first, "access"); !errors.Is(err, core.ErrInvalidSignature) {
+		t.Errorf("ValidateToken after rotation error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestWithoutKeyRotationKeepsEarlierTokensValid(t *testing.T) {
+	a, jwkManager := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+
+	// The first token creates the key, later ones reuse it
+	var tokens []string
+	for range 3 {
+		token, err := a.GenerateToken(map[string]any{"sub": "client"}, "partner", time.Hour, "access", WithoutKeyRotation())
+		if err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	for i, token := range tokens {
+		if _, err := a.ValidateToken(token, "access"); err != nil {
+			t.Errorf("token %d: %v", i, err)
+		}
+	}
+	if got := jwkManager.GetKeyCount(); got != 1 {
+		t.Errorf("key count = %d, want 1", got)
+	}
+}
+
+func TestRefreshTokenCreatesMissingKey(t *testing.T) {
+	a, _ := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+	token, err := a.GenerateToken(nil, "fresh", time.Hour, "refresh")
+	if err != nil {
+		t.Fatalf("GenerateToken(refresh) without a key: %v", err)
+	}
+	if _, err := a.ValidateToken(token, "refresh"); err != nil {
+		t.Errorf("ValidateToken: %v", err)
+	}
+}
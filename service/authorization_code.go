@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// AuthorizationCode is what an authorization code stands for until it is
+// exchanged at the token endpoint
+type AuthorizationCode struct {
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string
+	Scope         string
+	Subject       string
+	// Claims are added to the tokens issued for the code
+	Claims map[string]any
+	// Nonce and AuthTime are copied into the ID token of OpenID Connect requests
+	Nonce     string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+}
+
+// CodeChallengeMethodS256 is the only supported PKCE method (RFC 7636)
+const CodeChallengeMethodS256 = "S256"
+
+// NewAuthorizationCode returns a random, URL-safe authorization code
+func NewAuthorizationCode() (string, error) {
+	return newReferenceToken()
+}
+
+// ValidCodeVerifier reports whether verifier has the length and characters
+// RFC 7636 allows
+func ValidCodeVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidCodeChallenge reports whether challenge is well formed. An S256
+// challenge is a base64url SHA-256 digest, but RFC 7636 only requires the
+// same 43 to 128 unreserved characters as a verifier.
+func ValidCodeChallenge(challenge string) bool {
+	return ValidCodeVerifier(challenge)
+}
+
+// VerifyCodeVerifier checks a PKCE code verifier against the S256 challenge
+// the code was issued for
+func (c *AuthorizationCode) VerifyCodeVerifier(verifier string) bool {
+	if !ValidCodeVerifier(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(c.CodeChallenge)) == 1
+}
+
+// AuthorizationCodeStore keeps issued authorization codes. Take removes the
+// code as it returns it, so each code can be exchanged only once.
+type AuthorizationCodeStore interface {
+	Put(ctx context.Context, code string, authorization *AuthorizationCode) error
+	// Take returns core.ErrCodeNotFound for unknown or already used codes
+	Take(ctx context.Context, code string) (*AuthorizationCode, error)
+}
+
+// minPurgeThreshold is how many entries an in-memory store holds before it
+// first purges expired entries on insert
+const minPurgeThreshold = 1024
+
+// memoryCodeStore keeps authorization codes in memory, indexed by their hash
+type memoryCodeStore struct {
+	mutex sync.Mutex
+	codes map[string]*AuthorizationCode
+	clock core.Clock
+	// purgeAt is the size at which Put next purges expired codes
+	purgeAt int
+}
+
+// CodeStoreOption configures a memory AuthorizationCodeStore
+type CodeStoreOption func(*memoryCodeStore)
+
+// WithCodeStoreClock sets the clock used to find expired codes
+func WithCodeStoreClock(clock core.Clock) CodeStoreOption {
+	return func(s *memoryCodeStore) {
+		s.clock = clock
+	}
+}
+
+// NewMemoryAuthorizationCodeStore creates an in-process AuthorizationCodeStore.
+// Codes that are never redeemed are purged as new ones are stored, once the
+// store has grown past a threshold that doubles with its live size.
+func NewMemoryAuthorizationCodeStore(opts ...CodeStoreOption) AuthorizationCodeStore {
+	s := &memoryCodeStore{
+		codes:   make(map[string]*AuthorizationCode),
+		clock:   core.SystemClock(),
+		purgeAt: minPurgeThreshold,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *memoryCodeStore) Put(ctx context.Context, code string, authorization *AuthorizationCode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.codes) >= s.purgeAt {
+		s.purgeExpiredLocked(s.clock.Now())
+		s.purgeAt = max(2*len(s.codes), minPurgeThreshold)
+	}
+	s.codes[referenceKey(code)] = authorization
+	return nil
+}
+
+func (s *memoryCodeStore) Take(ctx context.Context, code string) (*AuthorizationCode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := referenceKey(code)
+	authorization, exists := s.codes[key]
+	if !exists {
+		return nil, core.ErrCodeNotFound
+	}
+	delete(s.codes, key)
+	return authorization, nil
+}
+
+// PurgeExpired drops codes that have expired by now
+func (s *memoryCodeStore) PurgeExpired(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.purgeExpiredLocked(now)
+}
+
+func (s *memoryCodeStore) purgeExpiredLocked(now time.Time) {
+	for code, authorization := range s.codes {
+		if authorization.ExpiresAt.Before(now) {
+			delete(s.codes, code)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+func TestValidCodeChallenge(t *testing.T) {
+	tests := map[string]bool{
+		"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM": true,
+		strings.Repeat("a", 43):                       true,
+		strings.Repeat("~", 128):                      true,
+		strings.Repeat("a", 42):                       false,
+		strings.Repeat("a", 129):                      false,
+		strings.Repeat("a", 42) + "=":                 false,
+		strings.Repeat("a", 42) + " ":                 false,
+		"":                                            false,
+	}
+	for challenge, want := range tests {
+		if got := ValidCodeChallenge(challenge); got != want {
+			t.Errorf("ValidCodeChallenge(%q) = %v, want %v", challenge, got, want)
+		}
+	}
+}
+
+func TestMemoryCodeStoreTakesCodeOnce(t *testing.T) {
+	store := NewMemoryAuthorizationCodeStore()
+	ctx := context.Background()
+	if err := store.Put(ctx, "code", &AuthorizationCode{ClientID: "app"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	authorization, err := store.Take(ctx, "code")
+	if err != nil || authorization.ClientID != "app" {
+		t.Fatalf("Take = %+v, %v", authorization, err)
+	}
+	if _, err := store.Take(ctx, "code"); !errors.Is(err, core.ErrCodeNotFound) {
+		t.Errorf("second Take error = %v, want ErrCodeNotFound", err)
+	}
+}
+
+func TestMemoryCodeStorePurgesExpiredCodesOnPut(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	store := NewMemoryAuthorizationCodeStore(WithCodeStoreClock(clock)).(*memoryCodeStore)
+	ctx := context.Background()
+
+	// Fill the store to the threshold with codes that are never redeemed
+	for i := range minPurgeThreshold {
+		code := &AuthorizationCode{ExpiresAt: testStart.Add(time.Minute)}
+		if err := store.Put(ctx, fmt.Sprintf("stale-%d", i), code); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	if got := len(store.codes); got != minPurgeThreshold {
+		t.Fatalf("store holds %d codes before they expire, want %d", got, minPurgeThreshold)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if err := store.Put(ctx, "fresh", &AuthorizationCode{ExpiresAt: clock.Now().Add(time.Minute)}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got := len(store.codes); got != 1 {
+		t.Errorf("store holds %d codes after the purge, want 1", got)
+	}
+	if _, err := store.Take(ctx, "fresh"); err != nil {
+		t.Errorf("Take(fresh): %v", err)
+	}
+}
+
+func TestMemoryCodeStorePurgeThresholdGrowsWithLiveCodes(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	store := NewMemoryAuthorizationCodeStore(WithCodeStoreClock(clock)).(*memoryCodeStore)
+	ctx := context.Background()
+
+	// Live codes survive the purge, and the next purge waits until the
+	// store has doubled so inserts stay amortised constant time
+	for i := range minPurgeThreshold + 1 {
+		code := &AuthorizationCode{ExpiresAt: testStart.Add(time.Hour)}
+		if err := store.Put(ctx, fmt.Sprintf("live-%d", i), code); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	if got := len(store.codes); got != minPurgeThreshold+1 {
+		t.Errorf("store holds %d codes, want %d", got, minPurgeThreshold+1)
+	}
+	if store.purgeAt != 2*minPurgeThreshold {
+		t.Errorf("next purge at %d codes, want %d", store.purgeAt, 2*minPurgeThreshold)
+	}
+}
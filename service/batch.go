@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// BatchResult is the outcome of validating one token of a batch
+type BatchResult struct {
+	Claims *TokenClaims
+	Err    error
+}
+
+// WithBatchConcurrency sets how many tokens ValidateBatch verifies at once.
+// The default is GOMAXPROCS.
+func WithBatchConcurrency(workers int) AuthOption {
+	return func(a *auth) {
+		a.batchConcurrency = workers
+	}
+}
+
+// ValidateBatch validates many tokens at once and returns one result per
+// token, in the order given. Each distinct kid is looked up once for the
+// whole batch, and tokens are verified in parallel by a bounded number of
+// workers. A failing token does not affect the others.
+func (a *auth) ValidateBatch(tokens []string, expectedPurpose string) []BatchResult {
+	return a.ValidateBatchContext(context.Background(), tokens, expectedPurpose)
+}
+
+func (a *auth) ValidateBatchContext(ctx context.Context, tokens []string, expectedPurpose string) []BatchResult {
+	results := make([]BatchResult, len(tokens))
+	if len(tokens) == 0 {
+		return results
+	}
+
+	lookup := a.batchKeyLookup(ctx, tokens)
+
+	workers := a.batchConcurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(tokens))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = a.validateBatchToken(ctx, tokens[i], expectedPurpose, lookup)
+			}
+		}()
+	}
+	for i := range tokens {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// validateBatchToken validates one token of a batch with keys from lookup
+func (a *auth) validateBatchToken(ctx context.Context, token string, expectedPurpose string, lookup keyLookup) BatchResult {
+	if err := ctx.Err(); err != nil {
+		return BatchResult{Err: core.NewAuthError("ValidateToken", err)}
+	}
+	verified, err := a.verifyTokenWith(ctx, token, lookup)
+	if err != nil {
+		return BatchResult{Err: core.NewAuthError("ValidateToken", err)}
+	}
+	claims, err := a.tokenClaimsOf(ctx, verified, expectedPurpose)
+	return BatchResult{Claims: claims, Err: err}
+}
+
+// batchKey is a verification key resolved once for a batch
+type batchKey struct {
+	publicKey crypto.PublicKey
+	algorithm jwa.SignatureAlgorithm
+	err       error
+}
+
+// batchKeyLookup groups tokens by the kid they name and resolves each kid
+// once. Tokens whose kid cannot be read before decryption fall back to the
+// key registry.
+func (a *auth) batchKeyLookup(ctx context.Context, tokens []string) keyLookup {
+	keys := make(map[string]batchKey)
+	for _, token := range tokens {
+		kid := peekKeyID(token)
+		if kid == "" {
+			continue
+		}
+		if _, exists := keys[kid]; exists {
+			continue
+		}
+		publicKey, algorithm, err := a.jwkManager.GetVerificationKeyContext(ctx, kid)
+		keys[kid] = batchKey{publicKey: publicKey, algorithm: algorithm, err: err}
+	}
+
+	return func(ctx context.Context, kid string) (crypto.PublicKey, jwa.SignatureAlgorithm, error) {
+		if key, exists := keys[kid]; exists {
+			return key.publicKey, key.algorithm, key.err
+		}
+		return a.jwkManager.GetVerificationKeyContext(ctx, kid)
+	}
+}
+
+// peekKeyID reads the signing kid of a JWS or PASETO token without
+// verifying it, or returns "" if there is none
+func peekKeyID(token string) string {
+	var encoded string
+	if isPASETOToken(token) {
+		_, encoded, _ = strings.Cut(strings.TrimPrefix(token, pasetoV4PublicHeader), ".")
+	} else if strings.Count(token, ".") == 2 {
+		encoded, _, _ = strings.Cut(token, ".")
+	} else {
+		return ""
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ""
+	}
+	var header struct {
+		KeyID string `json:"kid"`
+	}
+	if json.Unmarshal(data, &header) != nil {
+		return ""
+	}
+	return header.KeyID
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// countingJwkManager records key lookups and how many compromise checks,
+// made once per verified token, run at the same time
+type countingJwkManager struct {
+	core.JwkManager
+	lookups  atomic.Int32
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (m *countingJwkManager) GetVerificationKeyContext(ctx context.Context, kid string) (crypto.PublicKey, jwa.SignatureAlgorithm, error) {
+	m.lookups.Add(1)
+	return m.JwkManager.GetVerificationKeyContext(ctx, kid)
+}
+
+func (m *countingJwkManager) CheckKeyCompromiseContext(ctx context.Context, kid string, issuedAt time.Time) error {
+	current := m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+	for {
+		peak := m.peak.Load()
+		if current <= peak || m.peak.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+	// Give other workers the chance to overlap
+	time.Sleep(time.Millisecond)
+	return m.JwkManager.CheckKeyCompromiseContext(ctx, kid, issuedAt)
+}
+
+// newCountingAuth returns an auth service whose key manager counts calls
+func newCountingAuth(t testing.TB, opts ...AuthOption) (*auth, *countingJwkManager) {
+	t.Helper()
+	config := testConfig(authtest.NewFakeClock(testStart))
+	jwkManager := &countingJwkManager{JwkManager: core.NewJwkManager(config)}
+	jwtManager := core.NewJwtManager(core.WithJwtClock(config))
+	return NewAuth(jwkManager, jwtManager, config, opts...).(*auth), jwkManager
+}
+
+// issueBatch issues count access tokens with sub user-<i>, spread over prefixes
+func issueBatch(t testing.TB, a Auth, count int, prefixes ...string) []string {
+	t.Helper()
+	tokens := make([]string, count)
+	for i := range tokens {
+		token, err := a.GenerateToken(map[string]any{"sub": fmt.Sprintf("user-%d", i)},
+			prefixes[i%len(prefixes)], time.Hour, "access", WithoutKeyRotation())
+		if err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		tokens[i] = token
+	}
+	return tokens
+}
+
+func TestValidateBatchKeepsOrder(t *testing.T) {
+	a, _ := newCountingAuth(t, WithBatchConcurrency(4))
+	tokens := issueBatch(t, a, 16, "web", "mobile", "cli")
+
+	results := a.ValidateBatch(tokens, "access")
+	if len(results) != len(tokens) {
+		t.Fatalf("got %d results, want %d", len(results), len(tokens))
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			t.Errorf("result %d: %v", i, result.Err)
+			continue
+		}
+		if want := fmt.Sprintf("user-%d", i); result.Claims.Claims["sub"] != want {
+			t.Errorf("result %d has sub %v, want %s", i, result.Claims.Claims["sub"], want)
+		}
+	}
+}
+
+func TestValidateBatchReportsErrorsPerToken(t *testing.T) {
+	a, _ := newCountingAuth(t)
+	valid := issueBatch(t, a, 2, "web")
+	refresh, err := a.GenerateToken(map[string]any{"sub": "refresh"}, "web", time.Hour, "refresh")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	revoked := issueBatch(t, a, 1, "web")[0]
+	if err := a.RevokeToken(revoked); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+
+	tokens := []string{valid[0], "not-a-token", refresh, revoked, valid[1]}
+	wants := []error{nil, core.ErrInvalidTokenFormat, core.ErrInvalidTokenPurpose, core.ErrTokenRevoked, nil}
+
+	results := a.ValidateBatch(tokens, "access")
+	for i, want := range wants {
+		if want == nil {
+			if results[i].Err != nil || results[i].Claims == nil {
+				t.Errorf("result %d = %+v, want claims", i, results[i])
+			}
+			continue
+		}
+		if !errors.Is(results[i].Err, want) || results[i].Claims != nil {
+			t.Errorf("result %d = %+v, want error %v", i, results[i], want)
+		}
+	}
+}
+
+func TestValidateBatchBoundsWorkers(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			a, jwkManager := newCountingAuth(t, WithBatchConcurrency(workers))
+			tokens := issueBatch(t, a, 12, "web")
+
+			for i, result := range a.ValidateBatch(tokens, "access") {
+				if result.Err != nil {
+					t.Fatalf("result %d: %v", i, result.Err)
+				}
+			}
+			if peak := jwkManager.peak.Load(); peak > int32(workers) {
+				t.Errorf("%d tokens verified at once, want at most %d", peak, workers)
+			}
+		})
+	}
+}
+
+func TestValidateBatchLooksUpEachKeyOnce(t *testing.T) {
+	a, jwkManager := newCountingAuth(t)
+	tokens := issueBatch(t, a, 12, "web", "mobile")
+
+	jwkManager.lookups.Store(0)
+	a.ValidateBatch(tokens, "access")
+	if got := jwkManager.lookups.Load(); got != 2 {
+		t.Errorf("%d key lookups for 2 kids, want 2", got)
+	}
+}
+
+func TestValidateBatchEdgeCases(t *testing.T) {
+	a, _ := newCountingAuth(t)
+	if results := a.ValidateBatch(nil, "access"); len(results) != 0 {
+		t.Errorf("ValidateBatch(nil) = %v, want no results", results)
+	}
+
+	tokens := issueBatch(t, a, 3, "web")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i, result := range a.ValidateBatchContext(ctx, tokens, "access") {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("result %d error = %v, want context.Canceled", i, result.Err)
+		}
+	}
+}
+
+func TestTokenServiceValidateBatchMixesOpaqueTokens(t *testing.T) {
+	config := testConfig(authtest.NewFakeClock(testStart))
+	a, tokenService, _ := NewServiceFactory(config, WithOpaqueTokens(NewMemoryTokenStore())).CreateAllServices()
+
+	opaque, err := tokenService.CreateAccessToken(map[string]any{"sub": "opaque"}, "partner")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	signed, err := a.GenerateToken(map[string]any{"sub": "signed"}, "web", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	results := tokenService.ValidateBatch([]string{signed, "unknown-reference", opaque})
+	if results[0].Err != nil || results[0].Claims.Claims["sub"] != "signed" {
+		t.Errorf("result 0 = %+v, want sub signed", results[0])
+	}
+	if !errors.Is(results[1].Err, core.ErrTokenNotFound) {
+		t.Errorf("result 1 error = %v, want ErrTokenNotFound", results[1].Err)
+	}
+	if results[2].Err != nil || results[2].Claims.Claims["sub"] != "opaque" {
+		t.Errorf("result 2 = %+v, want sub opaque", results[2])
+	}
+}
+
+// BenchmarkValidateBatch compares ValidateBatch with calling ValidateToken
+// for each token
+func BenchmarkValidateBatch(b *testing.B) {
+	config := testConfig(authtest.NewFakeClock(testStart))
+	a := NewAuth(core.NewJwkManager(config), core.NewJwtManager(core.WithJwtClock(config)), config)
+	tokens := issueBatch(b, a, 64, "web", "mobile", "cli", "partner")
+
+	b.Run("batch", func(b *testing.B) {
+		for b.Loop() {
+			for _, result := range a.ValidateBatch(tokens, "access") {
+				if result.Err != nil {
+					b.Fatal(result.Err)
+				}
+			}
+		}
+	})
+
+	b.Run("loop", func(b *testing.B) {
+		for b.Loop() {
+			for _, token := range tokens {
+				if _, err := a.ValidateToken(token, "access"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// OAuth 2.0 grant types
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// Client is an OAuth 2.0 client allowed to call the token endpoints
+type Client struct {
+	ID string
+	// SecretHash is produced by HashClientSecret; it is empty for public
+	// clients, which cannot use the client_credentials grant
+	SecretHash string
+	GrantTypes []string
+	// Scopes lists the scopes the client may request
+	Scopes []string
+	// KeyPrefix selects the signing key for the client's tokens; it
+	// defaults to the client ID
+	KeyPrefix string
+	// RedirectURIs lists the exact redirect URIs allowed for the
+	// authorization code flow
+	RedirectURIs []string
+}
+
+// IsPublic reports whether the client has no secret
+func (c *Client) IsPublic() bool {
+	return c.SecretHash == ""
+}
+
+// AllowsGrant reports whether the client may use grantType
+func (c *Client) AllowsGrant(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AllowsRedirectURI reports whether redirectURI is registered for the client
+func (c *Client) AllowsRedirectURI(redirectURI string) bool {
+	return slices.Contains(c.RedirectURIs, redirectURI)
+}
+
+// SigningKeyPrefix returns the key prefix used for the client's tokens
+func (c *Client) SigningKeyPrefix() string {
+	if c.KeyPrefix != "" {
+		return c.KeyPrefix
+	}
+	return c.ID
+}
+
+// ClientRegistry looks up registered clients
+type ClientRegistry interface {
+	// GetClient returns core.ErrClientNotFound for unknown client IDs
+	GetClient(ctx context.Context, clientID string) (*Client, error)
+}
+
+// memoryClientRegistry keeps a fixed set of clients in memory
+type memoryClientRegistry struct {
+	clients map[string]*Client
+}
+
+// NewMemoryClientRegistry creates a ClientRegistry holding clients
+func NewMemoryClientRegistry(clients ...*Client) ClientRegistry {
+	registry := &memoryClientRegistry{
+		clients: make(map[string]*Client, len(clients)),
+	}
+	for _, client := range clients {
+		registry.clients[client.ID] = client
+	}
+	return registry
+}
+
+func (r *memoryClientRegistry) GetClient(ctx context.Context, clientID string) (*Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	client, exists := r.clients[clientID]
+	if !exists {
+		return nil, core.ErrClientNotFound
+	}
+	return client, nil
+}
+
+const (
+	clientSecretScheme     = "pbkdf2-sha256"
+	clientSecretIterations = 600_000
+	clientSecretSaltSize   = 16
+	clientSecretKeySize    = 32
+)
+
+// HashClientSecret derives a salted PBKDF2-SHA256 hash of secret, encoded
+// as "pbkdf2-sha256$<iterations>$<salt>$<key>"
+func HashClientSecret(secret string) (string, error) {
+	salt := make([]byte, clientSecretSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, secret, salt, clientSecretIterations, clientSecretKeySize)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash client secret: %w", err)
+	}
+
+	return strings.Join([]string{
+		clientSecretScheme,
+		strconv.Itoa(clientSecretIterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// VerifyClientSecret reports whether secret matches a hash from HashClientSecret
+func VerifyClientSecret(secretHash string, secret string) bool {
+	parts := strings.Split(secretHash, "$")
+	if len(parts) != 4 || parts[0] != clientSecretScheme {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+
+	key, err := pbkdf2.Key(sha256.New, secret, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
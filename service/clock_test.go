@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+func TestFactoryStampsTokensWithItsClock(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").Build()
+	a := NewServiceFactory(config, WithClock(clock)).CreateAuthService()
+
+	token, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	claims, err := a.ValidateToken(token, "access")
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if !claims.IssuedAt.Equal(testStart) || !claims.ExpiresAt.Equal(testStart.Add(time.Hour)) {
+		t.Errorf("iat, exp = %s, %s, want %s, %s", claims.IssuedAt, claims.ExpiresAt, testStart, testStart.Add(time.Hour))
+	}
+}
+
+func TestTokenTimesMatchAcrossFormats(t *testing.T) {
+	explicitIssuedAt := testStart.Add(-time.Minute)
+	explicitExpiry := testStart.Add(10 * time.Minute)
+
+	tests := []struct {
+		name         string
+		claims       map[string]any
+		wantIssuedAt time.Time
+		wantExpiry   time.Time
+	}{
+		{"defaults", map[string]any{"sub": "alice"}, testStart, testStart.Add(time.Hour)},
+		{"explicit unix times", map[string]any{"sub": "alice", "iat": explicitIssuedAt.Unix(), "exp": explicitExpiry.Unix()},
+			explicitIssuedAt, explicitExpiry},
+		{"explicit time.Time", map[string]any{"sub": "alice", "iat": explicitIssuedAt, "exp": explicitExpiry},
+			explicitIssuedAt, explicitExpiry},
+	}
+	for _, format := range []TokenFormat{TokenFormatJWT, TokenFormatPASETO} {
+		a, _ := newTestAuth(t, pasetoConfig(authtest.NewFakeClock(testStart)), WithTokenFormat(format))
+		for _, tt := range tests {
+			t.Run(string(format)+"/"+tt.name, func(t *testing.T) {
+				token, err := a.GenerateToken(tt.claims, "web", time.Hour, "access", WithoutKeyRotation())
+				if err != nil {
+					t.Fatalf("GenerateToken: %v", err)
+				}
+				claims, err := a.ValidateToken(token, "access")
+				if err != nil {
+					t.Fatalf("ValidateToken: %v", err)
+				}
+				if !claims.IssuedAt.Equal(tt.wantIssuedAt) || !claims.ExpiresAt.Equal(tt.wantExpiry) {
+					t.Errorf("iat, exp = %s, %s, want %s, %s", claims.IssuedAt, claims.ExpiresAt, tt.wantIssuedAt, tt.wantExpiry)
+				}
+			})
+		}
+	}
+}
+
+func TestTokenExpiryFollowsFakeClock(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	a, _ := newTestAuth(t, testConfig(clock))
+
+	token, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	clock.Advance(59 * time.Minute)
+	if _, err := a.ValidateToken(token, "access"); err != nil {
+		t.Fatalf("ValidateToken before expiry: %v", err)
+	}
+
+	clock.Advance(2 * time.Minute)
+	_, err = a.ValidateToken(token, "access")
+	var validationErr *core.ValidationError
+	if !errors.Is(err, core.ErrTokenExpired) || !errors.As(err, &validationErr) || validationErr.Code != core.ValidationCodeExpired {
+		t.Fatalf("ValidateToken after expiry error = %v, want a token_expired ValidationError", err)
+	}
+}
+
+func TestTokenNotYetValidFollowsFakeClock(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	a, _ := newTestAuth(t, testConfig(clock))
+
+	token, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	clock.Set(testStart.Add(-time.Hour))
+	if _, err := a.ValidateToken(token, "access"); !errors.Is(err, core.ErrTokenNotYetValid) {
+		t.Fatalf("ValidateToken before iat error = %v, want ErrTokenNotYetValid", err)
+	}
+}
+
+func TestRefreshTokenExpiryFollowsFakeClock(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	config := core.NewConfigBuilder().
+		WithAlgorithm("ES256").
+		WithClock(clock).
+		WithTokenExpiry(time.Minute).
+		WithRefreshTokenExpiry(time.Hour).
+		Build()
+	tokenService := NewServiceFactory(config).CreateTokenService()
+
+	if _, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice"}, "web"); err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	refreshToken, err := tokenService.CreateRefreshToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+
+	clock.Advance(30 * time.Minute)
+	accessToken, err := tokenService.RefreshAccessToken(refreshToken, map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("RefreshAccessToken: %v", err)
+	}
+	claims, err := tokenService.ValidateAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if want := testStart.Add(31 * time.Minute); !claims.ExpiresAt.Equal(want) {
+		t.Errorf("refreshed access token expires at %s, want %s", claims.ExpiresAt, want)
+	}
+
+	clock.Advance(31 * time.Minute)
+	if _, err := tokenService.RefreshAccessToken(refreshToken, nil, "web"); !errors.Is(err, core.ErrTokenExpired) {
+		t.Fatalf("RefreshAccessToken with expired refresh token error = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestOpaqueTokenExpiryFollowsFakeClock(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(clock).WithTokenExpiry(time.Minute).Build()
+	tokenService := NewServiceFactory(config, WithOpaqueTokens(NewMemoryTokenStore())).CreateTokenService()
+
+	token, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	if _, err := tokenService.ValidateAccessToken(token); err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	if _, err := tokenService.ValidateAccessToken(token); !errors.Is(err, core.ErrTokenExpired) {
+		t.Fatalf("ValidateAccessToken after expiry error = %v, want ErrTokenExpired", err)
+	}
+}
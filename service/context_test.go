@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+func TestGenerateTokenContextCancelled(t *testing.T) {
+	a, _ := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := a.GenerateTokenContext(ctx, map[string]any{"sub": "alice"}, "web", time.Hour, "access"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GenerateTokenContext error = %v, want context.Canceled", err)
+	}
+}
+
+func TestSigningContextReachesRemoteSigner(t *testing.T) {
+	hsm := authtest.NewFakeHSM()
+	if err := hsm.GenerateKey("signing-key", jwa.ES256()); err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := core.NewRemoteSigner(context.Background(), hsm, "signing-key", "key-hsm", jwa.ES256())
+	if err != nil {
+		t.Fatalf("NewRemoteSigner: %v", err)
+	}
+	a, jwkManager := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+	if err := jwkManager.RegisterSigner("hsm", signer); err != nil {
+		t.Fatalf("RegisterSigner: %v", err)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(0, 0))
+	defer cancel()
+	if _, err := a.GenerateTokenContext(ctx, map[string]any{"sub": "alice"}, "hsm", time.Hour, "refresh"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GenerateTokenContext error = %v, want context.DeadlineExceeded", err)
+	}
+	if got := hsm.SignCount("signing-key"); got != 0 {
+		t.Errorf("HSM signed %d times with an expired context, want 0", got)
+	}
+}
+
+func TestKeyServiceContextCancelled(t *testing.T) {
+	keyService := NewServiceFactory(testConfig(authtest.NewFakeClock(testStart))).CreateKeyService()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := keyService.RotateKeyContext(ctx, "web"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("RotateKeyContext error = %v, want context.Canceled", err)
+	}
+}
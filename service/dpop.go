@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// DPoPProofType is the typ header of DPoP proof JWTs (RFC 9449)
+const DPoPProofType = "dpop+jwt"
+
+// DefaultDPoPProofLifetime is how far a proof's iat may be from the current time
+const DefaultDPoPProofLifetime = 5 * time.Minute
+
+// ConfirmationClaim holds the key a sender-constrained token is bound to (RFC 7800)
+const ConfirmationClaim = "cnf"
+
+// DPoPProof is a verified DPoP proof
+type DPoPProof struct {
+	// Thumbprint is the RFC 7638 SHA-256 thumbprint of the proof key, base64url encoded
+	Thumbprint string
+	TokenID    string
+	IssuedAt   time.Time
+}
+
+// DPoPVerifier checks DPoP proofs sent in the DPoP request header
+type DPoPVerifier interface {
+	// VerifyProof checks proof for a request with the given method and URL.
+	// accessToken is the token presented with the proof; it is empty at the
+	// token endpoint, where no ath claim is required.
+	VerifyProof(ctx context.Context, proof string, method string, requestURL string, accessToken string) (*DPoPProof, error)
+}
+
+// ReplayCache remembers proof IDs until they expire
+type ReplayCache interface {
+	// Remember records id until expiresAt. It returns false if id was already recorded.
+	Remember(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+}
+
+// memoryReplayCache keeps proof IDs in memory
+type memoryReplayCache struct {
+	mutex sync.Mutex
+	seen  map[string]time.Time
+	clock core.Clock
+	// purgeAt is the size at which Remember next purges expired IDs
+	purgeAt int
+}
+
+// ReplayCacheOption configures a memory ReplayCache
+type ReplayCacheOption func(*memoryReplayCache)
+
+// WithReplayCacheClock sets the clock used to find expired proof IDs
+func WithReplayCacheClock(clock core.Clock) ReplayCacheOption {
+	return func(c *memoryReplayCache) {
+		c.clock = clock
+	}
+}
+
+// NewMemoryReplayCache creates an in-process ReplayCache. Expired proof IDs
+// are purged as new ones are recorded, once the cache has grown past a
+// threshold that doubles with its live size. Deployments with several
+// instances need a shared cache so a proof cannot be replayed against
+// another instance.
+func NewMemoryReplayCache(opts ...ReplayCacheOption) ReplayCache {
+	c := &memoryReplayCache{
+		seen:    make(map[string]time.Time),
+		clock:   core.SystemClock(),
+		purgeAt: minPurgeThreshold,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *memoryReplayCache) Remember(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, exists := c.seen[id]; exists {
+		return false, nil
+	}
+	if len(c.seen) >= c.purgeAt {
+		c.purgeExpiredLocked(c.clock.Now())
+		c.purgeAt = max(2*len(c.seen), minPurgeThreshold)
+	}
+	c.seen[id] = expiresAt
+	return true, nil
+}
+
+// PurgeExpired drops proof IDs that have expired by now
+func (c *memoryReplayCache) PurgeExpired(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.purgeExpiredLocked(now)
+}
+
+func (c *memoryReplayCache) purgeExpiredLocked(now time.Time) {
+	for id, expiresAt := range c.seen {
+		if expiresAt.Before(now) {
+			delete(c.seen, id)
+		}
+	}
+}
+
+type dpopVerifier struct {
+	config   *core.Config
+	lifetime time.Duration
+	replay   ReplayCache
+}
+
+// DPoPOption configures a DPoPVerifier
+type DPoPOption func(*dpopVerifier)
+
+// WithProofLifetime sets how far a proof's iat may be from the current time
+func WithProofLifetime(lifetime time.Duration) DPoPOption {
+	return func(v *dpopVerifier) {
+		v.lifetime = lifetime
+	}
+}
+
+// WithReplayCache sets where used proof IDs are recorded
+func WithReplayCache(cache ReplayCache) DPoPOption {
+	return func(v *dpopVerifier) {
+		v.replay = cache
+	}
+}
+
+// NewDPoPVerifier creates a DPoPVerifier accepting proofs signed with the
+// config's allowed algorithms and checked against the config's clock. Unless
+// WithReplayCache is given, proof IDs are kept in a memory ReplayCache.
+func NewDPoPVerifier(config *core.Config, opts ...DPoPOption) DPoPVerifier {
+	v := &dpopVerifier{
+		config:   config,
+		lifetime: DefaultDPoPProofLifetime,
+		replay:   NewMemoryReplayCache(WithReplayCacheClock(config)),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// dpopClaims are the claims of a DPoP proof
+type dpopClaims struct {
+	TokenID  string   `json:"jti"`
+	Method   string   `json:"htm"`
+	URL      string   `json:"htu"`
+	IssuedAt *float64 `json:"iat"`
+	ATH      string   `json:"ath"`
+}
+
+func (v *dpopVerifier) VerifyProof(ctx context.Context, proof string, method string, requestURL string, accessToken string) (*DPoPProof, error) {
+	if len(proof) > v.config.TokenLengthLimit() {
+		return nil, invalidProof("", fmt.Errorf("%w: %d bytes, limit %d", core.ErrTokenTooLarge, len(proof), v.config.TokenLengthLimit()))
+	}
+
+	message, err := jws.Parse([]byte(proof), jws.WithCompact())
+	if err != nil {
+		return nil, invalidProof("", fmt.Errorf("%w: %v", core.ErrInvalidTokenFormat, err))
+	}
+	signatures := message.Signatures()
+	if len(signatures) != 1 || signatures[0].ProtectedHeaders() == nil {
+		return nil, invalidProof("", core.ErrInvalidTokenFormat)
+	}
+	headers := signatures[0].ProtectedHeaders()
+
+	if typ, _ := headers.Type(); typ != DPoPProofType {
+		return nil, invalidProof("typ", fmt.Errorf("typ must be %s", DPoPProofType))
+	}
+	key, ok := headers.JWK()
+	if !ok {
+		return nil, invalidProof("jwk", fmt.Errorf("missing jwk header"))
+	}
+	if private, err := jwk.IsPrivateKey(key); err != nil || private {
+		return nil, invalidProof("jwk", fmt.Errorf("jwk header must be a public key"))
+	}
+	headerAlg, ok := headers.Algorithm()
+	if !ok {
+		return nil, invalidProof("alg", core.ErrUnsupportedAlgorithm)
+	}
+	alg, err := core.CheckVerificationAlgorithm(headerAlg.String(), v.config.SignatureAlgorithms(), headerAlg)
+	if err != nil {
+		return nil, invalidProof("alg", err)
+	}
+
+	payload, err := jws.Verify([]byte(proof), jws.WithKey(alg, key))
+	if err != nil {
+		return nil, invalidProof("", fmt.Errorf("%w: %v", core.ErrInvalidSignature, err))
+	}
+	var claims dpopClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, invalidProof("", fmt.Errorf("%w: %v", core.ErrInvalidTokenFormat, err))
+	}
+
+	if claims.TokenID == "" {
+		return nil, invalidProof("jti", fmt.Errorf("missing jti"))
+	}
+	if claims.Method != method {
+		return nil, invalidProof("htm", fmt.Errorf("htm %q does not match %s", claims.Method, method))
+	}
+	if !sameTargetURI(claims.URL, requestURL) {
+		return nil, invalidProof("htu", fmt.Errorf("htu %q does not match the request URL", claims.URL))
+	}
+	if claims.IssuedAt == nil {
+		return nil, invalidProof("iat", fmt.Errorf("missing iat"))
+	}
+	issuedAt := time.Unix(int64(*claims.IssuedAt), 0)
+	if age := v.config.Now().Sub(issuedAt); age > v.lifetime || age < -v.lifetime {
+		return nil, invalidProof("iat", fmt.Errorf("iat is outside the accepted window of %s", v.lifetime))
+	}
+	if accessToken != "" && claims.ATH != AccessTokenThumbprint(accessToken) {
+		return nil, invalidProof("ath", fmt.Errorf("ath does not match the access token"))
+	}
+
+	sum, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, invalidProof("jwk", fmt.Errorf("failed to compute key thumbprint: %w", err))
+	}
+	thumbprint := base64.RawURLEncoding.EncodeToString(sum)
+
+	// Proof IDs only need to be unique per key
+	fresh, err := v.replay.Remember(ctx, thumbprint+":"+claims.TokenID, issuedAt.Add(v.lifetime))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record DPoP proof: %w", err)
+	}
+	if !fresh {
+		return nil, invalidProof("jti", core.ErrDPoPProofReplayed)
+	}
+
+	return &DPoPProof{Thumbprint: thumbprint, TokenID: claims.TokenID, IssuedAt: issuedAt}, nil
+}
+
+// invalidProof reports why a DPoP proof was rejected
+func invalidProof(claim string, err error) error {
+	return core.NewValidationError(core.ValidationCodeInvalidDPoPProof, claim, "", fmt.Errorf("%w: %w", core.ErrInvalidDPoPProof, err))
+}
+
+// sameTargetURI compares two URLs ignoring query, fragment and the case of
+// scheme and host, as RFC 9449 asks for htu
+func sameTargetURI(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) &&
+		strings.EqualFold(ua.Host, ub.Host) &&
+		ua.EscapedPath() == ub.EscapedPath()
+}
+
+// AccessTokenThumbprint computes the ath claim of a DPoP proof for accessToken
+func AccessTokenThumbprint(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// BindDPoPKey binds the token issued with claims to the DPoP key with the
+// given thumbprint by setting cnf.jkt. Pass proof.Thumbprint of a proof
+// checked at the token endpoint.
+func BindDPoPKey(claims map[string]any, thumbprint string) {
+	confirmationOf(claims)["jkt"] = thumbprint
+}
+
+// confirmationOf returns the cnf claim of claims, adding it if needed
+func confirmationOf(claims map[string]any) map[string]any {
+	if cnf, ok := claims[ConfirmationClaim].(map[string]any); ok {
+		return cnf
+	}
+	cnf := make(map[string]any)
+	claims[ConfirmationClaim] = cnf
+	return cnf
+}
+
+// DPoPThumbprint returns the DPoP key thumbprint the token is bound to, or
+// "" for tokens without a DPoP binding
+func (tc *TokenClaims) DPoPThumbprint() string {
+	cnf, _ := tc.Claims[ConfirmationClaim].(map[string]any)
+	thumbprint, _ := cnf["jkt"].(string)
+	return thumbprint
+}
+
+// CheckDPoPBinding checks that proof was made with the key the token is bound to
+func CheckDPoPBinding(tokenClaims *TokenClaims, proof *DPoPProof) error {
+	thumbprint := tokenClaims.DPoPThumbprint()
+	if thumbprint == "" || proof == nil || proof.Thumbprint != thumbprint {
+		return core.NewValidationError(core.ValidationCodeInvalidDPoPProof, "cnf", tokenClaims.KeyID,
+			fmt.Errorf("%w: %w", core.ErrInvalidDPoPProof, core.ErrTokenBindingMismatch))
+	}
+	return nil
+}
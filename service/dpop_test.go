@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+const testDPoPURL = "https://api.example/token"
+
+// signDPoPProof signs a DPoP proof for a POST to testDPoPURL
+func signDPoPProof(t *testing.T, key *ecdsa.PrivateKey, jti string, issuedAt time.Time) string {
+	t.Helper()
+	publicKey, err := jwk.Import(key.Public())
+	if err != nil {
+		t.Fatalf("jwk.Import: %v", err)
+	}
+	headers := jws.NewHeaders()
+	for name, value := range map[string]any{jws.TypeKey: DPoPProofType, jws.JWKKey: publicKey} {
+		if err := headers.Set(name, value); err != nil {
+			t.Fatalf("set header %s: %v", name, err)
+		}
+	}
+	payload, err := json.Marshal(map[string]any{"jti": jti, "htm": "POST", "htu": testDPoPURL, "iat": issuedAt.Unix()})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	proof, err := jws.Sign(payload, jws.WithKey(jwa.ES256(), key, jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		t.Fatalf("jws.Sign: %v", err)
+	}
+	return string(proof)
+}
+
+func newDPoPKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return key
+}
+
+func TestDPoPVerifierRejectsReplayedProof(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	verifier := NewDPoPVerifier(testConfig(clock))
+	proof := signDPoPProof(t, newDPoPKey(t), "proof-1", testStart)
+
+	if _, err := verifier.VerifyProof(context.Background(), proof, "POST", testDPoPURL, ""); err != nil {
+		t.Fatalf("VerifyProof: %v", err)
+	}
+	if _, err := verifier.VerifyProof(context.Background(), proof, "POST", testDPoPURL, ""); !errors.Is(err, core.ErrDPoPProofReplayed) {
+		t.Errorf("replayed VerifyProof error = %v, want ErrDPoPProofReplayed", err)
+	}
+}
+
+func TestMemoryReplayCachePurgesExpiredIDsOnInsert(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	cache := NewMemoryReplayCache(WithReplayCacheClock(clock)).(*memoryReplayCache)
+	ctx := context.Background()
+
+	for i := range minPurgeThreshold {
+		if _, err := cache.Remember(ctx, fmt.Sprintf("old-%d", i), testStart.Add(time.Minute)); err != nil {
+			t.Fatalf("Remember: %v", err)
+		}
+	}
+	clock.Advance(2 * time.Minute)
+
+	fresh, err := cache.Remember(ctx, "new", clock.Now().Add(time.Minute))
+	if err != nil || !fresh {
+		t.Fatalf("Remember(new) = %v, %v, want fresh", fresh, err)
+	}
+	if got := len(cache.seen); got != 1 {
+		t.Errorf("cache holds %d IDs after the purge, want 1", got)
+	}
+	if fresh, _ := cache.Remember(ctx, "new", clock.Now().Add(time.Minute)); fresh {
+		t.Error("live ID was purged")
+	}
+}
+
+func TestDPoPVerifierMemoryStaysBounded(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	verifier := NewDPoPVerifier(testConfig(clock)).(*dpopVerifier)
+	key := newDPoPKey(t)
+
+	// Proofs arrive steadily for far longer than their lifetime
+	const proofs = 3 * minPurgeThreshold
+	for i := range proofs {
+		proof := signDPoPProof(t, key, fmt.Sprintf("proof-%d", i), clock.Now())
+		if _, err := verifier.VerifyProof(context.Background(), proof, "POST", testDPoPURL, ""); err != nil {
+			t.Fatalf("VerifyProof %d: %v", i, err)
+		}
+		clock.Advance(time.Second)
+	}
+
+	cache := verifier.replay.(*memoryReplayCache)
+	if got := len(cache.seen); got >= proofs {
+		t.Errorf("replay cache holds all %d proof IDs, want expired ones purged", got)
+	}
+}
+
+func TestGenerateTokenWithDPoPProof(t *testing.T) {
+	a, _ := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+	proof := &DPoPProof{Thumbprint: "thumbprint", TokenID: "proof-1", IssuedAt: testStart}
+
+	token, err := a.GenerateToken(map[string]any{"sub": "alice"}, "app", time.Hour, "access", WithDPoPProof(proof))
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	claims, err := a.ValidateToken(token, "access")
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if got := claims.DPoPThumbprint(); got != "thumbprint" {
+		t.Errorf("DPoPThumbprint = %q, want thumbprint", got)
+	}
+	if err := CheckDPoPBinding(claims, proof); err != nil {
+		t.Errorf("CheckDPoPBinding: %v", err)
+	}
+	if err := CheckDPoPBinding(claims, &DPoPProof{Thumbprint: "other"}); !errors.Is(err, core.ErrTokenBindingMismatch) {
+		t.Errorf("CheckDPoPBinding with another key error = %v, want ErrTokenBindingMismatch", err)
+	}
+
+	// A nil proof leaves the token unbound
+	unbound, err := a.GenerateToken(nil, "app", time.Hour, "access", WithDPoPProof(nil))
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if claims, err := a.ValidateToken(unbound, "access"); err != nil || claims.DPoPThumbprint() != "" {
+		t.Errorf("unbound token claims = %+v, %v", claims, err)
+	}
+}
+
+func TestOpaqueAccessTokenWithDPoPProof(t *testing.T) {
+	tokenService := newOpaqueTokenService(t, authtest.NewFakeClock(testStart), NewMemoryTokenStore())
+	token, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice"}, "app", WithDPoPProof(&DPoPProof{Thumbprint: "thumbprint"}))
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	claims, err := tokenService.ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if got := claims.DPoPThumbprint(); got != "thumbprint" {
+		t.Errorf("DPoPThumbprint = %q, want thumbprint", got)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwe"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// nestedTokenContentType marks a JWE whose payload is a signed JWT (RFC 7519 section 5.2)
+const nestedTokenContentType = "JWT"
+
+// WithTokenEncryption makes access and refresh tokens nested JWTs: the
+// signed token is encrypted with A256GCM to the current key of keys, so
+// clients cannot read its claims. ID tokens stay signed only.
+func WithTokenEncryption(keys core.EncryptionKeySource) AuthOption {
+	return func(a *auth) {
+		a.encryptionKeys = keys
+	}
+}
+
+// WithTokenDecryption lets ValidateToken accept tokens encrypted to keys.
+// Signed tokens without encryption are still accepted.
+func WithTokenDecryption(keys core.DecryptionKeySource) AuthOption {
+	return func(a *auth) {
+		a.decryptionKeys = keys
+	}
+}
+
+// isEncryptedToken reports whether token has the five-part compact JWE shape
+func isEncryptedToken(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// encryptToken wraps a signed token in a JWE if token encryption is enabled
+func (a *auth) encryptToken(ctx context.Context, signedToken string) (string, error) {
+	if a.encryptionKeys == nil {
+		return signedToken, nil
+	}
+
+	recipient, err := a.encryptionKeys.EncryptionKey(ctx)
+	if err != nil {
+		return "", core.NewAuthError("encryptToken", err)
+	}
+
+	headers := jwe.NewHeaders()
+	if err := headers.Set(jwe.ContentTypeKey, nestedTokenContentType); err != nil {
+		return "", core.NewAuthError("encryptToken", fmt.Errorf("failed to set content type in header: %w", err))
+	}
+	if recipient.KeyID != "" {
+		if err := headers.Set(jwe.KeyIDKey, recipient.KeyID); err != nil {
+			return "", core.NewAuthError("encryptToken", fmt.Errorf("failed to set key id in header: %w", err))
+		}
+	}
+
+	encrypted, err := jwe.Encrypt([]byte(signedToken),
+		jwe.WithKey(recipient.Algorithm, recipient.PublicKey),
+		jwe.WithContentEncryption(jwa.A256GCM()),
+		jwe.WithProtectedHeaders(headers),
+		jwe.WithCompact())
+	if err != nil {
+		return "", core.NewAuthError("encryptToken", fmt.Errorf("failed to encrypt token: %w", err))
+	}
+	return string(encrypted), nil
+}
+
+// decryptToken returns the signed token nested in an encrypted token. The
+// key is resolved from the protected header kid and must be used with the
+// algorithm it is bound to.
+func (a *auth) decryptToken(ctx context.Context, token string) (string, *core.ValidationError) {
+	if a.decryptionKeys == nil {
+		return "", core.NewValidationError(core.ValidationCodeDecryptionFailed, "", "",
+			fmt.Errorf("%w: token decryption is not configured", core.ErrDecryptionFailed))
+	}
+
+	message, err := jwe.Parse([]byte(token))
+	if err != nil || message.ProtectedHeaders() == nil {
+		return "", core.NewValidationError(core.ValidationCodeMalformed, "", "", fmt.Errorf("%w: %v", core.ErrInvalidTokenFormat, err))
+	}
+	headers := message.ProtectedHeaders()
+
+	kid, _ := headers.KeyID()
+	if kid == "" {
+		return "", core.NewValidationError(core.ValidationCodeMissingKid, "kid", "", core.ErrMissingKidClaim)
+	}
+	if cty, _ := headers.ContentType(); cty != nestedTokenContentType {
+		return "", core.NewValidationError(core.ValidationCodeMalformed, "cty", kid,
+			fmt.Errorf("%w: encrypted token must contain a JWT", core.ErrInvalidTokenFormat))
+	}
+	if enc, _ := headers.ContentEncryption(); enc != jwa.A256GCM() {
+		return "", core.NewValidationError(core.ValidationCodeAlgorithm, "enc", kid,
+			fmt.Errorf("%w: content encryption %s", core.ErrUnsupportedAlgorithm, enc))
+	}
+
+	privateKey, keyAlg, err := a.decryptionKeys.DecryptionKey(ctx, kid)
+	if err != nil {
+		return "", core.NewValidationError(core.ValidationCodeUnknownKey, "kid", kid, err)
+	}
+	if alg, _ := headers.Algorithm(); alg != keyAlg {
+		return "", core.NewValidationError(core.ValidationCodeAlgorithm, "alg", kid,
+			fmt.Errorf("%w: token uses %s, key is bound to %s", core.ErrAlgorithmMismatch, alg, keyAlg))
+	}
+
+	payload, err := jwe.Decrypt([]byte(token), jwe.WithKey(keyAlg, privateKey))
+	if err != nil {
+		return "", core.NewValidationError(core.ValidationCodeDecryptionFailed, "", kid, fmt.Errorf("%w: %v", core.ErrDecryptionFailed, err))
+	}
+	return string(payload), nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// newEncryptionKeyring returns a keyring with a current key for alg
+func newEncryptionKeyring(t *testing.T, config *core.Config, alg jwa.KeyEncryptionAlgorithm) core.EncryptionKeyring {
+	t.Helper()
+	keyring := core.NewEncryptionKeyring(config)
+	if _, err := keyring.Rotate(context.Background(), alg); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	return keyring
+}
+
+func TestEncryptedTokenRoundTrip(t *testing.T) {
+	for _, alg := range []jwa.KeyEncryptionAlgorithm{jwa.RSA_OAEP_256(), jwa.ECDH_ES()} {
+		t.Run(alg.String(), func(t *testing.T) {
+			config := testConfig(authtest.NewFakeClock(testStart))
+			keyring := newEncryptionKeyring(t, config, alg)
+			tokenService := NewServiceFactory(config, WithEncryptedTokens(keyring, keyring)).CreateTokenService()
+
+			token, err := tokenService.CreateAccessToken(map[string]any{"user_id": "u-42", "scope": "read"}, "web")
+			if err != nil {
+				t.Fatalf("CreateAccessToken: %v", err)
+			}
+			if !isEncryptedToken(token) {
+				t.Fatalf("token %q is not a compact JWE", token)
+			}
+			// Neither the header nor the ciphertext reveals the claims
+			for _, part := range strings.Split(token, ".") {
+				decoded, _ := base64.RawURLEncoding.DecodeString(part)
+				if strings.Contains(string(decoded), "u-42") {
+					t.Fatal("encrypted token exposes the user_id claim")
+				}
+			}
+
+			claims, err := tokenService.ValidateAccessToken(token)
+			if err != nil {
+				t.Fatalf("ValidateAccessToken: %v", err)
+			}
+			if claims.Claims["user_id"] != "u-42" {
+				t.Errorf("claims = %v, want user_id u-42", claims.Claims)
+			}
+		})
+	}
+}
+
+func TestEncryptedTokensSurviveKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	config := testConfig(authtest.NewFakeClock(testStart))
+	keyring := core.NewEncryptionKeyring(config)
+	oldKeyID, err := keyring.Rotate(ctx, jwa.ECDH_ES())
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	tokenService := NewServiceFactory(config, WithEncryptedTokens(keyring, keyring)).CreateTokenService()
+	token, err := tokenService.CreateRefreshToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+
+	if _, err := keyring.Rotate(ctx, jwa.ECDH_ES()); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if _, err := tokenService.ValidateRefreshToken(token); err != nil {
+		t.Fatalf("ValidateRefreshToken after rotation: %v", err)
+	}
+
+	if err := keyring.RemoveKey(ctx, oldKeyID); err != nil {
+		t.Fatalf("RemoveKey: %v", err)
+	}
+	_, err = tokenService.ValidateRefreshToken(token)
+	var validationErr *core.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Code != core.ValidationCodeUnknownKey {
+		t.Errorf("ValidateRefreshToken after removal error = %v, want an unknown key validation error", err)
+	}
+}
+
+func TestEncryptedTokenNeedsDecryptionKeys(t *testing.T) {
+	config := testConfig(authtest.NewFakeClock(testStart))
+	keyring := newEncryptionKeyring(t, config, jwa.ECDH_ES())
+	factory := NewServiceFactory(config, WithEncryptedTokens(keyring, nil))
+	tokenService := factory.CreateTokenService()
+
+	token, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	if _, err := tokenService.ValidateAccessToken(token); !errors.Is(err, core.ErrDecryptionFailed) {
+		t.Errorf("ValidateAccessToken without decryption keys error = %v, want ErrDecryptionFailed", err)
+	}
+}
+
+func TestDecryptionAcceptsSignedTokens(t *testing.T) {
+	config := testConfig(authtest.NewFakeClock(testStart))
+	keyring := newEncryptionKeyring(t, config, jwa.ECDH_ES())
+	factory := NewServiceFactory(config, WithEncryptedTokens(nil, keyring))
+	tokenService := factory.CreateTokenService()
+
+	// Issued before encryption was switched on
+	token, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	if isEncryptedToken(token) {
+		t.Fatal("token was encrypted without an encryption key source")
+	}
+	if _, err := tokenService.ValidateAccessToken(token); err != nil {
+		t.Errorf("ValidateAccessToken: %v", err)
+	}
+}
+
+func TestIDTokensAreNotEncrypted(t *testing.T) {
+	config := testConfig(authtest.NewFakeClock(testStart))
+	keyring := newEncryptionKeyring(t, config, jwa.ECDH_ES())
+	tokenService := NewServiceFactory(config, WithEncryptedTokens(keyring, keyring)).CreateTokenService()
+
+	if _, err := tokenService.CreateAccessToken(nil, "app"); err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	idToken, err := tokenService.CreateIDToken(&IDTokenRequest{Subject: "alice", Audience: []string{"app"}}, "app")
+	if err != nil {
+		t.Fatalf("CreateIDToken: %v", err)
+	}
+	if strings.Count(idToken, ".") != 2 {
+		t.Errorf("ID token %q is not a signed JWT", idToken)
+	}
+}
@@ -5,6 +5,11 @@ import (
 	"time"
 )
 
+// Event types published by the services
+const (
+	EventKeyCompromised = "key_compromised"
+)
+
 // TokenEvent represents a token-related event
 type TokenEvent struct {
 	Type      string
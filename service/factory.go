@@ -1,46 +1,348 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/sushan531/jwk-auth/core"
 )
 
-// ServiceFactory creates and configures services
+// ErrFactoryStarted is returned when Start is called on a running factory
+var ErrFactoryStarted = errors.New("service factory already started")
+
+// ServiceFactory creates and configures services. All services created by
+// one factory share a single key registry, so keys rotated through one
+// service are immediately visible to the others.
 type ServiceFactory struct {
-	config *core.Config
+	config     *core.Config
+	keyPool    *core.KeyPool
+	jwkManager core.JwkManager
+	jwtManager core.JwtManager
+
+	// Injected dependencies
+	store     core.KeyStore
+	clock     core.Clock
+	signers   map[string]core.Signer
+	publisher *TokenEventPublisher
+	revoker   Revoker
+	// tokenStore is set when token services issue opaque reference tokens
+	tokenStore TokenStore
+	// exchangePolicy is set when token services support token exchange
+	exchangePolicy ExchangePolicy
+	// encryptionKeys and decryptionKeys are set for nested encrypted tokens
+	encryptionKeys core.EncryptionKeySource
+	decryptionKeys core.DecryptionKeySource
+	// tokenFormat is the format of issued access and refresh tokens
+	tokenFormat TokenFormat
+	// tokenCache is shared by auth services when verified tokens are cached
+	tokenCache *TokenCache
+
+	// Background goroutine lifecycle
+	mutex   sync.Mutex
+	started bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// FactoryOption configures a ServiceFactory
+type FactoryOption func(*ServiceFactory)
+
+// WithKeyStore loads the key set from store on Start and saves it periodically and on Close
+func WithKeyStore(store core.KeyStore) FactoryOption {
+	return func(sf *ServiceFactory) {
+		sf.store = store
+	}
+}
+
+// WithClock sets the clock used by the factory and its services,
+// overriding the clock of the factory's config
+func WithClock(clock core.Clock) FactoryOption {
+	return func(sf *ServiceFactory) {
+		sf.clock = clock
+	}
+}
+
+// WithSigner registers an external signer for keyPrefix on Start
+func WithSigner(keyPrefix string, signer core.Signer) FactoryOption {
+	return func(sf *ServiceFactory) {
+		sf.signers[keyPrefix] = signer
+	}
+}
+
+// WithEventPublisher sets the publisher used for token and key events. A
+// nil publisher keeps the factory's own.
+func WithEventPublisher(publisher *TokenEventPublisher) FactoryOption {
+	return func(sf *ServiceFactory) {
+		if publisher != nil {
+			sf.publisher = publisher
+		}
+	}
+}
+
+// WithTokenRevoker sets where revoked token IDs are recorded
+func WithTokenRevoker(revoker Revoker) FactoryOption {
+	return func(sf *ServiceFactory) {
+		sf.revoker = revoker
+	}
+}
+
+// WithOpaqueTokens makes token services issue opaque reference tokens backed by store
+func WithOpaqueTokens(store TokenStore) FactoryOption {
+	return func(sf *ServiceFactory) {
+		sf.tokenStore = store
+	}
+}
+
+// WithTokenExchange enables token exchange in token services, limited by policy
+func WithTokenExchange(policy ExchangePolicy) FactoryOption {
+	return func(sf *ServiceFactory) {
+		sf.exchangePolicy = policy
+	}
+}
+
+// WithEncryptedTokens makes auth services encrypt access and refresh tokens
+// to encrypt and decrypt tokens with decrypt when validating them. Either may
+// be nil; an EncryptionKeyring serves as both.
+func WithEncryptedTokens(encrypt core.EncryptionKeySource, decrypt core.DecryptionKeySource) FactoryOption {
+	return func(sf *ServiceFactory) {
+		sf.encryptionKeys = encrypt
+		sf.decryptionKeys = decrypt
+	}
+}
+
+// WithIssuedTokenFormat sets the format of access and refresh tokens issued
+// by auth services, such as TokenFormatPASETO
+func WithIssuedTokenFormat(format TokenFormat) FactoryOption {
+	return func(sf *ServiceFactory) {
+		sf.tokenFormat = format
+	}
+}
+
+// WithVerifiedTokenCache makes auth services cache up to maxEntries verified
+// tokens for at most ttl each. The cache is shared by all auth services of
+// the factory and drops tokens signed by keys reported as compromised.
+func WithVerifiedTokenCache(maxEntries int, ttl time.Duration) FactoryOption {
+	return func(sf *ServiceFactory) {
+		sf.tokenCache = NewTokenCache(maxEntries, ttl)
+	}
 }
 
 // NewServiceFactory creates a new service factory
-func NewServiceFactory(config *core.Config) *ServiceFactory {
-	return &ServiceFactory{config: config}
+func NewServiceFactory(config *core.Config, opts ...FactoryOption) *ServiceFactory {
+	sf := &ServiceFactory{
+		config:    config,
+		signers:   make(map[string]core.Signer),
+		publisher: NewTokenEventPublisher(),
+		revoker:   NewMemoryRevoker(),
+	}
+	for _, opt := range opts {
+		opt(sf)
+	}
+	if sf.tokenCache != nil {
+		sf.publisher.Subscribe(sf.tokenCache)
+	}
+
+	if sf.clock != nil {
+		// Copy the config so the caller's config is left untouched
+		withClock := *config
+		withClock.Clock = sf.clock
+		sf.config = &withClock
+		config = sf.config
+	} else if config.Clock != nil {
+		sf.clock = config.Clock
+	} else {
+		sf.clock = core.SystemClock()
+	}
+
+	if config.KeyPoolHighWatermark > 0 {
+		sf.keyPool = core.NewKeyPool(config.KeyPoolLowWatermark, config.KeyPoolHighWatermark)
+		sf.jwkManager = core.NewJwkManager(config, core.WithKeySource(sf.keyPool))
+	} else {
+		sf.jwkManager = core.NewJwkManager(config)
+	}
+	sf.jwtManager = core.NewJwtManager(core.WithJwtClock(sf.clock))
+	return sf
+}
+
+// KeyRegistry returns the key registry shared by all services of this factory
+func (sf *ServiceFactory) KeyRegistry() core.JwkManager {
+	return sf.jwkManager
+}
+
+// EventPublisher returns the publisher shared by all services of this factory
+func (sf *ServiceFactory) EventPublisher() *TokenEventPublisher {
+	return sf.publisher
+}
+
+// Start loads the stored key set, registers external signers and starts
+// background key generation, cleanup and persistence
+func (sf *ServiceFactory) Start(ctx context.Context) error {
+	sf.mutex.Lock()
+	defer sf.mutex.Unlock()
+
+	if sf.started {
+		return ErrFactoryStarted
+	}
+
+	if sf.store != nil {
+		data, err := sf.store.Load(ctx)
+		switch {
+		case errors.Is(err, core.ErrKeySetNotStored):
+		case err != nil:
+			return fmt.Errorf("failed to load key set: %w", err)
+		default:
+			if err := sf.jwkManager.GetJwkSetFromStorageContext(ctx, string(data)); err != nil {
+				return fmt.Errorf("failed to load key set: %w", err)
+			}
+		}
+	}
+
+	for keyPrefix, signer := range sf.signers {
+		if err := sf.jwkManager.RegisterSignerContext(ctx, keyPrefix, signer); err != nil {
+			return fmt.Errorf("failed to register signer for %s: %w", keyPrefix, err)
+		}
+	}
+
+	if sf.keyPool != nil {
+		sf.keyPool.Warm(core.KeySpec{Algorithm: sf.config.Algorithm, Size: sf.config.KeySize})
+	}
+
+	loopCtx, cancel := context.WithCancel(context.Background())
+	sf.cancel = cancel
+	sf.done = make(chan struct{})
+	sf.started = true
+	go sf.maintain(loopCtx, sf.done)
+
+	return nil
+}
+
+// Close stops all background goroutines and saves the key set. It returns
+// ctx.Err() if ctx expires before the goroutines have stopped.
+func (sf *ServiceFactory) Close(ctx context.Context) error {
+	sf.mutex.Lock()
+	defer sf.mutex.Unlock()
+
+	if sf.started {
+		sf.cancel()
+		select {
+		case <-sf.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		sf.started = false
+	}
+
+	if sf.keyPool != nil {
+		poolClosed := make(chan struct{})
+		go func() {
+			sf.keyPool.Close()
+			close(poolClosed)
+		}()
+		select {
+		case <-poolClosed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return sf.persist(ctx)
+}
+
+// maintain runs periodic cleanup and persistence until ctx is cancelled
+func (sf *ServiceFactory) maintain(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	interval := sf.config.CleanupInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = sf.jwkManager.CleanupExpiredKeysContext(ctx)
+			if purger, ok := sf.revoker.(expiredPurger); ok {
+				purger.PurgeExpired(sf.clock.Now())
+			}
+			if purger, ok := sf.tokenStore.(expiredPurger); ok {
+				purger.PurgeExpired(sf.clock.Now())
+			}
+			_ = sf.persist(ctx)
+		}
+	}
+}
+
+// persist saves the key set to the store, if one is configured
+func (sf *ServiceFactory) persist(ctx context.Context) error {
+	if sf.store == nil {
+		return nil
+	}
+
+	data, err := sf.jwkManager.GetJwkSetForStorageContext(ctx)
+	if errors.Is(err, core.ErrJWKSetNotInitialized) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to serialize key set: %w", err)
+	}
+
+	if err := sf.store.Save(ctx, data); err != nil {
+		return fmt.Errorf("failed to save key set: %w", err)
+	}
+	return nil
 }
 
 // CreateAuthService creates a fully configured auth service
 func (sf *ServiceFactory) CreateAuthService() Auth {
-	jwkManager := core.NewJwkManager(sf.config)
-	jwtManager := core.NewJwtManager()
-	return NewAuth(jwkManager, jwtManager, sf.config)
+	opts := []AuthOption{WithRevoker(sf.revoker)}
+	if sf.encryptionKeys != nil {
+		opts = append(opts, WithTokenEncryption(sf.encryptionKeys))
+	}
+	if sf.decryptionKeys != nil {
+		opts = append(opts, WithTokenDecryption(sf.decryptionKeys))
+	}
+	if sf.tokenFormat != "" {
+		opts = append(opts, WithTokenFormat(sf.tokenFormat))
+	}
+	if sf.tokenCache != nil {
+		opts = append(opts, WithTokenCache(sf.tokenCache))
+	}
+	return NewAuth(sf.jwkManager, sf.jwtManager, sf.config, opts...)
 }
 
 // CreateTokenService creates a token service
 func (sf *ServiceFactory) CreateTokenService() TokenService {
-	authService := sf.CreateAuthService()
-	return NewTokenService(authService, sf.config)
+	return sf.newTokenService(sf.CreateAuthService())
+}
+
+func (sf *ServiceFactory) newTokenService(authService Auth) TokenService {
+	var opts []TokenServiceOption
+	if sf.tokenStore != nil {
+		opts = append(opts, WithOpaqueTokenStore(sf.tokenStore))
+	}
+	if sf.exchangePolicy != nil {
+		opts = append(opts, WithExchangePolicy(sf.exchangePolicy))
+	}
+	return NewTokenService(authService, sf.config, opts...)
 }
 
 // CreateKeyService creates a key service
 func (sf *ServiceFactory) CreateKeyService() KeyService {
-	jwkManager := core.NewJwkManager(sf.config)
-	return NewKeyService(jwkManager)
+	return NewKeyService(sf.jwkManager, WithKeyEventPublisher(sf.publisher), WithKeyClock(sf.clock))
 }
 
 // CreateAllServices creates all services with shared dependencies
 func (sf *ServiceFactory) CreateAllServices() (Auth, TokenService, KeyService) {
-	jwkManager := core.NewJwkManager(sf.config)
-	jwtManager := core.NewJwtManager()
-
-	authService := NewAuth(jwkManager, jwtManager, sf.config)
-	tokenService := NewTokenService(authService, sf.config)
-	keyService := NewKeyService(jwkManager)
+	authService := sf.CreateAuthService()
+	tokenService := sf.newTokenService(authService)
+	keyService := sf.CreateKeyService()
 
 	return authService, tokenService, keyService
 }
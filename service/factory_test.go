@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+func TestFactoryServicesShareKeyRegistry(t *testing.T) {
+	factory := NewServiceFactory(testConfig(authtest.NewFakeClock(testStart)))
+	authService, tokenService, keyService := factory.CreateAllServices()
+
+	token, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+
+	// A separately created service sees the key immediately
+	if _, err := factory.CreateAuthService().ValidateToken(token, "access"); err != nil {
+		t.Fatalf("ValidateToken with a new auth service: %v", err)
+	}
+
+	// Rotation through the key service invalidates the token everywhere
+	if err := keyService.RotateKey("web"); err != nil {
+		t.Fatalf("RotateKey: %v", err)
+	}
+	if _, err := authService.ValidateToken(token, "access"); !errors.Is(err, core.ErrInvalidSignature) {
+		t.Fatalf("ValidateToken after rotation error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestFactoryStartLoadsAndCloseSavesKeys(t *testing.T) {
+	config := testConfig(authtest.NewFakeClock(testStart))
+	store := core.NewMemoryKeyStore()
+
+	first := NewServiceFactory(config, WithKeyStore(store))
+	if err := first.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := first.Start(context.Background()); !errors.Is(err, ErrFactoryStarted) {
+		t.Errorf("second Start error = %v, want ErrFactoryStarted", err)
+	}
+	token, err := first.CreateTokenService().CreateAccessToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	if err := first.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// A restarted factory verifies tokens signed before the restart
+	second := NewServiceFactory(config, WithKeyStore(store))
+	if err := second.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer second.Close(context.Background())
+	if _, err := second.CreateAuthService().ValidateToken(token, "access"); err != nil {
+		t.Fatalf("ValidateToken after restart: %v", err)
+	}
+}
+
+func TestFactoryStartRegistersSigners(t *testing.T) {
+	hsm := authtest.NewFakeHSM()
+	if err := hsm.GenerateKey("signing-key", jwa.ES256()); err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := core.NewRemoteSigner(context.Background(), hsm, "signing-key", "key-hsm", jwa.ES256())
+	if err != nil {
+		t.Fatalf("NewRemoteSigner: %v", err)
+	}
+
+	factory := NewServiceFactory(testConfig(authtest.NewFakeClock(testStart)), WithSigner("hsm", signer))
+	if _, err := factory.KeyRegistry().GetSigner("hsm"); err == nil {
+		t.Fatal("signer was registered before Start")
+	}
+	if err := factory.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer factory.Close(context.Background())
+	if _, err := factory.KeyRegistry().GetSigner("hsm"); err != nil {
+		t.Fatalf("GetSigner after Start: %v", err)
+	}
+}
+
+func TestFactoryRestartsAfterClose(t *testing.T) {
+	factory := NewServiceFactory(testConfig(authtest.NewFakeClock(testStart)))
+	if err := factory.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := factory.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// A closed factory can be started again
+	if err := factory.Start(context.Background()); err != nil {
+		t.Fatalf("Start after Close: %v", err)
+	}
+	if err := factory.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestFactoryClockLeavesCallerConfigUntouched(t *testing.T) {
+	config := testConfig(core.SystemClock())
+	clock := authtest.NewFakeClock(testStart)
+
+	factory := NewServiceFactory(config, WithClock(clock))
+	if config.Clock != core.SystemClock() {
+		t.Error("WithClock changed the caller's config")
+	}
+
+	token, err := factory.CreateTokenService().CreateAccessToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	claims, err := factory.CreateAuthService().ValidateToken(token, "access")
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if !claims.IssuedAt.Equal(testStart) {
+		t.Errorf("IssuedAt = %s, want the factory clock's %s", claims.IssuedAt, testStart)
+	}
+}
+
+// eventRecorder forwards observed events to a channel
+type eventRecorder chan TokenEvent
+
+func (r eventRecorder) OnTokenEvent(event TokenEvent) {
+	r <- event
+}
+
+func TestFactoryIgnoresNilEventPublisher(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	factory := NewServiceFactory(testConfig(clock), WithEventPublisher(nil), WithVerifiedTokenCache(10, time.Minute))
+	publisher := factory.EventPublisher()
+	if publisher == nil {
+		t.Fatal("EventPublisher() = nil, want the default publisher")
+	}
+	events := make(eventRecorder, 1)
+	publisher.Subscribe(events)
+
+	keyService := factory.CreateKeyService()
+	if err := keyService.RotateKey("web"); err != nil {
+		t.Fatalf("RotateKey: %v", err)
+	}
+	if err := keyService.MarkCompromised("web", "leaked", clock.Now()); err != nil {
+		t.Fatalf("MarkCompromised: %v", err)
+	}
+	select {
+	case event := <-events:
+		if event.Type != EventKeyCompromised || event.KeyPrefix != "web" {
+			t.Errorf("event = %+v, want key_compromised for web", event)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no event was published")
+	}
+}
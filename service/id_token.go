@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// IDTokenPurpose is the purpose claim of OpenID Connect ID tokens
+const IDTokenPurpose = "id"
+
+// IDTokenRequest describes an OpenID Connect ID token
+type IDTokenRequest struct {
+	Subject string
+	// Audience lists the client IDs the token is meant for
+	Audience []string
+	// Nonce echoes the nonce of the authorization request, if any
+	Nonce string
+	// AuthTime is when the user last authenticated; zero omits auth_time
+	AuthTime time.Time
+	// AccessToken, when set, is bound to the ID token through at_hash
+	AccessToken string
+	// Claims are additional claims about the user, such as email
+	Claims map[string]any
+}
+
+// idTokenReservedClaims are set from IDTokenRequest fields and cannot be
+// overridden through Claims
+var idTokenReservedClaims = []string{"iss", "sub", "aud", "nonce", "auth_time", "at_hash", "purpose"}
+
+// GenerateIDToken signs an ID token with the current key for keyPrefix. The
+// issuer is taken from the config.
+func (a *auth) GenerateIDToken(request *IDTokenRequest, keyPrefix string, expiry time.Duration) (string, error) {
+	return a.GenerateIDTokenContext(context.Background(), request, keyPrefix, expiry)
+}
+
+func (a *auth) GenerateIDTokenContext(ctx context.Context, request *IDTokenRequest, keyPrefix string, expiry time.Duration) (string, error) {
+	const op = "GenerateIDToken"
+
+	if request == nil || request.Subject == "" {
+		return "", core.NewAuthError(op, fmt.Errorf("%w: sub is required", core.ErrInvalidClaim))
+	}
+	if len(request.Audience) == 0 {
+		return "", core.NewAuthError(op, fmt.Errorf("%w: aud is required", core.ErrInvalidClaim))
+	}
+
+	claims := make(map[string]any, len(request.Claims)+8)
+	for name, value := range request.Claims {
+		if !slices.Contains(idTokenReservedClaims, name) {
+			claims[name] = value
+		}
+	}
+	claims["sub"] = request.Subject
+	claims["aud"] = slices.Clone(request.Audience)
+	claims["purpose"] = IDTokenPurpose
+	if a.config.Issuer != "" {
+		claims["iss"] = a.config.Issuer
+	}
+	if request.Nonce != "" {
+		claims["nonce"] = request.Nonce
+	}
+	if !request.AuthTime.IsZero() {
+		claims["auth_time"] = request.AuthTime.Unix()
+	}
+
+	signer, err := a.signerFor(ctx, claims, keyPrefix, expiry, false)
+	if err != nil {
+		return "", err
+	}
+	if request.AccessToken != "" {
+		// at_hash depends on the algorithm the ID token is signed with
+		atHash, err := AccessTokenHash(request.AccessToken, signer.Algorithm())
+		if err != nil {
+			return "", core.NewAuthError(op, err)
+		}
+		claims["at_hash"] = atHash
+	}
+
+	return a.signToken(ctx, signer, claims, expiry, TokenFormatJWT)
+}
+
+// AccessTokenHash computes the OpenID Connect at_hash of accessToken for an
+// ID token signed with alg: the left half of the token's hash, base64url
+// encoded. EdDSA with Ed25519 has no signing hash of its own and uses
+// SHA-512, as OpenID Connect providers do.
+func AccessTokenHash(accessToken string, alg jwa.SignatureAlgorithm) (string, error) {
+	hash := core.SignerOptsFor(alg).HashFunc()
+	if alg == jwa.EdDSA() {
+		hash = crypto.SHA512
+	}
+	if hash == 0 || !hash.Available() {
+		return "", fmt.Errorf("%w: no hash for %s", core.ErrUnsupportedAlgorithm, alg)
+	}
+	h := hash.New()
+	h.Write([]byte(accessToken))
+	sum := h.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+// checkIDTokenClaims checks the audience, nonce and issuer of a validated ID token
+func (ts *tokenService) checkIDTokenClaims(tokenClaims *TokenClaims, clientID string, nonce string) error {
+	claims := tokenClaims.Claims
+
+	if !audienceContains(claims["aud"], clientID) {
+		return core.NewValidationError(core.ValidationCodeInvalidClaim, "aud", tokenClaims.KeyID,
+			fmt.Errorf("%w: token is not intended for %s", core.ErrInvalidClaim, clientID))
+	}
+	if tokenNonce, _ := claims["nonce"].(string); nonce != "" && tokenNonce != nonce {
+		return core.NewValidationError(core.ValidationCodeInvalidClaim, "nonce", tokenClaims.KeyID,
+			fmt.Errorf("%w: nonce does not match", core.ErrInvalidClaim))
+	}
+	if issuer, _ := claims["iss"].(string); ts.config.Issuer != "" && issuer != ts.config.Issuer {
+		return core.NewValidationError(core.ValidationCodeInvalidClaim, "iss", tokenClaims.KeyID,
+			fmt.Errorf("%w: unexpected issuer %q", core.ErrInvalidClaim, issuer))
+	}
+	return nil
+}
+
+// audienceContains reports whether an aud claim, a string or a list, names audience
+func audienceContains(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	case []string:
+		return slices.Contains(aud, audience)
+	}
+	return false
+}
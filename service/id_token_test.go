@@ -0,0 +1,104 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+func TestAccessTokenHash(t *testing.T) {
+	const accessToken = "access-token"
+	leftHalf := func(sum []byte) string {
+		return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	}
+	sha256Sum := sha256.Sum256([]byte(accessToken))
+	sha384Sum := sha512.Sum384([]byte(accessToken))
+	sha512Sum := sha512.Sum512([]byte(accessToken))
+
+	tests := []struct {
+		alg  jwa.SignatureAlgorithm
+		want string
+	}{
+		{jwa.RS256(), leftHalf(sha256Sum[:])},
+		{jwa.ES256(), leftHalf(sha256Sum[:])},
+		{jwa.PS384(), leftHalf(sha384Sum[:])},
+		{jwa.ES512(), leftHalf(sha512Sum[:])},
+		{jwa.EdDSA(), leftHalf(sha512Sum[:])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg.String(), func(t *testing.T) {
+			got, err := AccessTokenHash(accessToken, tt.alg)
+			if err != nil {
+				t.Fatalf("AccessTokenHash: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("AccessTokenHash = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := AccessTokenHash(accessToken, jwa.HS256()); !errors.Is(err, core.ErrUnsupportedAlgorithm) {
+		t.Errorf("AccessTokenHash(HS256) error = %v, want ErrUnsupportedAlgorithm", err)
+	}
+}
+
+func TestEdDSAIDTokenCarriesAccessTokenHash(t *testing.T) {
+	config := core.NewConfigBuilder().WithAlgorithm("EdDSA").WithClock(authtest.NewFakeClock(testStart)).Build()
+	tokenService := NewServiceFactory(config).CreateTokenService()
+
+	accessToken, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice"}, "app")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	idToken, err := tokenService.CreateIDToken(&IDTokenRequest{
+		Subject:     "alice",
+		Audience:    []string{"app"},
+		AccessToken: accessToken,
+	}, "app")
+	if err != nil {
+		t.Fatalf("CreateIDToken: %v", err)
+	}
+
+	claims, err := tokenService.ValidateIDToken(idToken, "app", "")
+	if err != nil {
+		t.Fatalf("ValidateIDToken: %v", err)
+	}
+	sum := sha512.Sum512([]byte(accessToken))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:32]); claims.Claims["at_hash"] != want {
+		t.Errorf("at_hash = %v, want %s", claims.Claims["at_hash"], want)
+	}
+}
+
+func TestIDTokenWithAccessTokenOnNewPrefix(t *testing.T) {
+	config := testConfig(authtest.NewFakeClock(testStart))
+	tokenService := NewServiceFactory(config).CreateTokenService()
+
+	accessToken, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	// No key exists for the ID token's prefix yet
+	idToken, err := tokenService.CreateIDToken(&IDTokenRequest{
+		Subject:     "alice",
+		Audience:    []string{"app"},
+		AccessToken: accessToken,
+	}, "oidc")
+	if err != nil {
+		t.Fatalf("CreateIDToken: %v", err)
+	}
+
+	claims, err := tokenService.ValidateIDToken(idToken, "app", "")
+	if err != nil {
+		t.Fatalf("ValidateIDToken: %v", err)
+	}
+	sum := sha256.Sum256([]byte(accessToken))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:16]); claims.Claims["at_hash"] != want {
+		t.Errorf("at_hash = %v, want %s", claims.Claims["at_hash"], want)
+	}
+}
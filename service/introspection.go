@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// Token types reported by introspection
+const (
+	// TokenTypeBearer is the type of unbound and certificate-bound access tokens
+	TokenTypeBearer = "Bearer"
+	// TokenTypeDPoP is the type of access tokens bound to a DPoP key
+	TokenTypeDPoP = "DPoP"
+	// TokenTypeRefreshToken identifies refresh tokens (RFC 8693)
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	// TokenTypeIDToken identifies OpenID Connect ID tokens (RFC 8693)
+	TokenTypeIDToken = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+// IntrospectionResponse is an RFC 7662 token introspection response
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	TokenID   string   `json:"jti,omitempty"`
+	// Purpose is an extension member carrying the token purpose
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// Introspect reports whether token is active and, if so, what it stands for.
+// Invalid, expired and revoked tokens are reported as inactive rather than
+// as errors; an error means the token's state could not be determined.
+func (ts *tokenService) Introspect(token string) (*IntrospectionResponse, error) {
+	return ts.IntrospectContext(context.Background(), token)
+}
+
+func (ts *tokenService) IntrospectContext(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	tokenClaims, err := ts.validate(ctx, token, "")
+	var validationErr *core.ValidationError
+	if errors.As(err, &validationErr) {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return introspectionResponseFor(tokenClaims), nil
+}
+
+// introspectionResponseFor describes an active token
+func introspectionResponseFor(tokenClaims *TokenClaims) *IntrospectionResponse {
+	claims := tokenClaims.Claims
+	response := &IntrospectionResponse{
+		Active:    true,
+		TokenType: tokenTypeOf(tokenClaims),
+		TokenID:   tokenClaims.TokenID,
+		Purpose:   tokenClaims.Purpose,
+	}
+	if !tokenClaims.ExpiresAt.IsZero() {
+		response.ExpiresAt = tokenClaims.ExpiresAt.Unix()
+	}
+	if !tokenClaims.IssuedAt.IsZero() {
+		response.IssuedAt = tokenClaims.IssuedAt.Unix()
+	}
+	response.Scope, _ = claims["scope"].(string)
+	response.ClientID, _ = claims["client_id"].(string)
+	response.Username, _ = claims["username"].(string)
+	response.Subject, _ = claims["sub"].(string)
+	response.Issuer, _ = claims["iss"].(string)
+	if nbf, ok := claims["nbf"].(float64); ok {
+		response.NotBefore = int64(nbf)
+	}
+
+	switch aud := claims["aud"].(type) {
+	case string:
+		response.Audience = []string{aud}
+	case []any:
+		for _, value := range aud {
+			if audience, ok := value.(string); ok {
+				response.Audience = append(response.Audience, audience)
+			}
+		}
+	case []string:
+		response.Audience = aud
+	}
+	return response
+}
+
+// tokenTypeOf derives the token_type of a token from its purpose and binding
+func tokenTypeOf(tokenClaims *TokenClaims) string {
+	switch {
+	case tokenClaims.Purpose == "refresh":
+		return TokenTypeRefreshToken
+	case tokenClaims.Purpose == IDTokenPurpose:
+		return TokenTypeIDToken
+	case tokenClaims.DPoPThumbprint() != "":
+		return TokenTypeDPoP
+	}
+	return TokenTypeBearer
+}
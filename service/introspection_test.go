@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+func TestTokenPairSharesFamily(t *testing.T) {
+	a, _ := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+
+	// Without access claims the access token still joins the family
+	accessToken, refreshToken, err := a.GenerateAccessRefreshTokenPair(nil, nil, "web")
+	if err != nil {
+		t.Fatalf("GenerateAccessRefreshTokenPair: %v", err)
+	}
+	access, err := a.ValidateToken(accessToken, "access")
+	if err != nil {
+		t.Fatalf("ValidateToken(access): %v", err)
+	}
+	refresh, err := a.ValidateToken(refreshToken, "refresh")
+	if err != nil {
+		t.Fatalf("ValidateToken(refresh): %v", err)
+	}
+	if access.FamilyID == "" || access.FamilyID != refresh.FamilyID {
+		t.Fatalf("access family %q, refresh family %q, want the same non-empty family", access.FamilyID, refresh.FamilyID)
+	}
+
+	if err := a.RevokeTokenClaims(refresh); err != nil {
+		t.Fatalf("RevokeTokenClaims: %v", err)
+	}
+	if _, err := a.ValidateToken(accessToken, "access"); !errors.Is(err, core.ErrTokenRevoked) {
+		t.Fatalf("ValidateToken for the family's access token error = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func newOpaqueTokenService(t *testing.T, clock core.Clock, store TokenStore) TokenService {
+	t.Helper()
+	config := core.NewConfigBuilder().WithAlgorithm("ES256").WithClock(clock).WithTokenExpiry(time.Hour).Build()
+	return NewServiceFactory(config, WithOpaqueTokens(store)).CreateTokenService()
+}
+
+func TestOpaqueTokensKeepClaimsServerSide(t *testing.T) {
+	store := NewMemoryTokenStore()
+	tokenService := newOpaqueTokenService(t, authtest.NewFakeClock(testStart), store)
+
+	token, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice", "scope": "read"}, "partner")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	if strings.Count(token, ".") != 0 || strings.Contains(token, "alice") {
+		t.Fatalf("opaque token %q looks self-contained", token)
+	}
+
+	// Records are kept under a hash of the token, never the token itself
+	if _, err := store.Get(context.Background(), token); !errors.Is(err, core.ErrTokenNotFound) {
+		t.Errorf("store lookup by raw token error = %v, want ErrTokenNotFound", err)
+	}
+	if _, err := store.Get(context.Background(), referenceKey(token)); err != nil {
+		t.Errorf("store lookup by reference key: %v", err)
+	}
+
+	claims, err := tokenService.ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.Claims["sub"] != "alice" || claims.TokenID == "" {
+		t.Errorf("claims = %+v, want sub alice and a token ID", claims)
+	}
+	if _, err := tokenService.ValidateRefreshToken(token); !errors.Is(err, core.ErrInvalidTokenPurpose) {
+		t.Errorf("ValidateRefreshToken error = %v, want ErrInvalidTokenPurpose", err)
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	tokenService := newOpaqueTokenService(t, clock, NewMemoryTokenStore())
+
+	opaque, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice", "scope": "read", "client_id": "partner"}, "partner")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	response, err := tokenService.Introspect(opaque)
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	want := &IntrospectionResponse{
+		Active:    true,
+		Scope:     "read",
+		ClientID:  "partner",
+		Subject:   "alice",
+		TokenType: TokenTypeBearer,
+		IssuedAt:  testStart.Unix(),
+		ExpiresAt: testStart.Add(time.Hour).Unix(),
+		TokenID:   response.TokenID,
+		Purpose:   "access",
+	}
+	if response.TokenID == "" || !reflect.DeepEqual(response, want) {
+		t.Errorf("Introspect = %+v, want %+v", response, want)
+	}
+
+	inactive := map[string]string{"unknown": "not-a-token", "malformed jwt": "a.b.c"}
+	for name, token := range inactive {
+		response, err := tokenService.Introspect(token)
+		if err != nil || response.Active {
+			t.Errorf("Introspect(%s) = %+v, %v, want inactive", name, response, err)
+		}
+	}
+
+	clock.Advance(time.Hour)
+	if response, err := tokenService.Introspect(opaque); err != nil || response.Active {
+		t.Errorf("Introspect after expiry = %+v, %v, want inactive", response, err)
+	}
+}
+
+func TestIntrospectReportsRevokedTokensInactive(t *testing.T) {
+	tokenService := newOpaqueTokenService(t, authtest.NewFakeClock(testStart), NewMemoryTokenStore())
+	token, err := tokenService.CreateRefreshToken(map[string]any{"sub": "alice"}, "partner")
+	if err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	if err := tokenService.RevokeToken(token, "", ""); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+
+	response, err := tokenService.Introspect(token)
+	if err != nil || response.Active {
+		t.Fatalf("Introspect = %+v, %v, want inactive", response, err)
+	}
+}
+
+func TestIntrospectReportsTokenType(t *testing.T) {
+	tokenService := NewServiceFactory(testConfig(authtest.NewFakeClock(testStart))).CreateTokenService()
+	dpopClaims := map[string]any{"sub": "alice"}
+	BindDPoPKey(dpopClaims, "thumbprint")
+	certificateClaims := map[string]any{"sub": "alice"}
+	confirmationOf(certificateClaims)[CertificateThumbprintMember] = "thumbprint"
+
+	issue := func(create func() (string, error)) string {
+		t.Helper()
+		token, err := create()
+		if err != nil {
+			t.Fatalf("issue: %v", err)
+		}
+		return token
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"bearer", issue(func() (string, error) {
+			return tokenService.CreateAccessToken(map[string]any{"sub": "alice"}, "web")
+		}), TokenTypeBearer},
+		{"dpop", issue(func() (string, error) { return tokenService.CreateAccessToken(dpopClaims, "mobile") }), TokenTypeDPoP},
+		{"certificate", issue(func() (string, error) {
+			return tokenService.CreateAccessToken(certificateClaims, "partner")
+		}), TokenTypeBearer},
+		{"refresh", issue(func() (string, error) {
+			return tokenService.CreateRefreshToken(map[string]any{"sub": "alice"}, "web")
+		}), TokenTypeRefreshToken},
+		{"id", issue(func() (string, error) {
+			return tokenService.CreateIDToken(&IDTokenRequest{Subject: "alice", Audience: []string{"app"}}, "web")
+		}), TokenTypeIDToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := tokenService.Introspect(tt.token)
+			if err != nil || !response.Active {
+				t.Fatalf("Introspect = %+v, %v, want active", response, err)
+			}
+			if response.TokenType != tt.want {
+				t.Errorf("token_type = %q, want %q", response.TokenType, tt.want)
+			}
+		})
+	}
+}
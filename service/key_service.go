@@ -1,6 +1,9 @@
 package service
 
 import (
+	"context"
+	"time"
+
 	"github.com/sushan531/jwk-auth/core"
 )
 
@@ -11,41 +14,176 @@ type KeyService interface {
 	ListKeys() ([]string, error)
 	CleanupUnusedKeys() error
 	ExportPublicKeys() ([]byte, error)
+	ExportJWKS() ([]byte, error)
 	ImportKeys(jwkSetJSON string) error
+	ImportSigningKey(keyPrefix string, data []byte, format core.KeyFormat, algorithm string) error
+	ExportSigningKey(keyPrefix string, format core.KeyFormat) ([]byte, error)
+	RegisterSigner(keyPrefix string, signer core.Signer) error
+	MarkCompromised(keyRef string, reason string, at time.Time) error
+
+	// Context-aware variants; the methods above call these with context.Background()
+	RotateKeyContext(ctx context.Context, keyPrefix string) error
+	GetKeyMetadataContext(ctx context.Context, keyPrefix string) (*core.KeyMetadata, error)
+	ListKeysContext(ctx context.Context) ([]string, error)
+	CleanupUnusedKeysContext(ctx context.Context) error
+	ExportPublicKeysContext(ctx context.Context) ([]byte, error)
+	ExportJWKSContext(ctx context.Context) ([]byte, error)
+	ImportKeysContext(ctx context.Context, jwkSetJSON string) error
+	ImportSigningKeyContext(ctx context.Context, keyPrefix string, data []byte, format core.KeyFormat, algorithm string) error
+	ExportSigningKeyContext(ctx context.Context, keyPrefix string, format core.KeyFormat) ([]byte, error)
+	RegisterSignerContext(ctx context.Context, keyPrefix string, signer core.Signer) error
+	MarkCompromisedContext(ctx context.Context, keyRef string, reason string, at time.Time) error
 }
 
 type keyService struct {
 	jwkManager core.JwkManager
+	publisher  *TokenEventPublisher
+	clock      core.Clock
+}
+
+// KeyServiceOption configures optional KeyService dependencies
+type KeyServiceOption func(*keyService)
+
+// WithKeyClock sets the clock used for event timestamps
+func WithKeyClock(clock core.Clock) KeyServiceOption {
+	return func(ks *keyService) {
+		ks.clock = clock
+	}
 }
 
-func NewKeyService(jwkManager core.JwkManager) KeyService {
-	return &keyService{
+// WithKeyEventPublisher reports key lifecycle events through publisher
+func WithKeyEventPublisher(publisher *TokenEventPublisher) KeyServiceOption {
+	return func(ks *keyService) {
+		ks.publisher = publisher
+	}
+}
+
+func NewKeyService(jwkManager core.JwkManager, opts ...KeyServiceOption) KeyService {
+	ks := &keyService{
 		jwkManager: jwkManager,
+		clock:      core.SystemClock(),
 	}
+	for _, opt := range opts {
+		opt(ks)
+	}
+	return ks
 }
 
 func (ks *keyService) RotateKey(keyPrefix string) error {
-	return ks.jwkManager.AddOrReplaceKeyToSet(keyPrefix)
+	return ks.RotateKeyContext(context.Background(), keyPrefix)
+}
+
+func (ks *keyService) RotateKeyContext(ctx context.Context, keyPrefix string) error {
+	return ks.jwkManager.AddOrReplaceKeyToSetContext(ctx, keyPrefix)
 }
 
 func (ks *keyService) GetKeyMetadata(keyPrefix string) (*core.KeyMetadata, error) {
-	return ks.jwkManager.GetKeyMetadata(keyPrefix)
+	return ks.GetKeyMetadataContext(context.Background(), keyPrefix)
+}
+
+func (ks *keyService) GetKeyMetadataContext(ctx context.Context, keyPrefix string) (*core.KeyMetadata, error) {
+	return ks.jwkManager.GetKeyMetadataContext(ctx, keyPrefix)
 }
 
 func (ks *keyService) ListKeys() ([]string, error) {
+	return ks.ListKeysContext(context.Background())
+}
+
+func (ks *keyService) ListKeysContext(ctx context.Context) ([]string, error) {
 	// Implementation would depend on adding a ListKeys method to JwkManager
 	// This is a placeholder for the interface
 	return nil, nil
 }
 
 func (ks *keyService) CleanupUnusedKeys() error {
-	return ks.jwkManager.CleanupExpiredKeys()
+	return ks.CleanupUnusedKeysContext(context.Background())
+}
+
+func (ks *keyService) CleanupUnusedKeysContext(ctx context.Context) error {
+	return ks.jwkManager.CleanupExpiredKeysContext(ctx)
 }
 
 func (ks *keyService) ExportPublicKeys() ([]byte, error) {
-	return ks.jwkManager.GetJwkSetForStorage()
+	return ks.ExportPublicKeysContext(context.Background())
+}
+
+func (ks *keyService) ExportPublicKeysContext(ctx context.Context) ([]byte, error) {
+	return ks.jwkManager.GetJwkSetForStorageContext(ctx)
+}
+
+// ExportJWKS returns the public verification keys as a JWKS document that
+// is safe to publish
+func (ks *keyService) ExportJWKS() ([]byte, error) {
+	return ks.ExportJWKSContext(context.Background())
+}
+
+func (ks *keyService) ExportJWKSContext(ctx context.Context) ([]byte, error) {
+	return ks.jwkManager.GetPublicJwkSetContext(ctx)
 }
 
 func (ks *keyService) ImportKeys(jwkSetJSON string) error {
-	return ks.jwkManager.GetJwkSetFromStorage(jwkSetJSON)
+	return ks.ImportKeysContext(context.Background(), jwkSetJSON)
+}
+
+func (ks *keyService) ImportKeysContext(ctx context.Context, jwkSetJSON string) error {
+	return ks.jwkManager.GetJwkSetFromStorageContext(ctx, jwkSetJSON)
+}
+
+// ImportSigningKey imports a single private key for keyPrefix, e.g. when
+// migrating keys from another service
+func (ks *keyService) ImportSigningKey(keyPrefix string, data []byte, format core.KeyFormat, algorithm string) error {
+	return ks.ImportSigningKeyContext(context.Background(), keyPrefix, data, format, algorithm)
+}
+
+func (ks *keyService) ImportSigningKeyContext(ctx context.Context, keyPrefix string, data []byte, format core.KeyFormat, algorithm string) error {
+	return ks.jwkManager.ImportSigningKeyContext(ctx, keyPrefix, data, format, algorithm)
+}
+
+// ExportSigningKey exports the private key for keyPrefix
+func (ks *keyService) ExportSigningKey(keyPrefix string, format core.KeyFormat) ([]byte, error) {
+	return ks.ExportSigningKeyContext(context.Background(), keyPrefix, format)
+}
+
+func (ks *keyService) ExportSigningKeyContext(ctx context.Context, keyPrefix string, format core.KeyFormat) ([]byte, error) {
+	return ks.jwkManager.ExportSigningKeyContext(ctx, keyPrefix, format)
+}
+
+// RegisterSigner uses an external signer, such as an HSM-backed key, for keyPrefix
+func (ks *keyService) RegisterSigner(keyPrefix string, signer core.Signer) error {
+	return ks.RegisterSignerContext(context.Background(), keyPrefix, signer)
+}
+
+func (ks *keyService) RegisterSignerContext(ctx context.Context, keyPrefix string, signer core.Signer) error {
+	return ks.jwkManager.RegisterSignerContext(ctx, keyPrefix, signer)
+}
+
+// MarkCompromised revokes the signing capability of the key for keyRef,
+// records the reason and rejects tokens signed by it that were issued before at
+func (ks *keyService) MarkCompromised(keyRef string, reason string, at time.Time) error {
+	return ks.MarkCompromisedContext(context.Background(), keyRef, reason, at)
+}
+
+func (ks *keyService) MarkCompromisedContext(ctx context.Context, keyRef string, reason string, at time.Time) error {
+	if at.IsZero() {
+		at = ks.clock.Now()
+	}
+
+	metadata, err := ks.jwkManager.MarkKeyCompromisedContext(ctx, keyRef, reason, at)
+	if err != nil {
+		return err
+	}
+
+	if ks.publisher != nil {
+		ks.publisher.Publish(TokenEvent{
+			Type:      EventKeyCompromised,
+			KeyPrefix: keyRef,
+			Timestamp: ks.clock.Now(),
+			Metadata: map[string]any{
+				"key_id":         metadata.KeyID,
+				"reason":         metadata.CompromiseReason,
+				"compromised_at": *metadata.CompromisedAt,
+			},
+		})
+	}
+	return nil
 }
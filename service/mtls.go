@@ -0,0 +1,55 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// CertificateThumbprintMember is the cnf member holding the SHA-256
+// thumbprint of the certificate a token is bound to (RFC 8705)
+const CertificateThumbprintMember = "x5t#S256"
+
+// CertificateThumbprint computes the base64url SHA-256 thumbprint of cert's DER encoding
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// BindCertificate binds the token issued with claims to cert by setting cnf.x5t#S256
+func BindCertificate(claims map[string]any, cert *x509.Certificate) {
+	confirmationOf(claims)[CertificateThumbprintMember] = CertificateThumbprint(cert)
+}
+
+// WithClientCertificate binds the token to cert by setting cnf.x5t#S256, as
+// BindCertificate does. It cannot be combined with WithDPoPProof. A nil
+// cert leaves the token unbound.
+func WithClientCertificate(cert *x509.Certificate) IssueOption {
+	return func(o *issueOptions) {
+		if cert != nil {
+			o.certificateThumbprint = CertificateThumbprint(cert)
+		}
+	}
+}
+
+// CertificateThumbprint returns the certificate thumbprint the token is
+// bound to, or "" for tokens without a certificate binding
+func (tc *TokenClaims) CertificateThumbprint() string {
+	cnf, _ := tc.Claims[ConfirmationClaim].(map[string]any)
+	thumbprint, _ := cnf[CertificateThumbprintMember].(string)
+	return thumbprint
+}
+
+// CheckCertificateBinding checks that cert is the client certificate the
+// token is bound to
+func CheckCertificateBinding(tokenClaims *TokenClaims, cert *x509.Certificate) error {
+	thumbprint := tokenClaims.CertificateThumbprint()
+	if thumbprint == "" || cert == nil || CertificateThumbprint(cert) != thumbprint {
+		return core.NewValidationError(core.ValidationCodeCertificateMismatch, "cnf", tokenClaims.KeyID,
+			fmt.Errorf("%w: client certificate does not match", core.ErrTokenBindingMismatch))
+	}
+	return nil
+}
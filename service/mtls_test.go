@@ -0,0 +1,126 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// newTestCertificate returns a self-signed client certificate for name
+func newTestCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    testStart,
+		NotAfter:     testStart.Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert
+}
+
+func TestCertificateThumbprint(t *testing.T) {
+	cert := newTestCertificate(t, "billing")
+	sum := sha256.Sum256(cert.Raw)
+	if got, want := CertificateThumbprint(cert), base64.RawURLEncoding.EncodeToString(sum[:]); got != want {
+		t.Errorf("CertificateThumbprint = %s, want %s", got, want)
+	}
+}
+
+func TestCertificateBoundToken(t *testing.T) {
+	a, _ := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+	cert := newTestCertificate(t, "billing")
+
+	claims := map[string]any{"sub": "billing"}
+	BindCertificate(claims, cert)
+	token, err := a.GenerateToken(claims, "mesh", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	tokenClaims, err := a.ValidateToken(token, "access")
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if tokenClaims.CertificateThumbprint() != CertificateThumbprint(cert) {
+		t.Fatalf("token bound to %q, want the certificate thumbprint", tokenClaims.CertificateThumbprint())
+	}
+
+	if err := CheckCertificateBinding(tokenClaims, cert); err != nil {
+		t.Errorf("CheckCertificateBinding with the bound certificate: %v", err)
+	}
+	for name, other := range map[string]*x509.Certificate{"other certificate": newTestCertificate(t, "orders"), "no certificate": nil} {
+		err := CheckCertificateBinding(tokenClaims, other)
+		var validationErr *core.ValidationError
+		if !errors.Is(err, core.ErrTokenBindingMismatch) || !errors.As(err, &validationErr) ||
+			validationErr.Code != core.ValidationCodeCertificateMismatch {
+			t.Errorf("CheckCertificateBinding with %s error = %v, want a certificate mismatch", name, err)
+		}
+	}
+}
+
+func TestWithClientCertificate(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	cert := newTestCertificate(t, "billing")
+	services := map[string]TokenService{
+		"jwt":    NewServiceFactory(testConfig(clock)).CreateTokenService(),
+		"opaque": newOpaqueTokenService(t, clock, NewMemoryTokenStore()),
+	}
+	for name, tokenService := range services {
+		t.Run(name, func(t *testing.T) {
+			token, err := tokenService.CreateAccessToken(map[string]any{"sub": "billing"}, "mesh", WithClientCertificate(cert))
+			if err != nil {
+				t.Fatalf("CreateAccessToken: %v", err)
+			}
+			claims, err := tokenService.ValidateAccessToken(token)
+			if err != nil {
+				t.Fatalf("ValidateAccessToken: %v", err)
+			}
+			if err := CheckCertificateBinding(claims, cert); err != nil {
+				t.Errorf("CheckCertificateBinding: %v", err)
+			}
+		})
+	}
+
+	a, _ := newTestAuth(t, testConfig(clock))
+	proof := &DPoPProof{Thumbprint: "thumbprint", TokenID: "proof-1", IssuedAt: testStart}
+	_, err := a.GenerateToken(map[string]any{"sub": "billing"}, "mesh", time.Hour, "access",
+		WithClientCertificate(cert), WithDPoPProof(proof))
+	if !errors.Is(err, core.ErrInvalidClaim) {
+		t.Errorf("GenerateToken with both bindings error = %v, want ErrInvalidClaim", err)
+	}
+	_, err = services["opaque"].CreateAccessToken(nil, "mesh", WithDPoPProof(proof), WithClientCertificate(cert))
+	if !errors.Is(err, core.ErrInvalidClaim) {
+		t.Errorf("CreateAccessToken with both bindings error = %v, want ErrInvalidClaim", err)
+	}
+
+	unbound, err := a.GenerateToken(nil, "mesh", time.Hour, "access", WithClientCertificate(nil))
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if claims, err := a.ValidateToken(unbound, "access"); err != nil || claims.CertificateThumbprint() != "" {
+		t.Errorf("token issued with a nil certificate: claims %v, error %v, want no binding", claims, err)
+	}
+}
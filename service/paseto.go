@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// pasetoV4PublicHeader starts every v4.public PASETO token
+const pasetoV4PublicHeader = "v4.public."
+
+// pasetoTimeClaims are the registered claims PASETO encodes as RFC 3339 strings
+var pasetoTimeClaims = []string{"exp", "nbf", "iat"}
+
+// pasetoFooter is the JSON footer of issued PASETO tokens
+type pasetoFooter struct {
+	KeyID string `json:"kid"`
+}
+
+// isPASETOToken reports whether token is a v4.public PASETO token
+func isPASETOToken(token string) bool {
+	return strings.HasPrefix(token, pasetoV4PublicHeader)
+}
+
+// pae is the PASETO pre-authentication encoding of pieces
+func pae(pieces ...[]byte) []byte {
+	out := binary.LittleEndian.AppendUint64(nil, uint64(len(pieces)))
+	for _, piece := range pieces {
+		out = binary.LittleEndian.AppendUint64(out, uint64(len(piece)))
+		out = append(out, piece...)
+	}
+	return out
+}
+
+// signPASETO encodes claims as a v4.public token signed by signer, which
+// must hold an Ed25519 key. iat, exp and jti are added as for JWTs, and
+// explicit claims win as they do for JWTs. Time claims given as seconds
+// since the epoch or as time.Time are encoded as RFC 3339 strings.
+func signPASETO(ctx context.Context, signer core.Signer, claims map[string]any, now time.Time, expiry time.Duration) (string, error) {
+	if _, ok := signer.Public().(ed25519.PublicKey); !ok || signer.Algorithm() != jwa.EdDSA() {
+		return "", fmt.Errorf("%w: PASETO v4.public requires an Ed25519 key, %s uses %s", core.ErrAlgorithmMismatch, signer.KeyID(), signer.Algorithm())
+	}
+
+	payload := map[string]any{
+		"iat": now,
+		"exp": now.Add(expiry),
+	}
+	maps.Copy(payload, claims)
+	for _, name := range pasetoTimeClaims {
+		value, exists := payload[name]
+		if !exists {
+			continue
+		}
+		encoded, err := pasetoTime(value)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s: %v", core.ErrInvalidClaim, name, err)
+		}
+		payload[name] = encoded
+	}
+	if _, exists := payload["jti"]; !exists {
+		tokenID, err := core.NewTokenID()
+		if err != nil {
+			return "", err
+		}
+		payload["jti"] = tokenID
+	}
+
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode claims: %w", err)
+	}
+	footer, err := json.Marshal(pasetoFooter{KeyID: signer.KeyID()})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode footer: %w", err)
+	}
+
+	// Ed25519 signers sign the full input rather than a digest
+	signature, err := signer.SignDigest(ctx, pae([]byte(pasetoV4PublicHeader), message, footer, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	if len(signature) != ed25519.SignatureSize {
+		return "", fmt.Errorf("failed to sign token: signature of %d bytes", len(signature))
+	}
+
+	return pasetoV4PublicHeader +
+		base64.RawURLEncoding.EncodeToString(append(message, signature...)) + "." +
+		base64.RawURLEncoding.EncodeToString(footer), nil
+}
+
+// pasetoTime encodes a time claim as an RFC 3339 string. Numbers are
+// seconds since the epoch, as in JWTs.
+func pasetoTime(value any) (string, error) {
+	var t time.Time
+	switch value := value.(type) {
+	case time.Time:
+		t = value
+	case int64:
+		t = time.Unix(value, 0)
+	case int:
+		t = time.Unix(int64(value), 0)
+	case float64:
+		t = time.Unix(int64(value), 0)
+	case string:
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "", fmt.Errorf("must be an RFC 3339 time")
+		}
+		t = parsed
+	default:
+		return "", fmt.Errorf("unsupported type %T", value)
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// verifyPASETO checks a v4.public token. The key is resolved from the
+// footer kid and must be an Ed25519 key allowed for EdDSA. exp, nbf and iat
+// are validated against the configured clock and returned as seconds since
+// the epoch, as for JWTs.
+func (a *auth) verifyPASETO(ctx context.Context, token string, lookup keyLookup) (*verifiedToken, error) {
+	body, encodedFooter, _ := strings.Cut(strings.TrimPrefix(token, pasetoV4PublicHeader), ".")
+	signed, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil || len(signed) < ed25519.SignatureSize {
+		return nil, core.NewValidationError(core.ValidationCodeMalformed, "", "", fmt.Errorf("%w: invalid PASETO body", core.ErrInvalidTokenFormat))
+	}
+	footer, err := base64.RawURLEncoding.DecodeString(encodedFooter)
+	if err != nil {
+		return nil, core.NewValidationError(core.ValidationCodeMalformed, "", "", fmt.Errorf("%w: invalid PASETO footer", core.ErrInvalidTokenFormat))
+	}
+
+	var decodedFooter pasetoFooter
+	if len(footer) == 0 || json.Unmarshal(footer, &decodedFooter) != nil {
+		return nil, core.NewValidationError(core.ValidationCodeMissingKid, "kid", "", core.ErrMissingKidClaim)
+	}
+	kid := decodedFooter.KeyID
+	if kid == "" {
+		return nil, core.NewValidationError(core.ValidationCodeInvalidKid, "kid", "", core.ErrInvalidKidClaim)
+	}
+
+	publicKey, _, keyErr := a.verificationKey(ctx, kid, jwa.EdDSA().String(), lookup)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	edPublicKey, ok := publicKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, core.NewValidationError(core.ValidationCodeAlgorithm, "alg", kid,
+			fmt.Errorf("%w: PASETO v4.public requires an Ed25519 key", core.ErrAlgorithmMismatch))
+	}
+
+	message := signed[:len(signed)-ed25519.SignatureSize]
+	signature := signed[len(signed)-ed25519.SignatureSize:]
+	if !ed25519.Verify(edPublicKey, pae([]byte(pasetoV4PublicHeader), message, footer, nil), signature) {
+		return nil, core.NewValidationError(core.ValidationCodeInvalidSignature, "", kid, core.ErrInvalidSignature)
+	}
+
+	var claims map[string]any
+	if err := json.Unmarshal(message, &claims); err != nil {
+		return nil, core.NewValidationError(core.ValidationCodeMalformed, "", kid, fmt.Errorf("%w: %v", core.ErrInvalidTokenFormat, err))
+	}
+
+	times := make(map[string]time.Time, len(pasetoTimeClaims))
+	for _, name := range pasetoTimeClaims {
+		value, exists := claims[name]
+		if !exists {
+			continue
+		}
+		text, _ := value.(string)
+		parsed, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, core.NewValidationError(core.ValidationCodeMalformed, name, kid,
+				fmt.Errorf("%w: %s must be an RFC 3339 time", core.ErrInvalidTokenFormat, name))
+		}
+		times[name] = parsed
+		claims[name] = float64(parsed.Unix())
+	}
+
+	now := a.config.Now()
+	if exp, exists := times["exp"]; exists && !now.Before(exp) {
+		return nil, core.NewValidationError(core.ValidationCodeExpired, "exp", kid, core.ErrTokenExpired)
+	}
+	if nbf, exists := times["nbf"]; exists && now.Before(nbf) {
+		return nil, core.NewValidationError(core.ValidationCodeNotYetValid, "nbf", kid, core.ErrTokenNotYetValid)
+	}
+	if iat, exists := times["iat"]; exists && now.Before(iat) {
+		return nil, core.NewValidationError(core.ValidationCodeNotYetValid, "iat", kid, core.ErrTokenNotYetValid)
+	}
+
+	if err := a.jwkManager.CheckKeyCompromiseContext(ctx, kid, times["iat"]); err != nil {
+		return nil, core.NewValidationError(core.ValidationCodeKeyCompromised, "iat", kid, err)
+	}
+	return &verifiedToken{claims: claims, keyID: kid}, nil
+}
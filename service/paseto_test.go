@@ -0,0 +1,220 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// pasetoConfig returns a config issuing Ed25519 keys, as PASETO v4.public requires
+func pasetoConfig(clock core.Clock) *core.Config {
+	return core.NewConfigBuilder().WithAlgorithm("EdDSA").WithClock(clock).Build()
+}
+
+func TestPAE(t *testing.T) {
+	tests := []struct {
+		name   string
+		pieces [][]byte
+		want   string
+	}{
+		{"no pieces", nil, "0000000000000000"},
+		{"empty piece", [][]byte{{}}, "0100000000000000" + "0000000000000000"},
+		{"test", [][]byte{[]byte("test")}, "0100000000000000" + "0400000000000000" + "74657374"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(pae(tt.pieces...)); got != tt.want {
+				t.Errorf("pae = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPASETOSignatureMatchesSpecVector(t *testing.T) {
+	// Test vector 4-S-1 of the PASETO specification
+	secretKey, _ := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774" +
+		"1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	message := []byte(`{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`)
+	const want = "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9" +
+		"bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+
+	signature := ed25519.Sign(ed25519.PrivateKey(secretKey), pae([]byte(pasetoV4PublicHeader), message, nil, nil))
+	if got := pasetoV4PublicHeader + base64.RawURLEncoding.EncodeToString(append(message, signature...)); got != want {
+		t.Errorf("token = %s, want %s", got, want)
+	}
+}
+
+func TestPASETORoundTrip(t *testing.T) {
+	tokenService := NewServiceFactory(pasetoConfig(authtest.NewFakeClock(testStart)),
+		WithIssuedTokenFormat(TokenFormatPASETO)).CreateTokenService()
+
+	token, err := tokenService.CreateAccessToken(map[string]any{"user_id": "u-42"}, "web")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	if !isPASETOToken(token) {
+		t.Fatalf("token %q is not a v4.public PASETO", token)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		t.Fatalf("token has %d parts, want 4", len(parts))
+	}
+	footer, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		t.Fatalf("decode footer: %v", err)
+	}
+	var decodedFooter pasetoFooter
+	if err := json.Unmarshal(footer, &decodedFooter); err != nil || decodedFooter.KeyID != "key-web" {
+		t.Errorf("footer = %s, want kid key-web", footer)
+	}
+
+	claims, err := tokenService.ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.Claims["user_id"] != "u-42" || claims.KeyID != "key-web" || claims.TokenID == "" {
+		t.Errorf("claims = %+v, want user_id u-42, kid key-web and a jti", claims)
+	}
+	if !claims.IssuedAt.Equal(testStart) {
+		t.Errorf("IssuedAt = %v, want %v", claims.IssuedAt, testStart)
+	}
+
+	if _, err := tokenService.ValidateRefreshToken(token); !errors.Is(err, core.ErrInvalidTokenPurpose) {
+		t.Errorf("ValidateRefreshToken(access) error = %v, want ErrInvalidTokenPurpose", err)
+	}
+}
+
+func TestPASETOValidationErrors(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	a, jwkManager := newTestAuth(t, pasetoConfig(clock), WithTokenFormat(TokenFormatPASETO))
+	token, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	body, encodedFooter, _ := strings.Cut(strings.TrimPrefix(token, pasetoV4PublicHeader), ".")
+	signed, _ := base64.RawURLEncoding.DecodeString(body)
+
+	// Flip a bit of the message, keeping the encoding valid
+	tampered := bytes.Clone(signed)
+	tampered[2] ^= 1
+	withFooter := func(footer string) string {
+		return pasetoV4PublicHeader + body + "." + base64.RawURLEncoding.EncodeToString([]byte(footer))
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		code  core.ValidationCode
+		want  error
+	}{
+		{"tampered", pasetoV4PublicHeader + base64.RawURLEncoding.EncodeToString(tampered) + "." + encodedFooter,
+			core.ValidationCodeInvalidSignature, core.ErrInvalidSignature},
+		{"other key id", withFooter(`{"kid":"key-other"}`), core.ValidationCodeUnknownKey, core.ErrKeyNotFound},
+		{"footer without kid", withFooter(`{}`), core.ValidationCodeInvalidKid, core.ErrInvalidKidClaim},
+		{"no footer", pasetoV4PublicHeader + body, core.ValidationCodeMissingKid, core.ErrMissingKidClaim},
+		{"truncated", pasetoV4PublicHeader + "AAAA." + encodedFooter, core.ValidationCodeMalformed, core.ErrInvalidTokenFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.ValidateToken(tt.token, "access")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+			var validationErr *core.ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Code != tt.code {
+				t.Errorf("error = %v, want code %s", err, tt.code)
+			}
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		clock.Advance(time.Hour)
+		defer clock.Set(testStart)
+		if _, err := a.ValidateToken(token, "access"); !errors.Is(err, core.ErrTokenExpired) {
+			t.Errorf("error = %v, want ErrTokenExpired", err)
+		}
+	})
+
+	t.Run("compromised key", func(t *testing.T) {
+		if _, err := jwkManager.MarkKeyCompromised("web", "leaked", testStart.Add(-time.Minute)); err != nil {
+			t.Fatalf("MarkKeyCompromised: %v", err)
+		}
+		if _, err := a.ValidateToken(token, "access"); !errors.Is(err, core.ErrKeyCompromised) {
+			t.Errorf("error = %v, want ErrKeyCompromised", err)
+		}
+	})
+}
+
+func TestPASETORequiresEd25519Key(t *testing.T) {
+	a, _ := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)), WithTokenFormat(TokenFormatPASETO))
+	if _, err := a.GenerateToken(nil, "web", time.Hour, "access"); !errors.Is(err, core.ErrAlgorithmMismatch) {
+		t.Errorf("GenerateToken with an ES256 key error = %v, want ErrAlgorithmMismatch", err)
+	}
+}
+
+func TestPASETOCannotBeEncrypted(t *testing.T) {
+	config := pasetoConfig(authtest.NewFakeClock(testStart))
+	keyring := newEncryptionKeyring(t, config, jwa.ECDH_ES())
+	tokenService := NewServiceFactory(config, WithIssuedTokenFormat(TokenFormatPASETO),
+		WithEncryptedTokens(keyring, keyring)).CreateTokenService()
+	if _, err := tokenService.CreateAccessToken(nil, "web"); !errors.Is(err, core.ErrInvalidTokenFormat) {
+		t.Errorf("CreateAccessToken error = %v, want ErrInvalidTokenFormat", err)
+	}
+}
+
+func TestPASETOAndJWTTokensBothValidate(t *testing.T) {
+	config := pasetoConfig(authtest.NewFakeClock(testStart))
+	jwkManager := core.NewJwkManager(config)
+	jwtManager := core.NewJwtManager(core.WithJwtClock(config))
+	pasetoAuth := NewAuth(jwkManager, jwtManager, config, WithTokenFormat(TokenFormatPASETO))
+	jwtAuth := NewAuth(jwkManager, jwtManager, config)
+
+	// Switching the format keeps tokens of the other format valid
+	pasetoToken, err := pasetoAuth.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "refresh")
+	if err != nil {
+		t.Fatalf("GenerateToken(PASETO): %v", err)
+	}
+	jwtToken, err := jwtAuth.GenerateToken(map[string]any{"sub": "bob"}, "web", time.Hour, "refresh")
+	if err != nil {
+		t.Fatalf("GenerateToken(JWT): %v", err)
+	}
+	if isPASETOToken(jwtToken) {
+		t.Fatalf("default format issued a PASETO token")
+	}
+	for _, validator := range []Auth{pasetoAuth, jwtAuth} {
+		for token, sub := range map[string]string{pasetoToken: "alice", jwtToken: "bob"} {
+			claims, err := validator.ValidateToken(token, "refresh")
+			if err != nil {
+				t.Fatalf("ValidateToken: %v", err)
+			}
+			if claims.Claims["sub"] != sub {
+				t.Errorf("sub = %v, want %s", claims.Claims["sub"], sub)
+			}
+		}
+	}
+}
+
+func TestPASETOTokensCanBeRevoked(t *testing.T) {
+	a, _ := newTestAuth(t, pasetoConfig(authtest.NewFakeClock(testStart)), WithTokenFormat(TokenFormatPASETO))
+	token, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if err := a.RevokeToken(token); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if _, err := a.ValidateToken(token, "access"); !errors.Is(err, core.ErrTokenRevoked) {
+		t.Errorf("ValidateToken after revocation error = %v, want ErrTokenRevoked", err)
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/sushan531/jwk-auth/core"
+	"gopkg.in/yaml.v3"
+)
+
+// RolesClaim holds the roles granted to a token, as a list of strings or a
+// space-delimited string
+const RolesClaim = "roles"
+
+// Role grants permissions, directly and through the roles it inherits.
+// Permissions follow the Scope rules, so articles:* grants articles:write
+// and "*" grants everything.
+type Role struct {
+	Permissions []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	Inherits    []string `json:"inherits,omitempty" yaml:"inherits,omitempty"`
+}
+
+// RolePolicy maps role names to the permissions they grant. RoleClaim names
+// the claim holding a token's roles; it defaults to RolesClaim.
+type RolePolicy struct {
+	RoleClaim string          `json:"role_claim,omitempty" yaml:"role_claim,omitempty"`
+	Roles     map[string]Role `json:"roles" yaml:"roles"`
+}
+
+// ParseRolePolicy decodes a JSON role policy such as
+//
+//	{"roles": {
+//	  "viewer": {"permissions": ["articles:read"]},
+//	  "editor": {"permissions": ["articles:write"], "inherits": ["viewer"]},
+//	  "admin":  {"permissions": ["*"]}
+//	}}
+//
+// Unknown fields are rejected so that typos do not silently drop rules.
+func ParseRolePolicy(data []byte) (*RolePolicy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var policy RolePolicy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("%w: %v", core.ErrInvalidRolePolicy, err)
+	}
+	return &policy, nil
+}
+
+// ParseRolePolicyYAML decodes a role policy written in YAML, with the same
+// fields as ParseRolePolicy:
+//
+//	roles:
+//	  viewer: {permissions: ["articles:read"]}
+//	  editor: {permissions: ["articles:write"], inherits: [viewer]}
+//
+// Unknown fields are rejected, as they are in JSON.
+func ParseRolePolicyYAML(data []byte) (*RolePolicy, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var policy RolePolicy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("%w: %v", core.ErrInvalidRolePolicy, err)
+	}
+	return &policy, nil
+}
+
+// Authorizer decides what a validated token may do from the roles it carries
+type Authorizer interface {
+	// Authorize returns an error wrapping core.ErrPermissionDenied unless
+	// one of the token's roles grants permission
+	Authorize(claims *TokenClaims, permission string) error
+	// Permissions returns every permission granted by the token's roles
+	Permissions(claims *TokenClaims) Scope
+	// Roles returns the roles the token carries in the policy's role claim
+	Roles(claims *TokenClaims) []string
+}
+
+// roleAuthorizer evaluates a RolePolicy with inheritance already resolved
+type roleAuthorizer struct {
+	roleClaim   string
+	permissions map[string]Scope
+}
+
+// NewRoleAuthorizer creates an Authorizer from policy. It returns an error
+// wrapping core.ErrInvalidRolePolicy if a role inherits an unknown role or
+// inheritance forms a cycle.
+func NewRoleAuthorizer(policy *RolePolicy) (Authorizer, error) {
+	if policy == nil {
+		return nil, fmt.Errorf("%w: policy is nil", core.ErrInvalidRolePolicy)
+	}
+
+	authorizer := &roleAuthorizer{
+		roleClaim:   policy.RoleClaim,
+		permissions: make(map[string]Scope, len(policy.Roles)),
+	}
+	if authorizer.roleClaim == "" {
+		authorizer.roleClaim = RolesClaim
+	}
+	for _, name := range slices.Sorted(maps.Keys(policy.Roles)) {
+		if _, err := authorizer.resolve(policy, name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return authorizer, nil
+}
+
+// resolve returns the permissions of role name and the roles it inherits.
+// path holds the roles being resolved, to detect cycles.
+func (ra *roleAuthorizer) resolve(policy *RolePolicy, name string, path []string) (Scope, error) {
+	if permissions, done := ra.permissions[name]; done {
+		return permissions, nil
+	}
+	if slices.Contains(path, name) {
+		return nil, fmt.Errorf("%w: role %s inherits itself", core.ErrInvalidRolePolicy, name)
+	}
+	role, exists := policy.Roles[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: role %s inherits unknown role %s", core.ErrInvalidRolePolicy, path[len(path)-1], name)
+	}
+
+	permissions := NewScope(role.Permissions...)
+	for _, parent := range role.Inherits {
+		inherited, err := ra.resolve(policy, parent, append(path, name))
+		if err != nil {
+			return nil, err
+		}
+		permissions = permissions.Union(inherited)
+	}
+	ra.permissions[name] = permissions
+	return permissions, nil
+}
+
+func (ra *roleAuthorizer) Authorize(claims *TokenClaims, permission string) error {
+	if permission == "" || !ra.Permissions(claims).Covers(permission) {
+		return core.NewAuthError("Authorize", fmt.Errorf("%w: %s", core.ErrPermissionDenied, permission))
+	}
+	return nil
+}
+
+func (ra *roleAuthorizer) Permissions(claims *TokenClaims) Scope {
+	if claims == nil {
+		return nil
+	}
+	var permissions Scope
+	for _, role := range ra.Roles(claims) {
+		permissions = permissions.Union(ra.permissions[role])
+	}
+	return permissions
+}
+
+func (ra *roleAuthorizer) Roles(claims *TokenClaims) []string {
+	if claims == nil {
+		return nil
+	}
+	return NewScope(claimStrings(claims.Claims, ra.roleClaim)...)
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/sushan531/jwk-auth/core"
+)
+
+const testRolePolicy = `{
+  "roles": {
+    "viewer": {"permissions": ["articles:read"]},
+    "editor": {"permissions": ["articles:write"], "inherits": ["viewer"]},
+    "chief":  {"permissions": ["staff:*"], "inherits": ["editor"]},
+    "admin":  {"permissions": ["*"]}
+  }
+}`
+
+// newTestAuthorizer parses and compiles a role policy
+func newTestAuthorizer(t *testing.T, policy string) Authorizer {
+	t.Helper()
+	parsed, err := ParseRolePolicy([]byte(policy))
+	if err != nil {
+		t.Fatalf("ParseRolePolicy: %v", err)
+	}
+	authorizer, err := NewRoleAuthorizer(parsed)
+	if err != nil {
+		t.Fatalf("NewRoleAuthorizer: %v", err)
+	}
+	return authorizer
+}
+
+// claimsWith returns token claims holding claim
+func claimsWith(name string, value any) *TokenClaims {
+	return &TokenClaims{Claims: map[string]any{name: value}}
+}
+
+func TestRoleAuthorizerAuthorize(t *testing.T) {
+	authorizer := newTestAuthorizer(t, testRolePolicy)
+
+	tests := []struct {
+		roles      any
+		permission string
+		want       bool
+	}{
+		{[]any{"viewer"}, "articles:read", true},
+		{[]any{"viewer"}, "articles:write", false},
+		{[]any{"editor"}, "articles:read", true},
+		{[]any{"chief"}, "articles:read", true},
+		{[]any{"chief"}, "staff:hire", true},
+		{"viewer editor", "articles:write", true},
+		{[]any{"admin"}, "anything:at:all", true},
+		{[]any{"unknown"}, "articles:read", false},
+		{nil, "articles:read", false},
+		{[]any{"admin"}, "", false},
+	}
+	for _, tt := range tests {
+		err := authorizer.Authorize(claimsWith(RolesClaim, tt.roles), tt.permission)
+		if tt.want && err != nil {
+			t.Errorf("roles %v, permission %q: %v", tt.roles, tt.permission, err)
+		}
+		if !tt.want && !errors.Is(err, core.ErrPermissionDenied) {
+			t.Errorf("roles %v, permission %q: error = %v, want ErrPermissionDenied", tt.roles, tt.permission, err)
+		}
+	}
+
+	if err := authorizer.Authorize(nil, "articles:read"); !errors.Is(err, core.ErrPermissionDenied) {
+		t.Errorf("Authorize(nil) error = %v, want ErrPermissionDenied", err)
+	}
+}
+
+func TestRoleAuthorizerPermissions(t *testing.T) {
+	authorizer := newTestAuthorizer(t, testRolePolicy)
+	got := authorizer.Permissions(claimsWith(RolesClaim, []any{"chief", "viewer"}))
+	want := Scope{"staff:*", "articles:write", "articles:read"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Permissions = %q, want %q", got, want)
+	}
+}
+
+func TestRoleAuthorizerRoleClaim(t *testing.T) {
+	authorizer := newTestAuthorizer(t, `{
+  "role_claim": "groups",
+  "roles": {"viewer": {"permissions": ["articles:read"]}}
+}`)
+	claims := &TokenClaims{Claims: map[string]any{
+		"groups":   []any{"viewer"},
+		RolesClaim: []any{"admin"},
+	}}
+
+	if got := authorizer.Roles(claims); !slices.Equal(got, []string{"viewer"}) {
+		t.Errorf("Roles = %q, want the groups claim", got)
+	}
+	if err := authorizer.Authorize(claims, "articles:read"); err != nil {
+		t.Errorf("Authorize: %v", err)
+	}
+
+	// The default claim is roles
+	if got := newTestAuthorizer(t, testRolePolicy).Roles(claims); !slices.Equal(got, []string{"admin"}) {
+		t.Errorf("Roles = %q, want the roles claim", got)
+	}
+}
+
+func TestRolePolicyYAMLMatchesJSON(t *testing.T) {
+	fromJSON, err := ParseRolePolicy([]byte(`{
+  "role_claim": "groups",
+  "roles": {
+    "viewer": {"permissions": ["articles:read"]},
+    "editor": {"permissions": ["articles:write"], "inherits": ["viewer"]},
+    "admin":  {"permissions": ["*"]}
+  }
+}`))
+	if err != nil {
+		t.Fatalf("ParseRolePolicy: %v", err)
+	}
+	fromYAML, err := ParseRolePolicyYAML([]byte(`
+role_claim: groups
+roles:
+  viewer:
+    permissions: ["articles:read"]
+  editor:
+    permissions: ["articles:write"]
+    inherits: [viewer]
+  admin:
+    permissions: ["*"]
+`))
+	if err != nil {
+		t.Fatalf("ParseRolePolicyYAML: %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Fatalf("YAML policy = %+v, want the JSON policy %+v", fromYAML, fromJSON)
+	}
+
+	claims := claimsWith("groups", []any{"editor"})
+	for name, policy := range map[string]*RolePolicy{"json": fromJSON, "yaml": fromYAML} {
+		authorizer, err := NewRoleAuthorizer(policy)
+		if err != nil {
+			t.Fatalf("%s NewRoleAuthorizer: %v", name, err)
+		}
+		if got, want := authorizer.Permissions(claims), (Scope{"articles:write", "articles:read"}); !slices.Equal(got, want) {
+			t.Errorf("%s Permissions = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRolePolicyErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{"unknown field", `{"roles": {"viewer": {"permission": ["articles:read"]}}}`},
+		{"not json", `roles: {}`},
+		{"unknown parent", `{"roles": {"editor": {"inherits": ["viewer"]}}}`},
+		{"self cycle", `{"roles": {"editor": {"inherits": ["editor"]}}}`},
+		{"cycle", `{"roles": {"a": {"inherits": ["b"]}, "b": {"inherits": ["c"]}, "c": {"inherits": ["a"]}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParseRolePolicy([]byte(tt.policy))
+			if err == nil {
+				_, err = NewRoleAuthorizer(policy)
+			}
+			if !errors.Is(err, core.ErrInvalidRolePolicy) {
+				t.Errorf("error = %v, want ErrInvalidRolePolicy", err)
+			}
+		})
+	}
+
+	yamlPolicies := map[string]string{
+		"unknown field": "roles:\n  viewer:\n    permission: [\"articles:read\"]\n",
+		"empty":         "",
+		"not a policy":  "- viewer\n",
+	}
+	for name, policy := range yamlPolicies {
+		if _, err := ParseRolePolicyYAML([]byte(policy)); !errors.Is(err, core.ErrInvalidRolePolicy) {
+			t.Errorf("ParseRolePolicyYAML %s error = %v, want ErrInvalidRolePolicy", name, err)
+		}
+	}
+
+	if _, err := NewRoleAuthorizer(nil); !errors.Is(err, core.ErrInvalidRolePolicy) {
+		t.Errorf("NewRoleAuthorizer(nil) error = %v, want ErrInvalidRolePolicy", err)
+	}
+}
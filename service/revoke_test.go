@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+func TestRevokeTokenChecksOwner(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     map[string]any
+		clientID   string
+		wantErr    error
+		wantActive bool
+	}{
+		{"own token", map[string]any{"sub": "alice", "client_id": "partner"}, "partner", nil, false},
+		{"another client's token", map[string]any{"sub": "alice", "client_id": "partner"}, "intruder", core.ErrTokenNotOwned, true},
+		{"token without owner", map[string]any{"sub": "alice"}, "partner", core.ErrTokenNotOwned, true},
+		{"no client check", map[string]any{"sub": "alice", "client_id": "partner"}, "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenService := newOpaqueTokenService(t, authtest.NewFakeClock(testStart), NewMemoryTokenStore())
+			token, err := tokenService.CreateAccessToken(tt.claims, "partner")
+			if err != nil {
+				t.Fatalf("CreateAccessToken: %v", err)
+			}
+
+			if err := tokenService.RevokeToken(token, "access_token", tt.clientID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RevokeToken error = %v, want %v", err, tt.wantErr)
+			}
+			_, err = tokenService.ValidateAccessToken(token)
+			if active := err == nil; active != tt.wantActive {
+				t.Errorf("token active after revocation = %v (%v), want %v", active, err, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestRevokeTokenIgnoresInvalidTokens(t *testing.T) {
+	tokenService := newOpaqueTokenService(t, authtest.NewFakeClock(testStart), NewMemoryTokenStore())
+	for _, token := range []string{"unknown", "a.b.c"} {
+		if err := tokenService.RevokeToken(token, "", "partner"); err != nil {
+			t.Errorf("RevokeToken(%q) error = %v, want nil", token, err)
+		}
+	}
+}
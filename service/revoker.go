@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Revoker records revoked tokens by their token ID (jti) and revoked token
+// families. A family is a refresh token and the access tokens derived from it.
+type Revoker interface {
+	// Revoke marks tokenID as revoked; the record can be dropped after expiresAt
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+	// RevokeFamily marks every token of familyID as revoked; the record can
+	// be dropped after expiresAt
+	RevokeFamily(ctx context.Context, familyID string, expiresAt time.Time) error
+	IsFamilyRevoked(ctx context.Context, familyID string) (bool, error)
+}
+
+// memoryRevoker keeps revoked token IDs in memory until the tokens expire
+type memoryRevoker struct {
+	mutex    sync.RWMutex
+	revoked  map[string]time.Time
+	families map[string]time.Time
+}
+
+// NewMemoryRevoker creates an in-process Revoker
+func NewMemoryRevoker() Revoker {
+	return &memoryRevoker{
+		revoked:  make(map[string]time.Time),
+		families: make(map[string]time.Time),
+	}
+}
+
+func (r *memoryRevoker) Revoke(_ context.Context, tokenID string, expiresAt time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (r *memoryRevoker) IsRevoked(_ context.Context, tokenID string) (bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	_, revoked := r.revoked[tokenID]
+	return revoked, nil
+}
+
+func (r *memoryRevoker) RevokeFamily(_ context.Context, familyID string, expiresAt time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.families[familyID] = expiresAt
+	return nil
+}
+
+func (r *memoryRevoker) IsFamilyRevoked(_ context.Context, familyID string) (bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	_, revoked := r.families[familyID]
+	return revoked, nil
+}
+
+// PurgeExpired drops records of tokens that have expired by now
+func (r *memoryRevoker) PurgeExpired(now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, records := range []map[string]time.Time{r.revoked, r.families} {
+		for id, expiresAt := range records {
+			if !expiresAt.IsZero() && expiresAt.Before(now) {
+				delete(records, id)
+			}
+		}
+	}
+}
+
+// expiredPurger is implemented by revokers that can drop expired records
+type expiredPurger interface {
+	PurgeExpired(now time.Time)
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"slices"
+	"strings"
+)
+
+// ScopeClaim holds the space-delimited scopes granted to a token (RFC 8693)
+const ScopeClaim = "scope"
+
+// ScopeWildcard matches any one segment of a scope, or any remaining
+// segments at the end of a scope
+const ScopeWildcard = "*"
+
+// scopeSeparator separates the segments of a hierarchical scope such as data:read
+const scopeSeparator = ":"
+
+// Scope is a set of OAuth scopes. Scopes are hierarchical, with segments
+// separated by ':'. A granted scope ending in "*" covers every scope below
+// it, so data:* covers data:read and data:read:own, and a "*" segment
+// elsewhere matches any single segment, so *:read covers data:read. The
+// scope "*" covers everything.
+type Scope []string
+
+// ParseScope parses a space-delimited scope string, dropping duplicates
+// and keeping the order of first appearance
+func ParseScope(scope string) Scope {
+	return NewScope(strings.Fields(scope)...)
+}
+
+// NewScope creates a scope from individual scope values, dropping empty
+// values and duplicates
+func NewScope(scopes ...string) Scope {
+	var result Scope
+	for _, scope := range scopes {
+		if scope != "" && !slices.Contains(result, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+// String returns the scope in its space-delimited form
+func (s Scope) String() string {
+	return strings.Join(s, " ")
+}
+
+// Covers reports whether any scope of s covers required
+func (s Scope) Covers(required string) bool {
+	return slices.ContainsFunc(s, func(granted string) bool {
+		return scopeCovers(granted, required)
+	})
+}
+
+// ContainsAll reports whether s covers every scope of required. This is the
+// check for narrowing a token's scope: a scope may only be requested if the
+// original grant covers all of it.
+func (s Scope) ContainsAll(required Scope) bool {
+	for _, scope := range required {
+		if !s.Covers(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsAny reports whether s covers at least one scope of required
+func (s Scope) ContainsAny(required Scope) bool {
+	return slices.ContainsFunc(required, s.Covers)
+}
+
+// Union returns the scopes in either s or other
+func (s Scope) Union(other Scope) Scope {
+	return NewScope(append(slices.Clone(s), other...)...)
+}
+
+// Intersect returns the scopes allowed by both s and other: each scope of
+// either set that the other covers. Granted data:* intersected with allowed
+// data:read and files:read is data:read.
+func (s Scope) Intersect(other Scope) Scope {
+	var result Scope
+	for _, scope := range s {
+		if other.Covers(scope) {
+			result = append(result, scope)
+		}
+	}
+	for _, scope := range other {
+		if s.Covers(scope) {
+			result = append(result, scope)
+		}
+	}
+	return NewScope(result...)
+}
+
+// Difference returns the scopes of s not covered by other
+func (s Scope) Difference(other Scope) Scope {
+	var result Scope
+	for _, scope := range s {
+		if !other.Covers(scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+// scopeCovers reports whether the granted scope covers required
+func scopeCovers(granted string, required string) bool {
+	if granted == required || granted == ScopeWildcard {
+		return true
+	}
+
+	grantedSegments := strings.Split(granted, scopeSeparator)
+	requiredSegments := strings.Split(required, scopeSeparator)
+	for i, segment := range grantedSegments {
+		if i == len(requiredSegments) {
+			return false
+		}
+		if segment == ScopeWildcard && i == len(grantedSegments)-1 {
+			return true
+		}
+		if segment != ScopeWildcard && segment != requiredSegments[i] {
+			return false
+		}
+	}
+	return len(grantedSegments) == len(requiredSegments)
+}
+
+// Scope returns the scopes granted to the token. The scope claim is read as
+// a space-delimited string or as a list of strings.
+func (tc *TokenClaims) Scope() Scope {
+	return NewScope(claimStrings(tc.Claims, ScopeClaim)...)
+}
+
+// claimStrings reads a claim holding a space-delimited string or a list of strings
+func claimStrings(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return strings.Fields(value)
+	case []string:
+		return value
+	case []any:
+		var values []string
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// HasScope reports whether the token was granted scope, directly or through
+// a wildcard
+func (tc *TokenClaims) HasScope(scope string) bool {
+	return tc.Scope().Covers(scope)
+}
+
+// HasAllScopes reports whether the token was granted every one of scopes
+func (tc *TokenClaims) HasAllScopes(scopes ...string) bool {
+	return tc.Scope().ContainsAll(NewScope(scopes...))
+}
+
+// HasAnyScope reports whether the token was granted at least one of scopes
+func (tc *TokenClaims) HasAnyScope(scopes ...string) bool {
+	return tc.Scope().ContainsAny(NewScope(scopes...))
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  Scope
+	}{
+		{"", nil},
+		{"  ", nil},
+		{"read", Scope{"read"}},
+		{"read  write\tread", Scope{"read", "write"}},
+		{"data:read data:*", Scope{"data:read", "data:*"}},
+	}
+	for _, tt := range tests {
+		if got := ParseScope(tt.scope); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseScope(%q) = %q, want %q", tt.scope, got, tt.want)
+		}
+	}
+
+	if got := NewScope("read", "", "write", "read").String(); got != "read write" {
+		t.Errorf("String() = %q, want %q", got, "read write")
+	}
+}
+
+func TestScopeCovers(t *testing.T) {
+	tests := []struct {
+		granted  string
+		required string
+		want     bool
+	}{
+		{"read", "read", true},
+		{"read", "write", false},
+		{"*", "data:read:own", true},
+		{"data:*", "data:read", true},
+		{"data:*", "data:read:own", true},
+		{"data:*", "data", false},
+		{"data:*", "files:read", false},
+		{"*:read", "data:read", true},
+		{"*:read", "data:write", false},
+		{"*:read", "data:read:own", false},
+		{"data:*:own", "data:read:own", true},
+		{"data:*:own", "data:read:all", false},
+		{"data:read", "data:read:own", false},
+		{"data:read:own", "data:read", false},
+		{"data", "data:read", false},
+	}
+	for _, tt := range tests {
+		if got := ParseScope(tt.granted).Covers(tt.required); got != tt.want {
+			t.Errorf("%q covers %q = %v, want %v", tt.granted, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestScopeSetOperations(t *testing.T) {
+	granted := ParseScope("data:* profile")
+
+	if !granted.ContainsAll(ParseScope("data:read data:write profile")) {
+		t.Error("ContainsAll = false, want true")
+	}
+	if granted.ContainsAll(ParseScope("data:read email")) {
+		t.Error("ContainsAll with an uncovered scope = true, want false")
+	}
+	if !granted.ContainsAll(nil) {
+		t.Error("ContainsAll(nil) = false, want true")
+	}
+	if !granted.ContainsAny(ParseScope("email data:read")) {
+		t.Error("ContainsAny = false, want true")
+	}
+	if granted.ContainsAny(ParseScope("email files:read")) || granted.ContainsAny(nil) {
+		t.Error("ContainsAny without a covered scope = true, want false")
+	}
+
+	tests := []struct {
+		name string
+		got  Scope
+		want Scope
+	}{
+		{"union", ParseScope("read write").Union(ParseScope("write admin")), Scope{"read", "write", "admin"}},
+		{"intersect", granted.Intersect(ParseScope("data:read files:read profile")), Scope{"profile", "data:read"}},
+		{"intersect wildcards", ParseScope("data:read").Intersect(ParseScope("*")), Scope{"data:read"}},
+		{"intersect disjoint", ParseScope("read").Intersect(ParseScope("write")), nil},
+		{"difference", ParseScope("data:read email profile").Difference(granted), Scope{"email"}},
+		{"difference covered", ParseScope("data:read").Difference(granted), nil},
+	}
+	for _, tt := range tests {
+		if !slices.Equal(tt.got, tt.want) {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestTokenClaimsScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim any
+		want  Scope
+	}{
+		{"string", "data:* profile", Scope{"data:*", "profile"}},
+		{"list", []any{"data:*", "profile", 42}, Scope{"data:*", "profile"}},
+		{"string list", []string{"data:*", "profile"}, Scope{"data:*", "profile"}},
+		{"missing", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &TokenClaims{Claims: map[string]any{}}
+			if tt.claim != nil {
+				claims.Claims[ScopeClaim] = tt.claim
+			}
+			if got := claims.Scope(); !slices.Equal(got, tt.want) {
+				t.Fatalf("Scope() = %q, want %q", got, tt.want)
+			}
+			if len(tt.want) == 0 {
+				if claims.HasScope("profile") || claims.HasAnyScope("profile") {
+					t.Error("token without scopes has profile")
+				}
+				return
+			}
+			if !claims.HasScope("data:read") || claims.HasScope("files:read") {
+				t.Error("HasScope does not follow data:*")
+			}
+			if !claims.HasAllScopes("data:read", "profile") || claims.HasAllScopes("data:read", "email") {
+				t.Error("HasAllScopes is wrong")
+			}
+			if !claims.HasAnyScope("email", "profile") || claims.HasAnyScope("email", "files:read") {
+				t.Error("HasAnyScope is wrong")
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+)
+
+// DefaultTokenCacheTTL is how long a verified token is cached at most when
+// no TTL is configured
+const DefaultTokenCacheTTL = 5 * time.Minute
+
+// TokenCache remembers tokens whose signature has been verified, keyed by a
+// SHA-256 hash of the token, so repeated validations of the same token skip
+// parsing and signature verification. Entries are kept until the earlier of
+// the token's exp and the cache TTL, and the least recently used entry is
+// dropped when the cache is full.
+//
+// A cached result is only used while its kid still resolves to the key the
+// token was verified with, so rotated, replaced or compromised keys
+// invalidate it. Purpose and revocation are checked on every validation,
+// and revoking a token also evicts it.
+type TokenCache struct {
+	maxEntries int
+	ttl        time.Duration
+
+	mutex   sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List
+}
+
+// tokenCacheEntry is a verified token held by a TokenCache
+type tokenCacheEntry struct {
+	hash      [sha256.Size]byte
+	verified  *verifiedToken
+	publicKey crypto.PublicKey
+	expiresAt time.Time
+}
+
+// NewTokenCache creates a cache holding at most maxEntries verified tokens
+// for at most ttl each. A ttl of 0 means DefaultTokenCacheTTL.
+func NewTokenCache(maxEntries int, ttl time.Duration) *TokenCache {
+	if ttl <= 0 {
+		ttl = DefaultTokenCacheTTL
+	}
+	return &TokenCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// WithTokenCache caches verified tokens in cache. Services sharing a key
+// registry can share one cache.
+func WithTokenCache(cache *TokenCache) AuthOption {
+	return func(a *auth) {
+		a.tokenCache = cache
+	}
+}
+
+// Len returns the number of cached tokens
+func (c *TokenCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// Purge drops every cached token
+func (c *TokenCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	clear(c.entries)
+	c.order.Init()
+}
+
+// get returns the entry for hash, dropping it if it has expired by now
+func (c *TokenCache) get(hash [sha256.Size]byte, now time.Time) (*tokenCacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, exists := c.entries[hash]
+	if !exists {
+		return nil, false
+	}
+	entry := element.Value.(*tokenCacheEntry)
+	if !now.Before(entry.expiresAt) {
+		c.removeLocked(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry, true
+}
+
+// put caches a verified token until the earlier of its exp and now plus the TTL
+func (c *TokenCache) put(hash [sha256.Size]byte, verified *verifiedToken, publicKey crypto.PublicKey, now time.Time) {
+	if c.maxEntries <= 0 || publicKey == nil {
+		return
+	}
+	expiresAt := now.Add(c.ttl)
+	if exp, ok := verified.claims["exp"].(float64); ok {
+		expiresAt = minTime(expiresAt, time.Unix(int64(exp), 0))
+	}
+	if !now.Before(expiresAt) {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, exists := c.entries[hash]; exists {
+		c.removeLocked(element)
+	}
+	entry := &tokenCacheEntry{hash: hash, verified: verified, publicKey: publicKey, expiresAt: expiresAt}
+	c.entries[hash] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		c.removeLocked(c.order.Back())
+	}
+}
+
+// remove drops the entry for hash
+func (c *TokenCache) remove(hash [sha256.Size]byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, exists := c.entries[hash]; exists {
+		c.removeLocked(element)
+	}
+}
+
+// evictRevoked drops the entries of a revoked token or token family
+func (c *TokenCache) evictRevoked(tokenID string, familyID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		claims := element.Value.(*tokenCacheEntry).verified.claims
+		if jti, _ := claims["jti"].(string); tokenID != "" && jti == tokenID {
+			c.removeLocked(element)
+		} else if family, _ := claims[TokenFamilyClaim].(string); familyID != "" && family == familyID {
+			c.removeLocked(element)
+		}
+		element = next
+	}
+}
+
+// OnTokenEvent evicts the tokens signed by a compromised key. Subscribe the
+// cache to a TokenEventPublisher to drop them as soon as the key is marked.
+func (c *TokenCache) OnTokenEvent(event TokenEvent) {
+	if event.Type != EventKeyCompromised {
+		return
+	}
+	kid, _ := event.Metadata["key_id"].(string)
+	if kid == "" {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*tokenCacheEntry).verified.keyID == kid {
+			c.removeLocked(element)
+		}
+		element = next
+	}
+}
+
+func (c *TokenCache) removeLocked(element *list.Element) {
+	delete(c.entries, element.Value.(*tokenCacheEntry).hash)
+	c.order.Remove(element)
+}
+
+// verifyCached is verifyTokenWith backed by the token cache
+func (a *auth) verifyCached(ctx context.Context, token string, lookup keyLookup) (*verifiedToken, error) {
+	hash := sha256.Sum256([]byte(token))
+	if entry, hit := a.tokenCache.get(hash, a.config.Now()); hit {
+		if a.stillValid(ctx, entry, lookup) {
+			return &verifiedToken{claims: maps.Clone(entry.verified.claims), keyID: entry.verified.keyID}, nil
+		}
+		a.tokenCache.remove(hash)
+	}
+
+	// Record the key the token is verified with, since the kid may be
+	// rotated to a new key while verification runs
+	var usedKey crypto.PublicKey
+	recording := func(ctx context.Context, kid string) (crypto.PublicKey, jwa.SignatureAlgorithm, error) {
+		publicKey, alg, err := lookup(ctx, kid)
+		usedKey = publicKey
+		return publicKey, alg, err
+	}
+	verified, err := a.verifySignedToken(ctx, token, recording)
+	if err != nil {
+		return nil, err
+	}
+	a.tokenCache.put(hash, &verifiedToken{claims: maps.Clone(verified.claims), keyID: verified.keyID}, usedKey, a.config.Now())
+	return verified, nil
+}
+
+// stillValid reports whether a cached token's kid still resolves to the key
+// it was verified with and that key has not been compromised since
+func (a *auth) stillValid(ctx context.Context, entry *tokenCacheEntry, lookup keyLookup) bool {
+	kid := entry.verified.keyID
+	publicKey, _, err := lookup(ctx, kid)
+	if err != nil {
+		return false
+	}
+	equal, ok := publicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !equal.Equal(entry.publicKey) {
+		return false
+	}
+
+	var issuedAt time.Time
+	if iat, ok := entry.verified.claims["iat"].(float64); ok {
+		issuedAt = time.Unix(int64(iat), 0)
+	}
+	return a.jwkManager.CheckKeyCompromiseContext(ctx, kid, issuedAt) == nil
+}
+
+// minTime returns the earlier of a and b
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// evictRevoked drops a revoked token or token family from the token cache
+func (a *auth) evictRevoked(tokenID string, familyID string) {
+	if a.tokenCache != nil {
+		a.tokenCache.evictRevoked(tokenID, familyID)
+	}
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// newCachedAuth returns an auth service caching verified tokens in cache
+func newCachedAuth(t *testing.T, clock *authtest.FakeClock, cache *TokenCache) (*auth, core.JwkManager) {
+	t.Helper()
+	return newTestAuth(t, testConfig(clock), WithTokenCache(cache))
+}
+
+// cachedEntry returns the cache entry for token, if any
+func cachedEntry(cache *TokenCache, token string, now time.Time) (*tokenCacheEntry, bool) {
+	return cache.get(sha256.Sum256([]byte(token)), now)
+}
+
+// waitForCacheLen polls until the cache holds want tokens, as events are
+// delivered asynchronously
+func waitForCacheLen(t *testing.T, cache *TokenCache, want int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for cache.Len() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("cache holds %d tokens, want %d", cache.Len(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// issue returns an access token for sub that leaves the key in place
+func issue(t *testing.T, a Auth, sub string, keyPrefix string, expiry time.Duration) string {
+	t.Helper()
+	token, err := a.GenerateToken(map[string]any{"sub": sub}, keyPrefix, expiry, "access", WithoutKeyRotation())
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return token
+}
+
+func TestTokenCacheServesRepeatedValidations(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	cache := NewTokenCache(10, time.Minute)
+	a, _ := newCachedAuth(t, clock, cache)
+	token := issue(t, a, "alice", "web", time.Hour)
+
+	if _, err := a.ValidateToken(token, "access"); err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	entry, hit := cachedEntry(cache, token, clock.Now())
+	if !hit {
+		t.Fatal("verified token was not cached")
+	}
+
+	// A hit returns the cached claims without verifying the token again
+	entry.verified.claims["cached"] = true
+	claims, err := a.ValidateToken(token, "access")
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.Claims["cached"] != true {
+		t.Fatal("second validation did not use the cache")
+	}
+
+	// Callers get a copy of the cached claims
+	claims.Claims["sub"] = "mallory"
+	if entry.verified.claims["sub"] != "alice" {
+		t.Errorf("cached sub = %v, want alice", entry.verified.claims["sub"])
+	}
+
+	// Purpose is checked on every validation
+	if _, err := a.ValidateToken(token, "refresh"); !errors.Is(err, core.ErrInvalidTokenPurpose) {
+		t.Errorf("ValidateToken(refresh) error = %v, want ErrInvalidTokenPurpose", err)
+	}
+}
+
+func TestTokenCacheExpiry(t *testing.T) {
+	t.Run("ttl", func(t *testing.T) {
+		clock := authtest.NewFakeClock(testStart)
+		cache := NewTokenCache(10, time.Minute)
+		a, _ := newCachedAuth(t, clock, cache)
+		token := issue(t, a, "alice", "web", time.Hour)
+		if _, err := a.ValidateToken(token, "access"); err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+
+		clock.Advance(time.Minute)
+		if _, hit := cachedEntry(cache, token, clock.Now()); hit {
+			t.Error("token is still cached after the TTL")
+		}
+		if cache.Len() != 0 {
+			t.Errorf("cache holds %d tokens, want 0", cache.Len())
+		}
+		// The token itself is still valid and is cached again
+		if _, err := a.ValidateToken(token, "access"); err != nil {
+			t.Fatalf("ValidateToken after TTL: %v", err)
+		}
+		if cache.Len() != 1 {
+			t.Errorf("cache holds %d tokens, want 1", cache.Len())
+		}
+	})
+
+	t.Run("token exp", func(t *testing.T) {
+		clock := authtest.NewFakeClock(testStart)
+		cache := NewTokenCache(10, time.Hour)
+		a, _ := newCachedAuth(t, clock, cache)
+		token := issue(t, a, "alice", "web", 30*time.Second)
+		if _, err := a.ValidateToken(token, "access"); err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+
+		clock.Advance(30 * time.Second)
+		if _, err := a.ValidateToken(token, "access"); !errors.Is(err, core.ErrTokenExpired) {
+			t.Errorf("ValidateToken after exp error = %v, want ErrTokenExpired", err)
+		}
+	})
+
+	t.Run("default ttl", func(t *testing.T) {
+		if cache := NewTokenCache(10, 0); cache.ttl != DefaultTokenCacheTTL {
+			t.Errorf("ttl = %v, want %v", cache.ttl, DefaultTokenCacheTTL)
+		}
+	})
+}
+
+func TestTokenCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	cache := NewTokenCache(2, time.Minute)
+	a, _ := newCachedAuth(t, clock, cache)
+	first := issue(t, a, "first", "web", time.Hour)
+	second := issue(t, a, "second", "web", time.Hour)
+	third := issue(t, a, "third", "web", time.Hour)
+
+	for _, token := range []string{first, second, first, third} {
+		if _, err := a.ValidateToken(token, "access"); err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("cache holds %d tokens, want 2", cache.Len())
+	}
+	for token, want := range map[string]bool{first: true, second: false, third: true} {
+		if _, hit := cachedEntry(cache, token, clock.Now()); hit != want {
+			t.Errorf("%s cached = %v, want %v", token[len(token)-8:], hit, want)
+		}
+	}
+
+	cache.Purge()
+	if cache.Len() != 0 {
+		t.Errorf("cache holds %d tokens after Purge, want 0", cache.Len())
+	}
+}
+
+func TestTokenCacheWithoutEntriesCachesNothing(t *testing.T) {
+	cache := NewTokenCache(0, time.Minute)
+	a, _ := newCachedAuth(t, authtest.NewFakeClock(testStart), cache)
+	if _, err := a.ValidateToken(issue(t, a, "alice", "web", time.Hour), "access"); err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("cache holds %d tokens, want 0", cache.Len())
+	}
+}
+
+func TestTokenCacheRevocation(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	cache := NewTokenCache(10, time.Minute)
+	a, _ := newCachedAuth(t, clock, cache)
+
+	access, refresh, err := a.GenerateAccessRefreshTokenPair(map[string]any{"sub": "alice"}, map[string]any{"sub": "alice"}, "web")
+	if err != nil {
+		t.Fatalf("GenerateAccessRefreshTokenPair: %v", err)
+	}
+	other := issue(t, a, "bob", "web", time.Hour)
+	for token, purpose := range map[string]string{access: "access", refresh: "refresh", other: "access"} {
+		if _, err := a.ValidateToken(token, purpose); err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+	}
+
+	// Revoking the refresh token revokes its family, the access token included
+	if err := a.RevokeToken(refresh); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("cache holds %d tokens after revocation, want 1", cache.Len())
+	}
+	if _, err := a.ValidateToken(access, "access"); !errors.Is(err, core.ErrTokenRevoked) {
+		t.Errorf("ValidateToken(access) error = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := a.ValidateToken(other, "access"); err != nil {
+		t.Errorf("ValidateToken(other): %v", err)
+	}
+}
+
+func TestTokenCacheDropsTokensOfRotatedKey(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	cache := NewTokenCache(10, time.Minute)
+	a, jwkManager := newCachedAuth(t, clock, cache)
+	token := issue(t, a, "alice", "web", time.Hour)
+	if _, err := a.ValidateToken(token, "access"); err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+
+	// The kid stays key-web but now resolves to a different key
+	if err := jwkManager.AddOrReplaceKeyToSet("web"); err != nil {
+		t.Fatalf("AddOrReplaceKeyToSet: %v", err)
+	}
+	if _, err := a.ValidateToken(token, "access"); !errors.Is(err, core.ErrInvalidSignature) {
+		t.Errorf("ValidateToken after rotation error = %v, want ErrInvalidSignature", err)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("cache holds %d tokens, want 0", cache.Len())
+	}
+}
+
+func TestTokenCacheDropsTokensOfCompromisedKey(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	factory := NewServiceFactory(testConfig(clock), WithVerifiedTokenCache(10, time.Minute))
+	a, _, keyService := factory.CreateAllServices()
+
+	web := issue(t, a, "alice", "web", time.Hour)
+	mobile := issue(t, a, "bob", "mobile", time.Hour)
+	for _, token := range []string{web, mobile} {
+		if _, err := a.ValidateToken(token, "access"); err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+	}
+	if factory.tokenCache.Len() != 2 {
+		t.Fatalf("cache holds %d tokens, want 2", factory.tokenCache.Len())
+	}
+
+	// The published event evicts the tokens of the compromised key only
+	clock.Advance(time.Second)
+	if err := keyService.MarkCompromised("web", "leaked", clock.Now()); err != nil {
+		t.Fatalf("MarkCompromised: %v", err)
+	}
+	waitForCacheLen(t, factory.tokenCache, 1)
+	if _, err := a.ValidateToken(web, "access"); !errors.Is(err, core.ErrKeyCompromised) {
+		t.Errorf("ValidateToken(web) error = %v, want ErrKeyCompromised", err)
+	}
+	if _, err := a.ValidateToken(mobile, "access"); err != nil {
+		t.Errorf("ValidateToken(mobile): %v", err)
+	}
+}
+
+func TestTokenCacheChecksCompromiseWithoutEvent(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	cache := NewTokenCache(10, time.Minute)
+	a, jwkManager := newCachedAuth(t, clock, cache)
+	token := issue(t, a, "alice", "web", time.Hour)
+	if _, err := a.ValidateToken(token, "access"); err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if _, err := jwkManager.MarkKeyCompromised("web", "leaked", clock.Now()); err != nil {
+		t.Fatalf("MarkKeyCompromised: %v", err)
+	}
+	if _, err := a.ValidateToken(token, "access"); !errors.Is(err, core.ErrKeyCompromised) {
+		t.Errorf("ValidateToken error = %v, want ErrKeyCompromised", err)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// GrantTypeTokenExchange is the RFC 8693 token exchange grant
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// TokenTypeAccessToken identifies access tokens in token exchange requests
+const TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+// TokenExchangeRequest asks for a downstream token on behalf of the subject
+// of SubjectToken
+type TokenExchangeRequest struct {
+	// SubjectToken is the access token being exchanged
+	SubjectToken string
+	// ActorID identifies the calling service; it is recorded in the act claim
+	ActorID string
+	// Audience is the service the new token is meant for
+	Audience string
+	// Scope optionally narrows the new token further; space separated
+	Scope string
+}
+
+// ExchangedToken is the result of a token exchange
+type ExchangedToken struct {
+	Token     string
+	Scope     string
+	ExpiresAt time.Time
+}
+
+// ExchangePolicy decides which scopes a token exchanged for audience may
+// carry. It returns core.ErrAudienceNotAllowed if actorID may not obtain
+// tokens for audience.
+type ExchangePolicy interface {
+	AllowedScopes(ctx context.Context, audience string, actorID string) ([]string, error)
+}
+
+// audienceScopePolicy allows a fixed set of scopes per audience
+type audienceScopePolicy map[string][]string
+
+// NewAudienceScopePolicy creates an ExchangePolicy from the scopes allowed
+// for each audience. Audiences not in the map are refused.
+func NewAudienceScopePolicy(scopes map[string][]string) ExchangePolicy {
+	policy := make(audienceScopePolicy, len(scopes))
+	for audience, allowed := range scopes {
+		policy[audience] = slices.Clone(allowed)
+	}
+	return policy
+}
+
+func (p audienceScopePolicy) AllowedScopes(ctx context.Context, audience string, actorID string) ([]string, error) {
+	allowed, exists := p[audience]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", core.ErrAudienceNotAllowed, audience)
+	}
+	return allowed, nil
+}
+
+// ExchangeToken swaps a validated access token for a token meant for
+// another audience. The new token keeps the subject, carries only scopes
+// held by the subject token and allowed for the audience, records the actor
+// in an act claim and expires no later than the subject token. It is signed
+// with the current key for keyPrefix, without rotating it, so earlier
+// exchanged tokens stay valid.
+func (ts *tokenService) ExchangeToken(request *TokenExchangeRequest, keyPrefix string) (*ExchangedToken, error) {
+	return ts.ExchangeTokenContext(context.Background(), request, keyPrefix)
+}
+
+func (ts *tokenService) ExchangeTokenContext(ctx context.Context, request *TokenExchangeRequest, keyPrefix string) (*ExchangedToken, error) {
+	const op = "ExchangeToken"
+
+	if ts.exchangePolicy == nil {
+		return nil, core.NewAuthError(op, fmt.Errorf("%w: token exchange is not configured", core.ErrAudienceNotAllowed))
+	}
+	if request == nil || request.ActorID == "" || request.Audience == "" {
+		return nil, core.NewAuthError(op, fmt.Errorf("%w: actor and audience are required", core.ErrInvalidClaim))
+	}
+
+	subject, err := ts.ValidateAccessTokenContext(ctx, request.SubjectToken)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := ts.exchangePolicy.AllowedScopes(ctx, request.Audience, request.ActorID)
+	if err != nil {
+		return nil, core.NewAuthError(op, err)
+	}
+
+	// The new token never holds more than the subject token and the audience allow
+	granted := subject.Scope().Intersect(NewScope(allowed...))
+	if request.Scope != "" {
+		requested := ParseScope(request.Scope)
+		if missing := requested.Difference(granted); len(missing) > 0 {
+			return nil, core.NewAuthError(op, fmt.Errorf("%w: %s", core.ErrScopeNotAllowed, missing))
+		}
+		granted = requested
+	}
+	if len(granted) == 0 {
+		return nil, core.NewAuthError(op, fmt.Errorf("%w: no scope of the subject token is allowed for %s", core.ErrScopeNotAllowed, request.Audience))
+	}
+	scope := granted.String()
+
+	// Chain the actor onto any earlier delegation
+	actor := map[string]any{"sub": request.ActorID}
+	if previous, exists := subject.Claims["act"]; exists {
+		actor["act"] = previous
+	}
+
+	claims := map[string]any{
+		"aud":       request.Audience,
+		"scope":     scope,
+		"act":       actor,
+		"client_id": request.ActorID,
+	}
+	if sub, exists := subject.Claims["sub"]; exists {
+		claims["sub"] = sub
+	}
+
+	expiry := ts.config.TokenExpiry
+	if remaining := subject.ExpiresAt.Sub(ts.config.Now()); !subject.ExpiresAt.IsZero() && remaining < expiry {
+		expiry = remaining.Truncate(time.Second)
+	}
+	if expiry <= 0 {
+		return nil, core.NewAuthError(op, core.ErrTokenExpired)
+	}
+
+	token, err := ts.issueAccessToken(ctx, claims, keyPrefix, expiry, WithoutKeyRotation())
+	if err != nil {
+		return nil, err
+	}
+	return &ExchangedToken{
+		Token:     token,
+		Scope:     scope,
+		ExpiresAt: ts.config.Now().Add(expiry),
+	}, nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+func newExchangeTokenService(t *testing.T) TokenService {
+	t.Helper()
+	config := testConfig(authtest.NewFakeClock(testStart))
+	return NewServiceFactory(config, WithTokenExchange(NewAudienceScopePolicy(map[string][]string{
+		"billing": {"billing:read", "profile"},
+		"orders":  {"orders:write"},
+	}))).CreateTokenService()
+}
+
+func TestExchangeTokenKeepsEarlierTokensValid(t *testing.T) {
+	tokenService := newExchangeTokenService(t)
+	subject, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice", "scope": "profile billing:read orders:write"}, "gateway")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+
+	// The subject token and the exchanged tokens share the gateway's key
+	var exchanged []string
+	for _, audience := range []string{"billing", "orders"} {
+		result, err := tokenService.ExchangeToken(&TokenExchangeRequest{SubjectToken: subject, ActorID: "gateway", Audience: audience}, "gateway")
+		if err != nil {
+			t.Fatalf("ExchangeToken(%s): %v", audience, err)
+		}
+		exchanged = append(exchanged, result.Token)
+	}
+
+	for i, token := range append(exchanged, subject) {
+		if _, err := tokenService.ValidateAccessToken(token); err != nil {
+			t.Errorf("token %d: %v", i, err)
+		}
+	}
+}
+
+func TestExchangeTokenClaims(t *testing.T) {
+	tokenService := newExchangeTokenService(t)
+	subject, err := tokenService.CreateAccessToken(map[string]any{
+		"sub":   "alice",
+		"scope": "profile billing:read orders:write",
+		"act":   map[string]any{"sub": "mobile-app"},
+	}, "user")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+
+	result, err := tokenService.ExchangeToken(&TokenExchangeRequest{SubjectToken: subject, ActorID: "gateway", Audience: "billing"}, "gateway")
+	if err != nil {
+		t.Fatalf("ExchangeToken: %v", err)
+	}
+	claims, err := tokenService.ValidateAccessToken(result.Token)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	granted := ParseScope(result.Scope)
+	if len(granted) != 2 || !granted.ContainsAll(NewScope("billing:read", "profile")) ||
+		claims.Claims["sub"] != "alice" || !audienceContains(claims.Claims["aud"], "billing") {
+		t.Errorf("exchanged scope %q, claims %v", result.Scope, claims.Claims)
+	}
+	act, _ := claims.Claims["act"].(map[string]any)
+	previous, _ := act["act"].(map[string]any)
+	if act["sub"] != "gateway" || previous["sub"] != "mobile-app" {
+		t.Errorf("act claim = %v, want gateway acting for mobile-app", claims.Claims["act"])
+	}
+}
+
+func TestExchangeTokenRejections(t *testing.T) {
+	tokenService := newExchangeTokenService(t)
+	subject, err := tokenService.CreateAccessToken(map[string]any{"sub": "alice", "scope": "profile"}, "user")
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		request *TokenExchangeRequest
+		wantErr error
+	}{
+		{"unknown audience", &TokenExchangeRequest{SubjectToken: subject, ActorID: "gateway", Audience: "admin"}, core.ErrAudienceNotAllowed},
+		{"no shared scope", &TokenExchangeRequest{SubjectToken: subject, ActorID: "gateway", Audience: "orders"}, core.ErrScopeNotAllowed},
+		{"widened scope", &TokenExchangeRequest{SubjectToken: subject, ActorID: "gateway", Audience: "billing", Scope: "billing:read"}, core.ErrScopeNotAllowed},
+		{"missing actor", &TokenExchangeRequest{SubjectToken: subject, Audience: "billing"}, core.ErrInvalidClaim},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tokenService.ExchangeToken(tt.request, "gateway"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExchangeToken error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
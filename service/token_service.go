@@ -1,60 +1,366 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwt"
 	"github.com/sushan531/jwk-auth/core"
 )
 
 // TokenService handles token-specific operations
 type TokenService interface {
-	CreateAccessToken(claims map[string]any, keyPrefix string) (string, error)
+	CreateAccessToken(claims map[string]any, keyPrefix string, opts ...IssueOption) (string, error)
 	CreateRefreshToken(claims map[string]any, keyPrefix string) (string, error)
 	RefreshAccessToken(refreshToken string, newClaims map[string]any, keyPrefix string) (string, error)
 	ValidateAccessToken(token string) (*TokenClaims, error)
 	ValidateRefreshToken(token string) (*TokenClaims, error)
+	ValidateBatch(tokens []string) []BatchResult
+	CreateIDToken(request *IDTokenRequest, keyPrefix string) (string, error)
+	ValidateIDToken(token string, clientID string, nonce string) (*TokenClaims, error)
+	ExchangeToken(request *TokenExchangeRequest, keyPrefix string) (*ExchangedToken, error)
+	Introspect(token string) (*IntrospectionResponse, error)
+	RevokeToken(token string, tokenTypeHint string, clientID string) error
+
+	// Context-aware variants; the methods above call these with context.Background()
+	CreateAccessTokenContext(ctx context.Context, claims map[string]any, keyPrefix string, opts ...IssueOption) (string, error)
+	CreateRefreshTokenContext(ctx context.Context, claims map[string]any, keyPrefix string) (string, error)
+	RefreshAccessTokenContext(ctx context.Context, refreshToken string, newClaims map[string]any, keyPrefix string) (string, error)
+	ValidateAccessTokenContext(ctx context.Context, token string) (*TokenClaims, error)
+	ValidateRefreshTokenContext(ctx context.Context, token string) (*TokenClaims, error)
+	ValidateBatchContext(ctx context.Context, tokens []string) []BatchResult
+	CreateIDTokenContext(ctx context.Context, request *IDTokenRequest, keyPrefix string) (string, error)
+	ValidateIDTokenContext(ctx context.Context, token string, clientID string, nonce string) (*TokenClaims, error)
+	ExchangeTokenContext(ctx context.Context, request *TokenExchangeRequest, keyPrefix string) (*ExchangedToken, error)
+	IntrospectContext(ctx context.Context, token string) (*IntrospectionResponse, error)
+	RevokeTokenContext(ctx context.Context, token string, tokenTypeHint string, clientID string) error
 }
 
 type tokenService struct {
-	auth   Auth
-	config *core.Config
+	auth      Auth
+	config    *core.Config
+	validator *core.Validator
+	// opaqueStore is set when the service issues opaque reference tokens
+	opaqueStore TokenStore
+	// exchangePolicy is set when token exchange is enabled
+	exchangePolicy ExchangePolicy
+}
+
+// TokenServiceOption configures optional TokenService behaviour
+type TokenServiceOption func(*tokenService)
+
+// WithOpaqueTokenStore makes the service issue opaque reference tokens whose
+// claims are kept in store instead of signed JWTs. Existing JWTs are still
+// accepted for validation.
+func WithOpaqueTokenStore(store TokenStore) TokenServiceOption {
+	return func(ts *tokenService) {
+		ts.opaqueStore = store
+	}
 }
 
-func NewTokenService(auth Auth, config *core.Config) TokenService {
-	return &tokenService{
-		auth:   auth,
-		config: config,
+// WithExchangePolicy enables token exchange, limited by policy
+func WithExchangePolicy(policy ExchangePolicy) TokenServiceOption {
+	return func(ts *tokenService) {
+		ts.exchangePolicy = policy
 	}
 }
 
-func (ts *tokenService) CreateAccessToken(claims map[string]any, keyPrefix string) (string, error) {
+func NewTokenService(auth Auth, config *core.Config, opts ...TokenServiceOption) TokenService {
+	ts := &tokenService{
+		auth:      auth,
+		config:    config,
+		validator: core.NewValidator(),
+	}
+	for _, opt := range opts {
+		opt(ts)
+	}
+	return ts
+}
+
+// CreateAccessToken issues an access token. Unless WithoutKeyRotation is
+// given, the key prefix's key is rotated first.
+func (ts *tokenService) CreateAccessToken(claims map[string]any, keyPrefix string, opts ...IssueOption) (string, error) {
+	return ts.CreateAccessTokenContext(context.Background(), claims, keyPrefix, opts...)
+}
+
+func (ts *tokenService) CreateAccessTokenContext(ctx context.Context, claims map[string]any, keyPrefix string, opts ...IssueOption) (string, error) {
+	return ts.issueAccessToken(ctx, claims, keyPrefix, ts.config.TokenExpiry, opts...)
+}
+
+// issueAccessToken issues an access token valid for expiry
+func (ts *tokenService) issueAccessToken(ctx context.Context, claims map[string]any, keyPrefix string, expiry time.Duration, opts ...IssueOption) (string, error) {
 	if claims == nil {
 		claims = make(map[string]any)
 	}
 	claims["purpose"] = "access"
-	return ts.auth.GenerateToken(claims, keyPrefix, ts.config.TokenExpiry, "access")
+	if ts.opaqueStore != nil {
+		// Reference tokens use no key, so only the claims options apply
+		if err := issueOptionsOf(opts).applyClaims(claims); err != nil {
+			return "", core.NewAuthError("CreateAccessToken", err)
+		}
+		return ts.issueReferenceToken(ctx, claims, keyPrefix, expiry, "access")
+	}
+	return ts.auth.GenerateTokenContext(ctx, claims, keyPrefix, expiry, "access", opts...)
 }
 
 func (ts *tokenService) CreateRefreshToken(claims map[string]any, keyPrefix string) (string, error) {
+	return ts.CreateRefreshTokenContext(context.Background(), claims, keyPrefix)
+}
+
+func (ts *tokenService) CreateRefreshTokenContext(ctx context.Context, claims map[string]any, keyPrefix string) (string, error) {
 	if claims == nil {
 		claims = make(map[string]any)
 	}
 	claims["purpose"] = "refresh"
-	return ts.auth.GenerateToken(claims, keyPrefix, ts.config.RefreshTokenExpiry, "refresh")
+	if ts.opaqueStore != nil {
+		return ts.issueReferenceToken(ctx, claims, keyPrefix, ts.config.RefreshTokenExpiry, "refresh")
+	}
+	return ts.auth.GenerateTokenContext(ctx, claims, keyPrefix, ts.config.RefreshTokenExpiry, "refresh")
 }
 
 func (ts *tokenService) RefreshAccessToken(refreshToken string, newClaims map[string]any, keyPrefix string) (string, error) {
+	return ts.RefreshAccessTokenContext(context.Background(), refreshToken, newClaims, keyPrefix)
+}
+
+func (ts *tokenService) RefreshAccessTokenContext(ctx context.Context, refreshToken string, newClaims map[string]any, keyPrefix string) (string, error) {
 	// Validate refresh token first
-	_, err := ts.ValidateRefreshToken(refreshToken)
+	refreshClaims, err := ts.ValidateRefreshTokenContext(ctx, refreshToken)
 	if err != nil {
 		return "", err
 	}
 
-	return ts.auth.GenerateTokenFromRefreshToken(newClaims, keyPrefix, ts.config.TokenExpiry)
+	// The new access token joins the refresh token's family
+	if newClaims == nil {
+		newClaims = make(map[string]any)
+	}
+	if refreshClaims.FamilyID != "" {
+		newClaims[TokenFamilyClaim] = refreshClaims.FamilyID
+	}
+
+	if ts.opaqueStore != nil {
+		newClaims["purpose"] = "access"
+		return ts.issueReferenceToken(ctx, newClaims, keyPrefix, ts.config.TokenExpiry, "access")
+	}
+	return ts.auth.GenerateTokenFromRefreshTokenContext(ctx, newClaims, keyPrefix, ts.config.TokenExpiry)
 }
 
 func (ts *tokenService) ValidateAccessToken(token string) (*TokenClaims, error) {
-	return ts.auth.ValidateToken(token, "access")
+	return ts.ValidateAccessTokenContext(context.Background(), token)
+}
+
+func (ts *tokenService) ValidateAccessTokenContext(ctx context.Context, token string) (*TokenClaims, error) {
+	return ts.validate(ctx, token, "access")
 }
 
 func (ts *tokenService) ValidateRefreshToken(token string) (*TokenClaims, error) {
-	return ts.auth.ValidateToken(token, "refresh")
+	return ts.ValidateRefreshTokenContext(context.Background(), token)
+}
+
+func (ts *tokenService) ValidateRefreshTokenContext(ctx context.Context, token string) (*TokenClaims, error) {
+	return ts.validate(ctx, token, "refresh")
+}
+
+// ValidateBatch validates many access tokens at once and returns one result
+// per token, in the order given. Self-contained tokens are verified in
+// parallel as by Auth.ValidateBatch; opaque tokens are looked up one by one.
+func (ts *tokenService) ValidateBatch(tokens []string) []BatchResult {
+	return ts.ValidateBatchContext(context.Background(), tokens)
+}
+
+func (ts *tokenService) ValidateBatchContext(ctx context.Context, tokens []string) []BatchResult {
+	if ts.opaqueStore == nil {
+		return ts.auth.ValidateBatchContext(ctx, tokens, "access")
+	}
+
+	results := make([]BatchResult, len(tokens))
+	var selfContained []string
+	var positions []int
+	for i, token := range tokens {
+		if isSelfContained(token) {
+			selfContained = append(selfContained, token)
+			positions = append(positions, i)
+			continue
+		}
+		claims, err := ts.validateReferenceToken(ctx, token, "access")
+		results[i] = BatchResult{Claims: claims, Err: err}
+	}
+	for i, result := range ts.auth.ValidateBatchContext(ctx, selfContained, "access") {
+		results[positions[i]] = result
+	}
+	return results
+}
+
+// CreateIDToken issues an OpenID Connect ID token. ID tokens are always
+// signed JWTs, even when access tokens are opaque.
+func (ts *tokenService) CreateIDToken(request *IDTokenRequest, keyPrefix string) (string, error) {
+	return ts.CreateIDTokenContext(context.Background(), request, keyPrefix)
+}
+
+func (ts *tokenService) CreateIDTokenContext(ctx context.Context, request *IDTokenRequest, keyPrefix string) (string, error) {
+	return ts.auth.GenerateIDTokenContext(ctx, request, keyPrefix, ts.config.TokenExpiry)
+}
+
+// ValidateIDToken validates an ID token issued to clientID. A non-empty
+// nonce must match the token's nonce claim.
+func (ts *tokenService) ValidateIDToken(token string, clientID string, nonce string) (*TokenClaims, error) {
+	return ts.ValidateIDTokenContext(context.Background(), token, clientID, nonce)
+}
+
+func (ts *tokenService) ValidateIDTokenContext(ctx context.Context, token string, clientID string, nonce string) (*TokenClaims, error) {
+	tokenClaims, err := ts.auth.ValidateTokenContext(ctx, token, IDTokenPurpose)
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.checkIDTokenClaims(tokenClaims, clientID, nonce); err != nil {
+		return nil, core.NewAuthError("ValidateIDToken", err)
+	}
+	return tokenClaims, nil
+}
+
+// validate checks a JWT or, in opaque mode, a reference token
+func (ts *tokenService) validate(ctx context.Context, token string, expectedPurpose string) (*TokenClaims, error) {
+	if ts.opaqueStore != nil && !isSelfContained(token) {
+		return ts.validateReferenceToken(ctx, token, expectedPurpose)
+	}
+	return ts.auth.ValidateTokenContext(ctx, token, expectedPurpose)
+}
+
+// issueReferenceToken stores claims under a new opaque token
+func (ts *tokenService) issueReferenceToken(ctx context.Context, claims map[string]any, keyPrefix string, expiry time.Duration, purpose string) (string, error) {
+	if err := ts.validator.ValidateKeyPrefix(keyPrefix); err != nil {
+		return "", core.NewAuthError("issueReferenceToken", err)
+	}
+	if err := ts.validator.ValidateClaims(claims); err != nil {
+		return "", core.NewAuthError("issueReferenceToken", err)
+	}
+	if err := ts.validator.ValidateExpiry(expiry); err != nil {
+		return "", core.NewAuthError("issueReferenceToken", err)
+	}
+
+	token, err := newReferenceToken()
+	if err != nil {
+		return "", core.NewAuthError("issueReferenceToken", err)
+	}
+
+	if purpose == "refresh" {
+		if err := assignTokenFamily(claims); err != nil {
+			return "", core.NewAuthError("issueReferenceToken", err)
+		}
+	}
+
+	tokenID, _ := claims[jwt.JwtIDKey].(string)
+	if tokenID == "" {
+		if tokenID, err = core.NewTokenID(); err != nil {
+			return "", core.NewAuthError("issueReferenceToken", err)
+		}
+	}
+
+	// Claims use the same shape as verified JWT claims
+	now := ts.config.Now()
+	expiresAt := now.Add(expiry)
+	stored := maps.Clone(claims)
+	stored[jwt.JwtIDKey] = tokenID
+	stored[jwt.IssuedAtKey] = float64(now.Unix())
+	stored[jwt.ExpirationKey] = float64(expiresAt.Unix())
+
+	record := &TokenRecord{
+		TokenID:   tokenID,
+		Purpose:   purpose,
+		KeyPrefix: keyPrefix,
+		Claims:    stored,
+		IssuedAt:  now,
+		ExpiresAt: expiresAt,
+	}
+	if err := ts.opaqueStore.Put(ctx, referenceKey(token), record); err != nil {
+		return "", core.NewAuthError("issueReferenceToken", fmt.Errorf("failed to store token: %w", err))
+	}
+	return token, nil
+}
+
+// validateReferenceToken looks up an opaque token and checks its expiry and purpose
+func (ts *tokenService) validateReferenceToken(ctx context.Context, token string, expectedPurpose string) (*TokenClaims, error) {
+	const op = "ValidateToken"
+
+	if len(token) > ts.config.TokenLengthLimit() {
+		return nil, core.NewAuthError(op, core.NewValidationError(core.ValidationCodeTokenTooLarge, "", "",
+			fmt.Errorf("%w: %d bytes, limit %d", core.ErrTokenTooLarge, len(token), ts.config.TokenLengthLimit())))
+	}
+
+	record, err := ts.opaqueStore.Get(ctx, referenceKey(token))
+	if errors.Is(err, core.ErrTokenNotFound) {
+		return nil, core.NewAuthError(op, core.NewValidationError(core.ValidationCodeUnknownToken, "", "", err))
+	}
+	if err != nil {
+		return nil, core.NewAuthError(op, fmt.Errorf("failed to look up token: %w", err))
+	}
+
+	if !ts.config.Now().Before(record.ExpiresAt) {
+		return nil, core.NewAuthError(op, core.NewValidationError(core.ValidationCodeExpired, "exp", "", core.ErrTokenExpired))
+	}
+
+	if expectedPurpose != "" && record.Purpose != expectedPurpose {
+		return nil, core.NewAuthError(op, core.NewValidationError(core.ValidationCodeWrongPurpose, "purpose", "",
+			fmt.Errorf("%w: expected '%s', got '%s'", core.ErrInvalidTokenPurpose, expectedPurpose, record.Purpose)))
+	}
+
+	familyID, _ := record.Claims[TokenFamilyClaim].(string)
+	tokenClaims := &TokenClaims{
+		Claims:    maps.Clone(record.Claims),
+		Purpose:   record.Purpose,
+		ExpiresAt: record.ExpiresAt,
+		IssuedAt:  record.IssuedAt,
+		TokenID:   record.TokenID,
+		FamilyID:  familyID,
+	}
+	if err := ts.auth.CheckRevocationContext(ctx, tokenClaims); err != nil {
+		return nil, core.NewAuthError(op, err)
+	}
+	return tokenClaims, nil
+}
+
+// RevokeToken revokes an access or refresh token as described in RFC 7009.
+// Revoking a refresh token revokes its whole family. Tokens that are already
+// invalid are ignored. When clientID is set, a token whose client_id claim
+// is missing or names another client is left alone and core.ErrTokenNotOwned
+// is returned. tokenTypeHint is accepted for compatibility; both token types
+// are recognised without it.
+func (ts *tokenService) RevokeToken(token string, tokenTypeHint string, clientID string) error {
+	return ts.RevokeTokenContext(context.Background(), token, tokenTypeHint, clientID)
+}
+
+func (ts *tokenService) RevokeTokenContext(ctx context.Context, token string, tokenTypeHint string, clientID string) error {
+	tokenClaims, err := ts.validate(ctx, token, "")
+	var validationErr *core.ValidationError
+	if errors.As(err, &validationErr) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if owner, _ := tokenClaims.Claims["client_id"].(string); clientID != "" && owner != clientID {
+		return core.NewAuthError("RevokeToken", core.ErrTokenNotOwned)
+	}
+
+	if err := ts.auth.RevokeTokenClaimsContext(ctx, tokenClaims); err != nil {
+		return err
+	}
+
+	// Opaque tokens can also be dropped from the store right away
+	if ts.opaqueStore != nil && !isSelfContained(token) {
+		if err := ts.opaqueStore.Delete(ctx, referenceKey(token)); err != nil {
+			return core.NewAuthError("RevokeToken", fmt.Errorf("failed to delete token: %w", err))
+		}
+	}
+	return nil
+}
+
+// isSelfContained reports whether token is a JWT, in compact JWS or JWE
+// form, or a PASETO token rather than an opaque reference token
+func isSelfContained(token string) bool {
+	return strings.Count(token, ".") == 2 || isEncryptedToken(token) || isPASETOToken(token)
 }
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// TokenRecord holds what an opaque reference token stands for
+type TokenRecord struct {
+	TokenID   string         `json:"token_id"`
+	Purpose   string         `json:"purpose"`
+	KeyPrefix string         `json:"key_prefix"`
+	Claims    map[string]any `json:"claims"`
+	IssuedAt  time.Time      `json:"issued_at"`
+	ExpiresAt time.Time      `json:"expires_at"`
+}
+
+// TokenStore keeps the records behind opaque reference tokens. Records are
+// stored under a hash of the reference token, never the token itself.
+type TokenStore interface {
+	Put(ctx context.Context, key string, record *TokenRecord) error
+	// Get returns core.ErrTokenNotFound for unknown keys
+	Get(ctx context.Context, key string) (*TokenRecord, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// memoryTokenStore keeps token records in memory until they expire
+type memoryTokenStore struct {
+	mutex   sync.RWMutex
+	records map[string]*TokenRecord
+}
+
+// NewMemoryTokenStore creates an in-process TokenStore
+func NewMemoryTokenStore() TokenStore {
+	return &memoryTokenStore{
+		records: make(map[string]*TokenRecord),
+	}
+}
+
+func (s *memoryTokenStore) Put(ctx context.Context, key string, record *TokenRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[key] = record
+	return nil
+}
+
+func (s *memoryTokenStore) Get(ctx context.Context, key string) (*TokenRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	record, exists := s.records[key]
+	if !exists {
+		return nil, core.ErrTokenNotFound
+	}
+	return record, nil
+}
+
+func (s *memoryTokenStore) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// PurgeExpired drops records of tokens that have expired by now
+func (s *memoryTokenStore) PurgeExpired(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, record := range s.records {
+		if record.ExpiresAt.Before(now) {
+			delete(s.records, key)
+		}
+	}
+}
+
+// newReferenceToken returns a random opaque token
+func newReferenceToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate reference token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// referenceKey is the store key for an opaque token
+func referenceKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// verifiedToken holds claims taken only from a token whose signature and
+// registered claims have been verified
+type verifiedToken struct {
+	claims map[string]any
+	keyID  string
+}
+
+// keyLookup resolves a verification key and the algorithm bound to it by kid
+type keyLookup func(ctx context.Context, kid string) (crypto.PublicKey, jwa.SignatureAlgorithm, error)
+
+// verifyToken checks a compact JWS token, one nested in a compact JWE, or
+// a PASETO token in a single pass. The key is resolved from the protected
+// header kid, the header alg must be allowed and match the key's own
+// algorithm, and exp/nbf/iat are validated against the configured clock.
+func (a *auth) verifyToken(ctx context.Context, token string) (*verifiedToken, error) {
+	return a.verifyTokenWith(ctx, token, a.jwkManager.GetVerificationKeyContext)
+}
+
+// verifyTokenWith is verifyToken with keys resolved through lookup
+func (a *auth) verifyTokenWith(ctx context.Context, token string, lookup keyLookup) (*verifiedToken, error) {
+	if len(token) > a.config.TokenLengthLimit() {
+		return nil, core.NewValidationError(core.ValidationCodeTokenTooLarge, "", "",
+			fmt.Errorf("%w: %d bytes, limit %d", core.ErrTokenTooLarge, len(token), a.config.TokenLengthLimit()))
+	}
+
+	if a.tokenCache != nil {
+		return a.verifyCached(ctx, token, lookup)
+	}
+	return a.verifySignedToken(ctx, token, lookup)
+}
+
+// verifySignedToken decrypts and verifies token with keys from lookup
+func (a *auth) verifySignedToken(ctx context.Context, token string, lookup keyLookup) (*verifiedToken, error) {
+	if isPASETOToken(token) {
+		return a.verifyPASETO(ctx, token, lookup)
+	}
+
+	if isEncryptedToken(token) {
+		signedToken, decryptErr := a.decryptToken(ctx, token)
+		if decryptErr != nil {
+			return nil, decryptErr
+		}
+		token = signedToken
+	}
+
+	// keyErr records why the key provider refused the token, since jwt.Parse
+	// only reports that no key was found
+	var keyID string
+	var keyErr *core.ValidationError
+	provider := jws.KeyProviderFunc(func(_ context.Context, sink jws.KeySink, sig *jws.Signature, _ *jws.Message) error {
+		keyErr = a.resolveVerificationKey(ctx, sink, sig, &keyID, lookup)
+		if keyErr != nil {
+			return keyErr
+		}
+		return nil
+	})
+
+	parsed, err := jwt.Parse([]byte(token),
+		jwt.WithKeyProvider(provider),
+		jwt.WithClock(jwt.ClockFunc(a.config.Now)),
+		jwt.WithContext(ctx))
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	if err != nil {
+		return nil, classifyParseError(keyID, err)
+	}
+
+	// Tokens signed with a key that was compromised and then replaced are
+	// accepted only if issued after the cut-off
+	issuedAt, _ := parsed.IssuedAt()
+	if err := a.jwkManager.CheckKeyCompromiseContext(ctx, keyID, issuedAt); err != nil {
+		return nil, core.NewValidationError(core.ValidationCodeKeyCompromised, "iat", keyID, err)
+	}
+
+	claims, err := claimsOf(parsed)
+	if err != nil {
+		return nil, core.NewValidationError(core.ValidationCodeMalformed, "", keyID, fmt.Errorf("%w: %v", core.ErrInvalidTokenFormat, err))
+	}
+	return &verifiedToken{claims: claims, keyID: keyID}, nil
+}
+
+// resolveVerificationKey hands the key named by the protected header to sink
+func (a *auth) resolveVerificationKey(ctx context.Context, sink jws.KeySink, sig *jws.Signature, keyID *string, lookup keyLookup) *core.ValidationError {
+	headers := sig.ProtectedHeaders()
+	if headers == nil {
+		return core.NewValidationError(core.ValidationCodeMissingKid, "kid", "", core.ErrMissingKidClaim)
+	}
+
+	kid, ok := headers.KeyID()
+	if !ok {
+		return core.NewValidationError(core.ValidationCodeMissingKid, "kid", "", core.ErrMissingKidClaim)
+	}
+	if kid == "" {
+		return core.NewValidationError(core.ValidationCodeInvalidKid, "kid", "", core.ErrInvalidKidClaim)
+	}
+	*keyID = kid
+
+	headerAlg, ok := headers.Algorithm()
+	if !ok {
+		return core.NewValidationError(core.ValidationCodeMalformed, "alg", kid,
+			fmt.Errorf("%w: header has no 'alg'", core.ErrInvalidTokenFormat))
+	}
+
+	publicKey, alg, keyErr := a.verificationKey(ctx, kid, headerAlg.String(), lookup)
+	if keyErr != nil {
+		return keyErr
+	}
+
+	sink.Key(alg, publicKey)
+	return nil
+}
+
+// verificationKey returns the key with kid, checking that the token's
+// algorithm is allowed and matches the key's own algorithm
+func (a *auth) verificationKey(ctx context.Context, kid string, tokenAlg string, lookup keyLookup) (crypto.PublicKey, jwa.SignatureAlgorithm, *core.ValidationError) {
+	publicKey, keyAlg, err := lookup(ctx, kid)
+	if err != nil {
+		code := core.ValidationCodeUnknownKey
+		if errors.Is(err, core.ErrKeyCompromised) {
+			code = core.ValidationCodeKeyCompromised
+		}
+		return nil, jwa.EmptySignatureAlgorithm(), core.NewValidationError(code, "kid", kid, err)
+	}
+
+	alg, err := core.CheckVerificationAlgorithm(tokenAlg, a.config.SignatureAlgorithms(), keyAlg)
+	if err != nil {
+		return nil, jwa.EmptySignatureAlgorithm(), core.NewValidationError(core.ValidationCodeAlgorithm, "alg", kid, err)
+	}
+	return publicKey, alg, nil
+}
+
+// claimsOf returns the claims of a verified token as a map, with numeric
+// dates encoded as seconds since the epoch
+func claimsOf(token jwt.Token) (map[string]any, error) {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// classifyParseError maps a jwt.Parse failure to a ValidationError
+func classifyParseError(kid string, err error) *core.ValidationError {
+	switch {
+	case errors.Is(err, jwt.TokenExpiredError()):
+		return core.NewValidationError(core.ValidationCodeExpired, "exp", kid, fmt.Errorf("%w: %v", core.ErrTokenExpired, err))
+	case errors.Is(err, jwt.TokenNotYetValidError()):
+		return core.NewValidationError(core.ValidationCodeNotYetValid, "nbf", kid, fmt.Errorf("%w: %v", core.ErrTokenNotYetValid, err))
+	case errors.Is(err, jwt.InvalidIssuedAtError()):
+		return core.NewValidationError(core.ValidationCodeNotYetValid, "iat", kid, fmt.Errorf("%w: %v", core.ErrTokenNotYetValid, err))
+	case errors.Is(err, jwt.ValidateError()):
+		return core.NewValidationError(core.ValidationCodeInvalidClaim, "", kid, fmt.Errorf("%w: %v", core.ErrInvalidTokenFormat, err))
+	case errors.Is(err, jws.ParseError()):
+		return core.NewValidationError(core.ValidationCodeMalformed, "", kid, fmt.Errorf("%w: %v", core.ErrInvalidTokenFormat, err))
+	case errors.Is(err, jws.VerifyError()), errors.Is(err, jws.VerificationError()):
+		return core.NewValidationError(core.ValidationCodeInvalidSignature, "", kid, fmt.Errorf("%w: %v", core.ErrInvalidSignature, err))
+	default:
+		return core.NewValidationError(core.ValidationCodeMalformed, "", kid, fmt.Errorf("%w: %v", core.ErrInvalidTokenFormat, err))
+	}
+}
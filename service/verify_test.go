@@ -0,0 +1,117 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sushan531/jwk-auth/authtest"
+	"github.com/sushan531/jwk-auth/core"
+)
+
+// tamper flips a character in the middle of the token's signature
+func tamper(token string) string {
+	i := strings.LastIndexByte(token, '.') + 10
+	replacement := byte('A')
+	if token[i] == 'A' {
+		replacement = 'B'
+	}
+	return token[:i] + string(replacement) + token[i+1:]
+}
+
+func TestValidateTokenReportsTypedErrors(t *testing.T) {
+	a, jwkManager := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+
+	// A token signed by a key that is no longer in the set
+	orphan, err := a.GenerateToken(map[string]any{"sub": "bob"}, "mobile", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if err := jwkManager.InitializeJwkSet("web"); err != nil {
+		t.Fatalf("InitializeJwkSet: %v", err)
+	}
+	refresh, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "refresh")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		purpose  string
+		code     core.ValidationCode
+		sentinel error
+	}{
+		{"malformed", "not.a.token", "", core.ValidationCodeMalformed, core.ErrInvalidTokenFormat},
+		{"too large", strings.Repeat("a", core.DefaultMaxTokenLength+1), "", core.ValidationCodeTokenTooLarge, core.ErrTokenTooLarge},
+		{"invalid signature", tamper(refresh), "", core.ValidationCodeInvalidSignature, core.ErrInvalidSignature},
+		{"wrong purpose", refresh, "access", core.ValidationCodeWrongPurpose, core.ErrInvalidTokenPurpose},
+		{"unknown key", orphan, "", core.ValidationCodeUnknownKey, core.ErrKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.ValidateToken(tt.token, tt.purpose)
+			var validationErr *core.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("ValidateToken error = %v, want a ValidationError", err)
+			}
+			if validationErr.Code != tt.code || !errors.Is(err, tt.sentinel) {
+				t.Errorf("ValidateToken error = %v, want code %s wrapping %v", err, tt.code, tt.sentinel)
+			}
+		})
+	}
+}
+
+func TestValidateTokenReportsRevocation(t *testing.T) {
+	a, _ := newTestAuth(t, testConfig(authtest.NewFakeClock(testStart)))
+	if _, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "access"); err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	token, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "refresh")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if err := a.RevokeToken(token); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+
+	_, err = a.ValidateToken(token, "refresh")
+	var validationErr *core.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Code != core.ValidationCodeRevoked || !errors.Is(err, core.ErrTokenRevoked) {
+		t.Fatalf("ValidateToken error = %v, want a token_revoked ValidationError", err)
+	}
+}
+
+func TestValidateTokenReportsCompromisedKey(t *testing.T) {
+	clock := authtest.NewFakeClock(testStart)
+	a, jwkManager := newTestAuth(t, testConfig(clock))
+	token, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	if _, err := jwkManager.MarkKeyCompromised("web", "leaked", time.Time{}); err != nil {
+		t.Fatalf("MarkKeyCompromised: %v", err)
+	}
+
+	_, err = a.ValidateToken(token, "access")
+	var validationErr *core.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Code != core.ValidationCodeKeyCompromised || !errors.Is(err, core.ErrKeyCompromised) {
+		t.Fatalf("ValidateToken error = %v, want a key_compromised ValidationError", err)
+	}
+
+	// After rotation, tokens issued past the cut-off are accepted again
+	clock.Advance(time.Second)
+	fresh, err := a.GenerateToken(map[string]any{"sub": "alice"}, "web", time.Hour, "access")
+	if err != nil {
+		t.Fatalf("GenerateToken after compromise: %v", err)
+	}
+	if _, err := a.ValidateToken(fresh, "access"); err != nil {
+		t.Errorf("ValidateToken for a token signed by the replacement key: %v", err)
+	}
+	if _, err := a.ValidateToken(token, "access"); err == nil {
+		t.Error("ValidateToken accepted a token signed by the compromised key")
+	}
+}